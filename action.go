@@ -2,16 +2,27 @@ package gingk8s
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
 
 	"github.com/meln5674/gosh"
-	. "github.com/onsi/gomega"
 )
 
 type ClusterActionID struct {
 	id string
 }
 
+func (c ClusterActionID) serializeID() serializedID {
+	return serializedID{Kind: "ClusterAction", ID: c.id}
+}
+
+func (c *ClusterActionID) deserializeID(id serializedID) error {
+	return deserializeID("ClusterAction", &c.id, id)
+}
+
 func (c ClusterActionID) AddResourceDependency(dep *ResourceDependencies) {
 	dep.ClusterActions = append(dep.ClusterActions, c)
 }
@@ -48,7 +59,7 @@ func (c ClusterActionOnFailure) Setup(g Gingk8s, ctx context.Context, cluster Cl
 }
 
 func (c ClusterActionOnFailure) Cleanup(g Gingk8s, ctx context.Context, cluster Cluster) error {
-	if !g.suite.ginkgo.Failed() {
+	if !g.Failed() {
 		return nil
 	}
 	return c(g, ctx, cluster)
@@ -72,9 +83,46 @@ func (c ClusterDaemonCommander) Setup(g Gingk8s, ctx context.Context, cluster Cl
 	return c.Start()
 }
 
+// Cleanup implements ClusterActionable.
+// The daemon exiting due to being killed is not an error, only failing to kill it, or it failing on its own.
 func (c ClusterDaemonCommander) Cleanup(g Gingk8s, ctx context.Context, cluster Cluster) error {
-	c.Kill()
-	return c.Wait()
+	err := c.Kill()
+	if errors.Is(err, gosh.ErrNotStarted) {
+		return nil
+	}
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	err = c.Wait()
+	if killedBySignal(err) {
+		return nil
+	}
+	return err
+}
+
+// killedBySignal returns true if an error from waiting for a command is only due to it being killed
+func killedBySignal(err error) bool {
+	if err == nil {
+		return false
+	}
+	var multi *gosh.MultiProcessError
+	if errors.As(err, &multi) {
+		for _, err := range multi.Errors {
+			if !killedBySignal(err) {
+				return false
+			}
+		}
+		return true
+	}
+	if errors.Is(err, gosh.ErrKilled) || errors.Is(err, context.Canceled) {
+		return true
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && (status.Signal() == syscall.SIGTERM || status.Signal() == syscall.SIGKILL)
 }
 
 type ClusterActionFuncs struct {
@@ -96,9 +144,10 @@ func (g Gingk8s) ClusterAction(cluster ClusterID, name string, c ClusterActionab
 
 	dependsOn := append([]string{cluster.id}, forResourceDependencies(deps...).allIDs(g.specState, cluster.id)...)
 	node := specNode{
-		state:     g.specState,
-		id:        actionID,
-		dependsOn: dependsOn,
+		state:      g.specState,
+		id:         actionID,
+		dependsOn:  dependsOn,
+		conditions: getConditions(c),
 		specAction: &clusterActionAction{
 			id:        actionID,
 			clusterID: cluster.id,
@@ -130,15 +179,12 @@ func (c *clusterActionAction) Setup(ctx context.Context, state *specState) error
 	return state.clusterActions[c.id](c.g, ctx, state.getCluster(c.clusterID))
 }
 
-func (c *clusterActionAction) Cleanup(ctx context.Context, state *specState) {
-	if state.NoCleanup() {
-		return
-	}
+func (c *clusterActionAction) Cleanup(ctx context.Context, state *specState) error {
 	if c.cleanup == nil {
-		return
+		return nil
 	}
 
-	Expect(c.cleanup(c.g, ctx, state.getCluster(c.clusterID))).To(Succeed())
+	return c.cleanup(c.g, ctx, state.getCluster(c.clusterID))
 }
 
 func (c *clusterActionAction) Title(state *specState) string {
@@ -0,0 +1,64 @@
+package gingk8s
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/meln5674/gosh"
+)
+
+func TestClusterDaemonCommanderCleanup(t *testing.T) {
+	cases := []struct {
+		name string
+		// script is run by sh as the daemon
+		script string
+		// wait is how long to wait after starting the daemon before cleaning it up
+		wait time.Duration
+		// err is a substring of the expected error, or empty if none is expected
+		err string
+	}{
+		{name: "killed", script: "sleep 60"},
+		{name: "exited cleanly", script: "true", wait: 100 * time.Millisecond},
+		{name: "failed on its own", script: "exit 3", wait: 100 * time.Millisecond, err: "exit status 3"},
+		{name: "failed when killed", script: "trap 'exit 4' TERM; sleep 60 & wait", wait: 100 * time.Millisecond, err: "exit status 4"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			daemon := ClusterDaemonCommander{Commander: gosh.Command("sh", "-c", tc.script).WithContext(ctx)}
+			g := ForTest(t)
+			cluster := &DummyCluster{Name: "test"}
+			if err := daemon.Setup(g, ctx, cluster); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(tc.wait)
+			checkErr(t, daemon.Cleanup(g, ctx, cluster), tc.err)
+		})
+	}
+
+	t.Run("not started", func(t *testing.T) {
+		daemon := ClusterDaemonCommander{Commander: gosh.Command("sh", "-c", "sleep 60")}
+		if err := daemon.Cleanup(ForTest(t), context.Background(), &DummyCluster{}); err != nil {
+			t.Errorf("expected no error for a daemon which never started, got %v", err)
+		}
+	})
+	t.Run("function", func(t *testing.T) {
+		ctx := context.Background()
+		daemon := ClusterDaemonCommander{Commander: gosh.FromFunc(ctx, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
+			go func() {
+				<-ctx.Done()
+				done <- ctx.Err()
+				close(done)
+			}()
+			return nil
+		})}
+		if err := daemon.Setup(ForTest(t), ctx, &DummyCluster{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := daemon.Cleanup(ForTest(t), ctx, &DummyCluster{}); err != nil {
+			t.Errorf("expected no error for a killed function, got %v", err)
+		}
+	})
+}
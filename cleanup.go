@@ -0,0 +1,76 @@
+package gingk8s
+
+// CleanupPolicy controls when a resource is cleaned up
+type CleanupPolicy string
+
+const (
+	// CleanupDefault cleans up a resource unless SuiteOpts.NoSuiteCleanup or SuiteOpts.NoSpecCleanup is set.
+	// Resources within a cluster which is kept due to its policy are also kept.
+	CleanupDefault CleanupPolicy = ""
+	// CleanupAlways always cleans up a resource, even if SuiteOpts.NoSuiteCleanup or SuiteOpts.NoSpecCleanup is set
+	CleanupAlways CleanupPolicy = "Always"
+	// CleanupOnSuccess only cleans up a resource if the suite or spec it was set up for has not failed,
+	// so that it can be debugged. See Gingk8s.Failed() for what is considered a failure.
+	CleanupOnSuccess CleanupPolicy = "OnSuccess"
+	// CleanupOnFailureKeep is an alias of CleanupOnSuccess: resources are kept on failure and deleted on success
+	CleanupOnFailureKeep = CleanupOnSuccess
+	// CleanupNever never cleans up a resource
+	CleanupNever CleanupPolicy = "Never"
+)
+
+// Failed returns true if the suite or spec this Gingk8s is for has failed, as reported by its Harness,
+// or if MarkFailed() was called.
+// Ginkgo only reports failures of the current node, so a suite is not considered failed when one of its specs fails,
+// unless that spec used ForSpec(), or MarkFailed() is called, e.g.
+//
+//	var _ = ReportAfterEach(func(report SpecReport) {
+//		if report.Failed() {
+//			g.MarkFailed()
+//		}
+//	})
+func (g Gingk8s) Failed() bool {
+	return g.specState.failed()
+}
+
+// MarkFailed marks the suite, and the spec this Gingk8s is for, if any, as failed.
+func (g Gingk8s) MarkFailed() {
+	for spec := g.specState; spec != nil; spec = spec.parent {
+		spec.markedFailed.Store(true)
+	}
+}
+
+func (s *specState) failed() bool {
+	return s.markedFailed.Load() || s.suite.harness.Failed()
+}
+
+// keep returns true if a node should not be cleaned up
+func (s *specNode) keep() bool {
+	policy := s.conditions.cleanupPolicy()
+	if policy == CleanupDefault {
+		kind, clusterID := s.kindAndClusterID()
+		if kind != "Cluster" && clusterID != "" {
+			policy = getConditions(unwrapCluster(s.state.getCluster(clusterID))).cleanupPolicy()
+			if policy == CleanupAlways {
+				policy = CleanupDefault
+			}
+		}
+	}
+	switch policy {
+	case CleanupAlways:
+		return false
+	case CleanupNever:
+		return true
+	case CleanupOnSuccess:
+		if s.state.failed() {
+			return true
+		}
+	}
+	return s.state.NoCleanup()
+}
+
+func (c *Conditions) cleanupPolicy() CleanupPolicy {
+	if c == nil {
+		return CleanupDefault
+	}
+	return c.CleanupPolicy
+}
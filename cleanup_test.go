@@ -0,0 +1,125 @@
+package gingk8s
+
+import (
+	"context"
+	"testing"
+)
+
+// conditionalCluster is a cluster which does nothing, with conditions such as a cleanup policy
+type conditionalCluster struct {
+	DummyCluster
+	Conditions
+}
+
+func TestCleanupPolicy(t *testing.T) {
+	cases := []struct {
+		name string
+		// cluster and action are the policies of the cluster and of an action in it
+		cluster, action CleanupPolicy
+		opts            SuiteOpts
+		failed          bool
+		// spec, if true, registers the action in a spec instead of the suite
+		spec bool
+		// clusterKept and actionKept are whether the cluster and action are expected to be kept
+		clusterKept, actionKept bool
+	}{
+		{name: "default"},
+		{name: "default failed", failed: true},
+		{name: "default without suite cleanup", opts: SuiteOpts{NoSuiteCleanup: true}, clusterKept: true, actionKept: true},
+		{name: "default without spec cleanup", opts: SuiteOpts{NoSpecCleanup: true}},
+		{name: "spec without spec cleanup", opts: SuiteOpts{NoSpecCleanup: true}, spec: true, actionKept: true},
+		{name: "spec without suite cleanup", opts: SuiteOpts{NoSuiteCleanup: true}, spec: true, clusterKept: true},
+		{name: "always", action: CleanupAlways, opts: SuiteOpts{NoSuiteCleanup: true}, clusterKept: true},
+		{name: "never", action: CleanupNever, actionKept: true},
+		{name: "on success", action: CleanupOnSuccess},
+		{name: "on success failed", action: CleanupOnSuccess, failed: true, actionKept: true},
+		{name: "on success failed spec", action: CleanupOnSuccess, failed: true, spec: true, actionKept: true},
+		{name: "on success without suite cleanup", action: CleanupOnSuccess, opts: SuiteOpts{NoSuiteCleanup: true}, clusterKept: true, actionKept: true},
+		{name: "inherited from cluster", cluster: CleanupNever, clusterKept: true, actionKept: true},
+		{name: "inherited on success", cluster: CleanupOnSuccess, failed: true, clusterKept: true, actionKept: true},
+		{name: "overridden by resource", cluster: CleanupNever, action: CleanupAlways, clusterKept: true},
+		{
+			// Resources are not deleted just because their cluster would be
+			name:    "cluster always not inherited",
+			cluster: CleanupAlways, opts: SuiteOpts{NoSuiteCleanup: true},
+			actionKept: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newManualHarness(t)
+			g := New(h)
+			g.Options(tc.opts)
+			kept := map[string]bool{}
+			g.Subscribe(func(event Event) {
+				switch event.Type {
+				case CleanupKept:
+					kept[event.NodeKind] = true
+				case CleanupSucceeded:
+					kept[event.NodeKind] = false
+				}
+			})
+			cluster := g.Cluster(&conditionalCluster{
+				DummyCluster: *testCluster(t),
+				Conditions:   Conditions{CleanupPolicy: tc.cluster},
+			})
+			action := &ConditionalClusterAction{
+				ClusterActionable: ClusterAction(func(Gingk8s, context.Context, Cluster) error { return nil }),
+				Conditions:        Conditions{CleanupPolicy: tc.action},
+			}
+
+			if tc.spec {
+				err := g.TrySetup(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				spec := g.ForSpec()
+				spec.ClusterAction(cluster, "action", action)
+				err = spec.TrySetup(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				g.ClusterAction(cluster, "action", action)
+				err := g.TrySetup(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			// The cleanup of the spec, if any, happens first, as it was deferred last
+			h.failed = tc.failed
+			h.cleanup()
+
+			if kept["Cluster"] != tc.clusterKept {
+				t.Errorf("expected cluster kept=%v, got %v", tc.clusterKept, kept["Cluster"])
+			}
+			if kept["ClusterAction"] != tc.actionKept {
+				t.Errorf("expected action kept=%v, got %v", tc.actionKept, kept["ClusterAction"])
+			}
+		})
+	}
+}
+
+func TestMarkFailed(t *testing.T) {
+	h := newManualHarness(t)
+	g := New(h)
+	spec := g.ForSpec()
+	other := g.ForSpec()
+	if g.Failed() || spec.Failed() {
+		t.Fatal("expected nothing to have failed")
+	}
+	spec.MarkFailed()
+	if !spec.Failed() || !g.Failed() {
+		t.Error("expected marking a spec as failed to also fail its suite")
+	}
+	if other.Failed() {
+		t.Error("expected other specs not to be failed")
+	}
+
+	h = newManualHarness(t)
+	g = New(h)
+	h.failed = true
+	if !g.Failed() || !g.ForSpec().Failed() {
+		t.Error("expected a failure reported by the harness to fail the suite and its specs")
+	}
+}
@@ -1,12 +1,15 @@
 package gingk8s
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"os"
 	"path/filepath"
-
-	. "github.com/onsi/gomega"
+	"reflect"
+	"sync"
 
 	"github.com/meln5674/gosh"
 )
@@ -15,26 +18,44 @@ type ClusterID struct {
 	id string
 }
 
+func (c ClusterID) serializeID() serializedID {
+	return serializedID{Kind: "Cluster", ID: c.id}
+}
+
+func (c *ClusterID) deserializeID(id serializedID) error {
+	return deserializeID("Cluster", &c.id, id)
+}
+
+func (c ClusterID) AddResourceDependency(dep *ResourceDependencies) {
+	dep.Clusters = append(dep.Clusters, c)
+}
+
+// Cluster registers a cluster to be created during Setup(), and deleted during cleanup, along with the images
+// to load into it once it has been created.
+// When called on the result of ForSpec(), the cluster is only created for that spec, and is deleted once it finishes.
+// Such a cluster may depend on images registered for the whole suite, which are pulled or built only once, and then
+// loaded into every cluster which depends on them.
 func (g Gingk8s) Cluster(cluster Cluster, deps ...ClusterDependency) ClusterID {
 	clusterID := newID()
 	g.clusters[clusterID] = cluster
 	g.clusterThirdPartyLoads[clusterID] = make(map[string]string)
 	g.clusterCustomLoads[clusterID] = make(map[string]string)
 	g.clusterImageArchiveLoads[clusterID] = make(map[string]string)
-	clusterNode := specNode{state: g.specState, id: clusterID, specAction: &createClusterAction{id: clusterID}}
+	clusterNode := specNode{state: g.specState, id: clusterID, specAction: &createClusterAction{id: clusterID}, conditions: getConditions(cluster)}
 	allDeps := *forClusterDependencies(deps...)
 	for _, image := range allDeps.ThirdPartyImages {
 		loadID := newID()
 		g.clusterThirdPartyLoads[clusterID][image.id] = loadID
 		g.setup = append(g.setup, &specNode{
-			state:     g.specState,
-			id:        loadID,
-			dependsOn: []string{clusterID, image.id},
+			state:      g.specState,
+			id:         loadID,
+			dependsOn:  []string{clusterID, image.id},
+			conditions: g.getThirdPartyImageConditions(image.id),
 			specAction: &loadThirdPartyImageAction{
 				id:        loadID,
 				imageID:   image.id,
 				clusterID: clusterID,
-				noCache:   g.suite.opts.NoCacheImages && !g.thirdPartyImages[image.id].NoPull,
+				noCache:   g.suite.opts.NoCacheImages && g.ownsImage(image.id) && !g.getThirdPartyImage(image.id).NoPull,
 			},
 		})
 	}
@@ -42,14 +63,15 @@ func (g Gingk8s) Cluster(cluster Cluster, deps ...ClusterDependency) ClusterID {
 		loadID := newID()
 		g.clusterCustomLoads[clusterID][image.id] = loadID
 		g.setup = append(g.setup, &specNode{
-			state:     g.specState,
-			id:        loadID,
-			dependsOn: []string{clusterID, image.id},
+			state:      g.specState,
+			id:         loadID,
+			dependsOn:  []string{clusterID, image.id},
+			conditions: g.getCustomImageConditions(image.id),
 			specAction: &loadCustomImageAction{
 				id:        loadID,
 				imageID:   image.id,
 				clusterID: clusterID,
-				noCache:   g.suite.opts.NoCacheImages,
+				noCache:   g.suite.opts.NoCacheImages && g.ownsImage(image.id),
 			},
 		})
 	}
@@ -57,9 +79,10 @@ func (g Gingk8s) Cluster(cluster Cluster, deps ...ClusterDependency) ClusterID {
 		loadID := newID()
 		g.clusterImageArchiveLoads[clusterID][archive.id] = loadID
 		g.setup = append(g.setup, &specNode{
-			state:     g.specState,
-			id:        loadID,
-			dependsOn: []string{clusterID, archive.id},
+			state:      g.specState,
+			id:         loadID,
+			dependsOn:  []string{clusterID, archive.id},
+			conditions: g.getImageArchiveConditions(archive.id),
 			specAction: &loadImageArchiveAction{
 				id:        loadID,
 				archiveID: archive.id,
@@ -72,19 +95,45 @@ func (g Gingk8s) Cluster(cluster Cluster, deps ...ClusterDependency) ClusterID {
 	return ClusterID{id: clusterID}
 }
 
+// nodeLabeler is implemented by clusters whose nodes are labeled as owned by the current run after they are set up
+type nodeLabeler interface {
+	labelNodes(ctx context.Context, kubectl Kubectl) gosh.Commander
+}
+
 type createClusterAction struct {
 	id string
 }
 
 func (c *createClusterAction) Setup(ctx context.Context, state *specState) error {
-	return state.clusters[c.id].Create(ctx, true).Run()
+	cluster := state.clusters[c.id]
+	err := cluster.Create(ctx, true).Run()
+	if err != nil {
+		return err
+	}
+	if labeler, ok := cluster.(nodeLabeler); ok {
+		err = labeler.labelNodes(ctx, state.suite.opts.Kubectl).Run()
+		if err != nil {
+			return err
+		}
+	}
+	if state.suite.opts.Incremental {
+		return checkClusterIdentity(ctx, state, cluster)
+	}
+	return nil
 }
 
-func (c *createClusterAction) Cleanup(ctx context.Context, state *specState) {
-	if state.NoCleanup() {
-		return
+func (c *createClusterAction) Cleanup(ctx context.Context, state *specState) error {
+	cluster := state.clusters[c.id]
+	err := cluster.Delete(ctx).Run()
+	if err != nil {
+		return err
+	}
+	// Nothing recorded for a deleted cluster applies to the next one with the same name.
+	// Without a temporary directory, the path would be relative to the working directory instead.
+	if !state.suite.opts.Incremental || cluster.GetTempDir() == "" {
+		return nil
 	}
-	Expect(state.clusters[c.id].Delete(ctx).Run()).To(Succeed())
+	return os.RemoveAll(ClusterTempPath(cluster, fingerprintGroup))
 }
 
 func (c *createClusterAction) Title(state *specState) string {
@@ -195,3 +244,77 @@ func (n noopCluster) LoadImageArchives(ctx context.Context, format ImageFormat,
 func (n noopCluster) Delete(ctx context.Context) gosh.Commander {
 	return noopCommander(ctx)
 }
+
+var (
+	clusterKindsLock = sync.Mutex{}
+	clusterKinds     = map[string]func() Cluster{}
+	clusterKindNames = map[reflect.Type]string{}
+)
+
+func init() {
+	RegisterClusterKind("Dummy", func() Cluster { return &DummyCluster{} })
+	RegisterClusterKind("Kind", func() Cluster { return &KindCluster{} })
+}
+
+// RegisterClusterKind registers a type of cluster as able to be passed between processes by Serialize() and Deserialize().
+// newCluster must return a pointer to a new, empty instance of the type, which will be used with encoding/json to
+// restore it, so the type must be able to be round-tripped as JSON, and must be able to be used without calling
+// Create() again.
+// Clusters with types that are not registered will be restored as a DummyCluster.
+func RegisterClusterKind(kind string, newCluster func() Cluster) {
+	clusterKindsLock.Lock()
+	defer clusterKindsLock.Unlock()
+	typ := reflect.TypeOf(newCluster())
+	if existing, ok := clusterKindNames[typ]; ok && existing != kind {
+		panic(fmt.Sprintf("Cluster type %v is already registered as %s", typ, existing))
+	}
+	clusterKinds[kind] = newCluster
+	clusterKindNames[typ] = kind
+}
+
+type serializedCluster struct {
+	Kind    string
+	Cluster json.RawMessage
+}
+
+// unwrapCluster returns the cluster originally registered, for a cluster inherited from a parent spec
+func unwrapCluster(cluster Cluster) Cluster {
+	if noop, ok := cluster.(noopCluster); ok {
+		return noop.Cluster
+	}
+	return cluster
+}
+
+func serializeCluster(cluster Cluster) (serializedCluster, error) {
+	cluster = unwrapCluster(cluster)
+	clusterKindsLock.Lock()
+	kind, ok := clusterKindNames[reflect.TypeOf(cluster)]
+	clusterKindsLock.Unlock()
+	if !ok {
+		kind = "Dummy"
+		cluster = &DummyCluster{Connection: *cluster.GetConnection(), TempDir: cluster.GetTempDir(), Name: cluster.GetName()}
+	}
+	clusterJSON, err := json.Marshal(cluster)
+	if err != nil {
+		return serializedCluster{}, err
+	}
+	return serializedCluster{Kind: kind, Cluster: clusterJSON}, nil
+}
+
+func (s *serializedCluster) deserialize() (Cluster, error) {
+	clusterKindsLock.Lock()
+	newCluster, ok := clusterKinds[s.Kind]
+	clusterKindsLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("Serialized cluster has unregistered kind %s", s.Kind)
+	}
+	cluster := newCluster()
+	// Unknown fields are most likely typos in a SuiteDefinition, which would otherwise be silently ignored
+	dec := json.NewDecoder(bytes.NewReader(s.Cluster))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
@@ -0,0 +1,175 @@
+// Command gingk8s brings up and tears down a Gingk8s environment described by a SuiteDefinition file
+// outside of a Ginkgo suite, e.g. to debug the same environment a suite uses by hand.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/meln5674/gingk8s"
+)
+
+const usage = `Usage: gingk8s <command> -f <definition> [flags]
+
+Commands:
+  up      Create all clusters, images, releases, and manifests in the definition
+  down    Delete all resources in the definition
+  status  Show whether each cluster in the definition is ready
+  plan    Show the steps "up" would execute, in order
+  gc      Delete kind clusters, and namespaces and releases in the definition's clusters, leaked by other runs
+
+Flags:
+`
+
+// harness reports progress to stderr. The environment is meant to outlive the command, so cleanup is never deferred.
+type harness struct {
+	failed bool
+}
+
+func (h *harness) By(text string) {
+	fmt.Fprintf(os.Stderr, "STEP: %s\n", text)
+}
+
+func (h *harness) Writer() io.Writer {
+	return os.Stderr
+}
+
+func (h *harness) DeferCleanup(func(context.Context)) {}
+
+func (h *harness) Failed() bool {
+	return h.failed
+}
+
+func (h *harness) Fail(err error) {
+	h.failed = true
+	fmt.Fprintln(os.Stderr, err)
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	flags := flag.NewFlagSet("gingk8s", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	var opts gingk8s.SuiteOpts
+	var definitionPath string
+	var klogFlags string
+	flags.StringVar(&definitionPath, "f", "", "Path to the YAML or JSON suite definition (required, except for gc)")
+	flags.StringVar(&opts.SkipSelector, "skip-selector", "", "Label selector of resources to skip")
+	flags.StringVar(&opts.FocusSelector, "focus-selector", "", "Label selector of resources to not skip")
+	flags.BoolVar(&opts.Incremental, "incremental", false, "Only re-execute resources whose inputs have changed since the last run")
+	var gcOpts gingk8s.GarbageCollectOpts
+	flags.DurationVar(&gcOpts.MaxAge, "max-age", 0, "gc: Delete resources older than this")
+	flags.BoolVar(&gcOpts.DeadRuns, "dead-runs", false, "gc: Delete resources created by processes on this host that are no longer running")
+	flags.BoolVar(&gcOpts.DryRun, "dry-run", false, "gc: Only print leaked resources, do not delete them")
+	flags.BoolVar(&opts.NoCacheImages, "no-cache-images", false, "Remove local copies of images after loading them")
+	flags.StringVar(&opts.CustomImageTag, "custom-image-tag", "", "Tag to build custom images with")
+	flags.StringVar(&klogFlags, "klog-flags", "", "Space-separated flags to configure klog with, e.g. \"-v=5\"")
+
+	if len(args) == 0 {
+		flags.Usage()
+		return 2
+	}
+	command := args[0]
+	if strings.HasPrefix(command, "-") {
+		flags.Usage()
+		return 2
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if definitionPath == "" && command != "gc" {
+		fmt.Fprintln(os.Stderr, "-f is required")
+		flags.Usage()
+		return 2
+	}
+	if klogFlags != "" {
+		opts.KLogFlags = strings.Fields(klogFlags)
+	}
+	// The CLI owns the process, so a first interrupt during cleanup should only be reported instead of aborting it
+	opts.HandleSignals = true
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	g := gingk8s.New(&harness{})
+	g.Options(opts)
+	var err error
+	if definitionPath != "" {
+		_, err = g.LoadDefinition(definitionPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	switch command {
+	case "up":
+		err = g.TrySetup(ctx)
+	case "down":
+		err = g.TryTeardown(ctx)
+	case "status":
+		ready := true
+		for _, status := range g.ClusterStatuses(ctx) {
+			state := "Ready"
+			if !status.Ready {
+				state = "NotReady"
+				ready = false
+			}
+			fmt.Printf("%s\t%s\tkubeconfig=%s\tcontext=%s\n", status.Name, state, status.Connection.Kubeconfig, status.Connection.Context)
+			if !status.Ready && status.Message != "" {
+				fmt.Printf("\t%s\n", strings.ReplaceAll(status.Message, "\n", "\n\t"))
+			}
+		}
+		if !ready {
+			return 1
+		}
+	case "plan":
+		var plan []gingk8s.PlannedNode
+		plan, err = g.Plan()
+		titles := map[string]string{}
+		for ix, node := range plan {
+			titles[node.ID] = node.Title
+			skipped := ""
+			if node.Skipped {
+				skipped = " (skipped)"
+			}
+			fmt.Printf("%d. %s%s\n", ix+1, node.Title, skipped)
+			for _, dep := range node.DependsOn {
+				if title, ok := titles[dep]; ok {
+					fmt.Printf("\tafter: %s\n", title)
+				}
+			}
+		}
+	case "gc":
+		var leaked []gingk8s.LeakedResource
+		leaked, err = g.GarbageCollect(ctx, gcOpts)
+		for _, resource := range leaked {
+			name := resource.Name
+			if resource.Namespace != "" {
+				name = resource.Namespace + "/" + name
+			}
+			fmt.Printf("%s\t%s\t%s\trun=%s\tcreated=%s\n", resource.Kind, resource.Cluster, name, resource.RunID, resource.Created.Format(time.RFC3339))
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %s\n", command)
+		flags.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	definition := filepath.Join(dir, "definition.yaml")
+	err := os.WriteFile(definition, []byte(`
+clusters:
+  main:
+    kind: Dummy
+    spec: {name: main}
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.yaml")
+	err = os.WriteFile(invalid, []byte("clustres: {}\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{name: "no arguments", args: []string{}, code: 2},
+		{name: "flags before command", args: []string{"-f", definition, "plan"}, code: 2},
+		{name: "unknown flag", args: []string{"plan", "-f", definition, "-nope"}, code: 2},
+		{name: "missing definition", args: []string{"plan"}, code: 2},
+		{name: "unknown command", args: []string{"nope", "-f", definition}, code: 2},
+		{name: "definition not found", args: []string{"plan", "-f", filepath.Join(dir, "missing.yaml")}, code: 1},
+		{name: "invalid definition", args: []string{"plan", "-f", invalid}, code: 1},
+		{name: "invalid selector", args: []string{"plan", "-f", definition, "-skip-selector", "!!tier"}, code: 1},
+		{name: "plan", args: []string{"plan", "-f", definition}, code: 0},
+		{name: "up", args: []string{"up", "-f", definition}, code: 0},
+		{name: "down", args: []string{"down", "-f", definition}, code: 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := run(tc.args); code != tc.code {
+				t.Errorf("expected exit code %d, got %d", tc.code, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package gingk8s
+
+import (
+	"context"
+	"os"
+
+	"github.com/meln5674/godag"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// SkipSelectorEnv is the environment variable used for SuiteOpts.SkipSelector if it is not set
+	SkipSelectorEnv = "GINGK8S_SKIP_SELECTOR"
+	// FocusSelectorEnv is the environment variable used for SuiteOpts.FocusSelector if it is not set
+	FocusSelectorEnv = "GINGK8S_FOCUS_SELECTOR"
+)
+
+// Conditions control whether or not a resource is set up and cleaned up.
+// A skipped resource is treated as if it succeeded, so any resources which depend on it are still set up.
+// Skipped resources are not cleaned up.
+type Conditions struct {
+	// Labels are arbitrary key/value pairs which can be matched by SuiteOpts.SkipSelector and SuiteOpts.FocusSelector
+	Labels map[string]string
+	// If, if set, is called immediately before the resource would be set up, and the resource is skipped if it returns false
+	If func(context.Context) bool `json:"-"`
+	// CleanupPolicy controls when the resource is cleaned up. It has no effect on images.
+	CleanupPolicy CleanupPolicy
+}
+
+// GetConditions returns the conditions for a resource.
+// Any Cluster or ClusterActionable which embeds Conditions will have them respected.
+func (c *Conditions) GetConditions() *Conditions {
+	return c
+}
+
+// Conditional is a resource which can be skipped
+type Conditional interface {
+	GetConditions() *Conditions
+}
+
+// ConditionalClusterAction adds Conditions to an existing ClusterActionable
+type ConditionalClusterAction struct {
+	ClusterActionable
+	Conditions
+}
+
+var _ = ClusterActionable(&ConditionalClusterAction{})
+var _ = Conditional(&ConditionalClusterAction{})
+
+func getConditions(resource interface{}) *Conditions {
+	conditional, ok := resource.(Conditional)
+	if !ok {
+		return nil
+	}
+	return conditional.GetConditions()
+}
+
+func (c *Conditions) enabled(ctx context.Context) bool {
+	return c == nil || c.If == nil || c.If(ctx)
+}
+
+func (c *Conditions) matches(selector labels.Selector) bool {
+	var set labels.Set
+	if c != nil {
+		set = c.Labels
+	}
+	return selector.Matches(set)
+}
+
+func parseSelector(opt, env string) (labels.Selector, error) {
+	if opt == "" {
+		opt = os.Getenv(env)
+	}
+	if opt == "" {
+		return nil, nil
+	}
+	return labels.Parse(opt)
+}
+
+// skippedNodes returns the IDs of nodes which should be skipped due to their labels
+func (s *specState) skippedNodes(nodes []*specNode) (godag.Set[string], error) {
+	skipped := godag.NewSet[string]()
+	skip, err := parseSelector(s.suite.opts.SkipSelector, SkipSelectorEnv)
+	if err != nil {
+		return skipped, err
+	}
+	focus, err := parseSelector(s.suite.opts.FocusSelector, FocusSelectorEnv)
+	if err != nil {
+		return skipped, err
+	}
+	for _, node := range nodes {
+		if _, ok := node.specAction.(*specNoop); ok {
+			continue
+		}
+		if skip != nil && node.conditions.matches(skip) {
+			skipped.Add(node.id)
+		}
+		if focus != nil && !node.conditions.matches(focus) {
+			skipped.Add(node.id)
+		}
+	}
+	return skipped, nil
+}
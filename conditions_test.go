@@ -0,0 +1,220 @@
+package gingk8s
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// recorder records the setup and cleanup of cluster actions, in the order they happen
+type recorder struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (r *recorder) record(event string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event)
+}
+
+// action returns a cluster action which records "setup <name>" and "cleanup <name>"
+func (r *recorder) action(name string) ClusterActionFuncs {
+	return ClusterActionFuncs{
+		SetupFunc: func(Gingk8s, context.Context, Cluster) error {
+			r.record("setup " + name)
+			return nil
+		},
+		CleanupFunc: func(Gingk8s, context.Context, Cluster) error {
+			r.record("cleanup " + name)
+			return nil
+		},
+	}
+}
+
+// get returns the recorded events, joined with commas
+func (r *recorder) get() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return strings.Join(r.events, ",")
+}
+
+// labeled returns a cluster action with labels which records its setup and cleanup
+func (r *recorder) labeled(name string, labels map[string]string) *ConditionalClusterAction {
+	return &ConditionalClusterAction{
+		ClusterActionable: r.action(name),
+		Conditions:        Conditions{Labels: labels},
+	}
+}
+
+// testCluster returns a cluster which does nothing, and keeps its temporary files in a directory removed after the test
+func testCluster(t *testing.T) *DummyCluster {
+	return &DummyCluster{Name: "test", TempDir: t.TempDir()}
+}
+
+func TestParseSelector(t *testing.T) {
+	cases := []struct {
+		name string
+		opt  string
+		env  string
+		// selector is the expected parsed selector, or empty if none is expected
+		selector string
+		// err is a substring of the expected error, or empty if none is expected
+		err string
+	}{
+		{name: "unset"},
+		{name: "option", opt: "tier=db", selector: "tier=db"},
+		{name: "environment", env: "tier!=db", selector: "tier!=db"},
+		{name: "option overrides environment", opt: "tier=db", env: "tier=web", selector: "tier=db"},
+		{name: "invalid", opt: "!!tier", err: "unable to parse"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(SkipSelectorEnv, tc.env)
+			selector, err := parseSelector(tc.opt, SkipSelectorEnv)
+			checkErr(t, err, tc.err)
+			if err != nil {
+				return
+			}
+			if tc.selector == "" {
+				if selector != nil {
+					t.Errorf("expected no selector, got %s", selector)
+				}
+				return
+			}
+			if selector == nil || selector.String() != tc.selector {
+				t.Errorf("expected selector %s, got %v", tc.selector, selector)
+			}
+		})
+	}
+}
+
+func TestSkipFocusSelectors(t *testing.T) {
+	cases := []struct {
+		name             string
+		skip, focus      string
+		skipEnv          string
+		focusEnv         string
+		events           string
+		expectSetupError string
+	}{
+		{
+			name:   "no selectors",
+			events: "setup db,setup web,setup none,cleanup none,cleanup web,cleanup db",
+		},
+		{
+			name:   "skip",
+			skip:   "tier=db",
+			events: "setup web,setup none,cleanup none,cleanup web",
+		},
+		{
+			name:    "skip from environment",
+			skipEnv: "tier=db",
+			events:  "setup web,setup none,cleanup none,cleanup web",
+		},
+		{
+			name:   "focus",
+			focus:  "tier",
+			events: "setup db,setup web,cleanup web,cleanup db",
+		},
+		{
+			name:     "focus from environment",
+			focusEnv: "tier=web",
+			events:   "setup web,cleanup web",
+		},
+		{
+			name:   "skip and focus",
+			skip:   "tier=db",
+			focus:  "tier",
+			events: "setup web,cleanup web",
+		},
+		{
+			name:             "invalid selector",
+			skip:             "!!tier",
+			expectSetupError: "unable to parse",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(SkipSelectorEnv, tc.skipEnv)
+			t.Setenv(FocusSelectorEnv, tc.focusEnv)
+			r := &recorder{}
+			t.Run("setup", func(t *testing.T) {
+				g := ForTest(t)
+				g.Options(SuiteOpts{SkipSelector: tc.skip, FocusSelector: tc.focus})
+				cluster := g.Cluster(testCluster(t))
+				// Actions are chained so that the order of events is deterministic
+				db := g.ClusterAction(cluster, "db", r.labeled("db", map[string]string{"tier": "db"}))
+				web := g.ClusterAction(cluster, "web", r.labeled("web", map[string]string{"tier": "web"}), db)
+				g.ClusterAction(cluster, "none", r.action("none"), web)
+				checkErr(t, g.TrySetup(context.Background()), tc.expectSetupError)
+			})
+			if events := r.get(); events != tc.events {
+				t.Errorf("expected events %q, got %q", tc.events, events)
+			}
+		})
+	}
+}
+
+func TestConditionsIf(t *testing.T) {
+	r := &recorder{}
+	type key struct{}
+	var gotValue interface{}
+	t.Run("setup", func(t *testing.T) {
+		g := ForTest(t)
+		cluster := g.Cluster(testCluster(t))
+		first := g.ClusterAction(cluster, "first", &ConditionalClusterAction{
+			ClusterActionable: r.action("first"),
+			Conditions: Conditions{If: func(ctx context.Context) bool {
+				gotValue = ctx.Value(key{})
+				return false
+			}},
+		})
+		second := g.ClusterAction(cluster, "second", &ConditionalClusterAction{
+			ClusterActionable: r.action("second"),
+			Conditions:        Conditions{If: func(context.Context) bool { return true }},
+		}, first)
+		g.ClusterAction(cluster, "third", r.action("third"), second)
+		err := g.TrySetup(context.WithValue(context.Background(), key{}, "value"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if gotValue != "value" {
+		t.Errorf("expected If to be called with the setup context, got value %v", gotValue)
+	}
+	// Skipped resources are treated as if they succeeded, but are not cleaned up
+	expected := "setup second,setup third,cleanup third,cleanup second"
+	if events := r.get(); events != expected {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+}
+
+func TestGetConditions(t *testing.T) {
+	conditions := Conditions{Labels: map[string]string{"a": "b"}}
+	if getConditions(&ConditionalClusterAction{Conditions: conditions}).Labels["a"] != "b" {
+		t.Error("expected the conditions of a ConditionalClusterAction")
+	}
+	if getConditions(ClusterAction(nil)) != nil {
+		t.Error("expected no conditions for a resource which is not Conditional")
+	}
+	var none *Conditions
+	if !none.enabled(context.Background()) {
+		t.Error("expected a resource without conditions to be enabled")
+	}
+	if !none.matches(mustParseSelector(t, "!tier")) || none.matches(mustParseSelector(t, "tier")) {
+		t.Error("expected a resource without conditions to have no labels")
+	}
+}
+
+func mustParseSelector(t *testing.T, selector string) labels.Selector {
+	t.Helper()
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
@@ -0,0 +1,157 @@
+package gingk8s
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/meln5674/gosh"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The functions in this file return Values which are resolved against a cluster other than the one a resource is
+// being deployed to, e.g. to point a release in one cluster at a service in another.
+// Resources using them should include the other cluster, or the resources in it they refer to, in their dependencies.
+
+// otherCluster returns the cluster with the given ID, which may have been registered by a parent spec
+func otherCluster(g Gingk8s, id ClusterID) (Cluster, error) {
+	cluster := g.getCluster(id.id)
+	if cluster == nil {
+		return nil, fmt.Errorf("No cluster with ID %s", id.id)
+	}
+	return cluster, nil
+}
+
+// ClusterServiceEndpoint returns a Value which resolves to the host:port that a service in another cluster can be reached at
+// from outside of that cluster. LoadBalancer services use their ingress address and port. All other services must be
+// NodePort services, and use the internal IP of the first node of that cluster and the node port.
+// port is the name or number of the service port, and may be empty if the service only has one port.
+func ClusterServiceEndpoint(id ClusterID, namespace, name, port string) Value {
+	return func(g Gingk8s, ctx context.Context, _ Cluster) (Value, error) {
+		cluster, err := otherCluster(g, id)
+		if err != nil {
+			return nil, err
+		}
+		var svc corev1.Service
+		err = g.Kubectl(ctx, cluster, "get", "service", "--namespace", namespace, name, "-o", "json").
+			WithStreams(gosh.FuncOut(gosh.SaveJSON(&svc))).
+			Run()
+		if err != nil {
+			return nil, err
+		}
+		svcPort, err := findServicePort(&svc, port)
+		if err != nil {
+			return nil, err
+		}
+		if svc.Spec.Type == corev1.ServiceTypeLoadBalancer {
+			for _, ingress := range svc.Status.LoadBalancer.Ingress {
+				host := ingress.IP
+				if host == "" {
+					host = ingress.Hostname
+				}
+				if host != "" {
+					return net.JoinHostPort(host, strconv.Itoa(int(svcPort.Port))), nil
+				}
+			}
+			return nil, fmt.Errorf("LoadBalancer service %s/%s in cluster %s has not been assigned an address", namespace, name, cluster.GetName())
+		}
+		if svcPort.NodePort == 0 {
+			return nil, fmt.Errorf("Service %s/%s in cluster %s is not a LoadBalancer or NodePort service", namespace, name, cluster.GetName())
+		}
+		ips, err := nodeIPs(g, ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("Cluster %s has no nodes with an internal IP", cluster.GetName())
+		}
+		return net.JoinHostPort(ips[0], strconv.Itoa(int(svcPort.NodePort))), nil
+	}
+}
+
+func findServicePort(svc *corev1.Service, port string) (*corev1.ServicePort, error) {
+	if port == "" && len(svc.Spec.Ports) == 1 {
+		return &svc.Spec.Ports[0], nil
+	}
+	for ix := range svc.Spec.Ports {
+		svcPort := &svc.Spec.Ports[ix]
+		if svcPort.Name == port || strconv.Itoa(int(svcPort.Port)) == port {
+			return svcPort, nil
+		}
+	}
+	return nil, fmt.Errorf("Service %s/%s has no port %q", svc.Namespace, svc.Name, port)
+}
+
+// ClusterNodeIPs returns a Value which resolves to the internal IPs of the nodes of another cluster
+func ClusterNodeIPs(id ClusterID) Value {
+	return func(g Gingk8s, ctx context.Context, _ Cluster) (Value, error) {
+		cluster, err := otherCluster(g, id)
+		if err != nil {
+			return nil, err
+		}
+		return nodeIPs(g, ctx, cluster)
+	}
+}
+
+func nodeIPs(g Gingk8s, ctx context.Context, cluster Cluster) ([]string, error) {
+	var nodeList corev1.NodeList
+	err := g.Kubectl(ctx, cluster, "get", "nodes", "-o", "json").WithStreams(gosh.FuncOut(gosh.SaveJSON(&nodeList))).Run()
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]string, 0, len(nodeList.Items))
+	for _, node := range nodeList.Items {
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == corev1.NodeInternalIP {
+				ips = append(ips, addr.Address)
+				break
+			}
+		}
+	}
+	return ips, nil
+}
+
+// ClusterKindNetworkInfo returns a Value which resolves to the result of calling f with the network information
+// of another cluster, which must be a KindCluster, e.g. to pass its pod or service CIDR.
+func ClusterKindNetworkInfo(id ClusterID, f func(*KindNetworkInfo) Value) Value {
+	return func(g Gingk8s, ctx context.Context, _ Cluster) (Value, error) {
+		cluster, err := otherCluster(g, id)
+		if err != nil {
+			return nil, err
+		}
+		kind, ok := unwrapCluster(cluster).(*KindCluster)
+		if !ok {
+			return nil, fmt.Errorf("Cluster %s is not a KindCluster", cluster.GetName())
+		}
+		info, err := kind.GetNetworkInfo(ctx, g)
+		if err != nil {
+			return nil, err
+		}
+		return f(info), nil
+	}
+}
+
+// ClusterCABundle returns a Value which resolves to the PEM-encoded certificate authority of another cluster,
+// as published in the kube-root-ca.crt ConfigMap
+func ClusterCABundle(id ClusterID) Value {
+	return func(g Gingk8s, ctx context.Context, _ Cluster) (Value, error) {
+		cluster, err := otherCluster(g, id)
+		if err != nil {
+			return nil, err
+		}
+		var cm corev1.ConfigMap
+		err = g.Kubectl(ctx, cluster, "get", "configmap", "--namespace", "kube-system", "kube-root-ca.crt", "-o", "json").
+			WithStreams(gosh.FuncOut(gosh.SaveJSON(&cm))).
+			Run()
+		if err != nil {
+			return nil, err
+		}
+		ca, ok := cm.Data["ca.crt"]
+		if !ok {
+			return nil, fmt.Errorf("Cluster %s has no CA bundle in kube-system/kube-root-ca.crt", cluster.GetName())
+		}
+		return ca, nil
+	}
+}
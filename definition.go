@@ -0,0 +1,307 @@
+package gingk8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"sigs.k8s.io/yaml"
+)
+
+// SuiteDefinition is a declarative description of a set of resources to register with Gingk8s, as an alternative to
+// calling Cluster(), Release(), etc, from Go. It can be parsed from YAML or JSON, and each resource is keyed by a
+// name which is used to refer to it as a dependency, and must be unique among all resources in the definition.
+// Relative paths are interpreted relative to the working directory of the test process, as they would be from Go.
+type SuiteDefinition struct {
+	// Clusters are the clusters to create
+	Clusters map[string]ClusterDefinition
+	// ThirdPartyImages are the third party images to pull
+	ThirdPartyImages map[string]ThirdPartyImage
+	// CustomImages are the custom images to build
+	CustomImages map[string]CustomImage
+	// ImageArchives are the image archives to pull
+	ImageArchives map[string]ImageArchive
+	// Releases are the helm releases to install
+	Releases map[string]ReleaseDefinition
+	// Manifests are the manifest sets to create
+	Manifests map[string]ManifestsDefinition
+}
+
+// ClusterDefinition describes a cluster in a SuiteDefinition
+type ClusterDefinition struct {
+	// Kind is the kind of cluster, as registered with RegisterClusterKind, e.g. "Kind"
+	Kind string
+	// Spec is the cluster itself, which is decoded into the type registered for Kind
+	Spec json.RawMessage
+	// Images are the names of ThirdPartyImages, CustomImages, and ImageArchives to load into the cluster
+	Images []string
+}
+
+// ReleaseDefinition describes a helm release in a SuiteDefinition
+type ReleaseDefinition struct {
+	// Cluster is the name of the cluster to install the release into
+	Cluster string
+	// Release is the release itself
+	Release HelmRelease
+	// DependsOn are the names of images, releases, and manifest sets which must be ready before installing the release.
+	// Images must also be loaded into Cluster.
+	DependsOn []string
+}
+
+// ManifestsDefinition describes a set of manifests in a SuiteDefinition
+type ManifestsDefinition struct {
+	// Cluster is the name of the cluster to create the manifests in
+	Cluster string
+	// Manifests are the manifests themselves
+	Manifests KubernetesManifests
+	// DependsOn are the names of images, releases, and manifest sets which must be ready before creating the manifests.
+	// Images must also be loaded into Cluster.
+	DependsOn []string
+}
+
+// DefinedIDs are the IDs of the resources registered from a SuiteDefinition, keyed by their names
+type DefinedIDs struct {
+	Clusters         map[string]ClusterID
+	ThirdPartyImages map[string]ThirdPartyImageID
+	CustomImages     map[string]CustomImageID
+	ImageArchives    map[string]ImageArchiveID
+	Releases         map[string]ReleaseID
+	Manifests        map[string]ManifestsID
+}
+
+// ParseSuiteDefinition parses a SuiteDefinition from YAML or JSON
+func ParseSuiteDefinition(data []byte) (*SuiteDefinition, error) {
+	def := new(SuiteDefinition)
+	err := yaml.UnmarshalStrict(data, def)
+	if err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// ReadSuiteDefinition reads a SuiteDefinition from a YAML or JSON file
+func ReadSuiteDefinition(path string) (*SuiteDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	def, err := ParseSuiteDefinition(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return def, nil
+}
+
+// LoadDefinition reads a SuiteDefinition from a YAML or JSON file and registers its resources
+func (g Gingk8s) LoadDefinition(path string) (DefinedIDs, error) {
+	def, err := ReadSuiteDefinition(path)
+	if err != nil {
+		return DefinedIDs{}, err
+	}
+	return g.Definition(def)
+}
+
+// Definition registers all of the resources in a SuiteDefinition, and returns their IDs.
+// No resources are registered if the definition is invalid.
+func (g Gingk8s) Definition(def *SuiteDefinition) (DefinedIDs, error) {
+	ids := DefinedIDs{
+		Clusters:         make(map[string]ClusterID, len(def.Clusters)),
+		ThirdPartyImages: make(map[string]ThirdPartyImageID, len(def.ThirdPartyImages)),
+		CustomImages:     make(map[string]CustomImageID, len(def.CustomImages)),
+		ImageArchives:    make(map[string]ImageArchiveID, len(def.ImageArchives)),
+		Releases:         make(map[string]ReleaseID, len(def.Releases)),
+		Manifests:        make(map[string]ManifestsID, len(def.Manifests)),
+	}
+
+	kinds := map[string]string{}
+	addNames := func(kind string, names []string) error {
+		for _, name := range names {
+			if existing, ok := kinds[name]; ok {
+				return fmt.Errorf("Name %s is used by both a %s and a %s", name, existing, kind)
+			}
+			kinds[name] = kind
+		}
+		return nil
+	}
+	for _, err := range []error{
+		addNames("cluster", sortedKeys(def.Clusters)),
+		addNames("third party image", sortedKeys(def.ThirdPartyImages)),
+		addNames("custom image", sortedKeys(def.CustomImages)),
+		addNames("image archive", sortedKeys(def.ImageArchives)),
+		addNames("release", sortedKeys(def.Releases)),
+		addNames("manifest set", sortedKeys(def.Manifests)),
+	} {
+		if err != nil {
+			return DefinedIDs{}, err
+		}
+	}
+
+	// Validate everything before registering anything, as registration cannot be undone
+	clusters := make(map[string]Cluster, len(def.Clusters))
+	for name, clusterDef := range def.Clusters {
+		cluster, err := (&serializedCluster{Kind: clusterDef.Kind, Cluster: clusterDef.Spec}).deserialize()
+		if err != nil {
+			return DefinedIDs{}, fmt.Errorf("cluster %s: %w", name, err)
+		}
+		clusters[name] = cluster
+		for _, image := range clusterDef.Images {
+			switch kinds[image] {
+			case "third party image", "custom image", "image archive":
+			default:
+				return DefinedIDs{}, fmt.Errorf("cluster %s: %s is not an image", name, image)
+			}
+		}
+	}
+	checkDeps := func(kind, name, cluster string, deps []string) error {
+		if _, ok := def.Clusters[cluster]; !ok {
+			return fmt.Errorf("%s %s: %s is not a cluster", kind, name, cluster)
+		}
+		loaded := map[string]bool{}
+		for _, image := range def.Clusters[cluster].Images {
+			loaded[image] = true
+		}
+		for _, dep := range deps {
+			switch kinds[dep] {
+			case "third party image", "custom image", "image archive":
+				if !loaded[dep] {
+					return fmt.Errorf("%s %s: image %s is not loaded into cluster %s", kind, name, dep, cluster)
+				}
+			case "release", "manifest set":
+			default:
+				return fmt.Errorf("%s %s: %s is not an image, release, or manifest set", kind, name, dep)
+			}
+		}
+		return nil
+	}
+	for name, release := range def.Releases {
+		if release.Release.Chart == nil {
+			return DefinedIDs{}, fmt.Errorf("release %s: chart is required", name)
+		}
+		err := checkDeps("release", name, release.Cluster, release.DependsOn)
+		if err != nil {
+			return DefinedIDs{}, err
+		}
+	}
+	for name, manifests := range def.Manifests {
+		err := checkDeps("manifest set", name, manifests.Cluster, manifests.DependsOn)
+		if err != nil {
+			return DefinedIDs{}, err
+		}
+	}
+	resourceOrder, err := def.resourceOrder()
+	if err != nil {
+		return DefinedIDs{}, err
+	}
+
+	for _, name := range sortedKeys(def.ThirdPartyImages) {
+		image := def.ThirdPartyImages[name]
+		ids.ThirdPartyImages[name] = g.ThirdPartyImage(&image)
+	}
+	for _, name := range sortedKeys(def.CustomImages) {
+		image := def.CustomImages[name]
+		ids.CustomImages[name] = g.CustomImage(&image)
+	}
+	for _, name := range sortedKeys(def.ImageArchives) {
+		archive := def.ImageArchives[name]
+		ids.ImageArchives[name] = g.ImageArchive(&archive)
+	}
+	for _, name := range sortedKeys(def.Clusters) {
+		deps := []ClusterDependency{}
+		for _, image := range def.Clusters[name].Images {
+			switch kinds[image] {
+			case "third party image":
+				deps = append(deps, ids.ThirdPartyImages[image])
+			case "custom image":
+				deps = append(deps, ids.CustomImages[image])
+			case "image archive":
+				deps = append(deps, ids.ImageArchives[image])
+			}
+		}
+		ids.Clusters[name] = g.Cluster(clusters[name], deps...)
+	}
+	resourceDeps := func(names []string) []ResourceDependency {
+		deps := []ResourceDependency{}
+		for _, dep := range names {
+			switch kinds[dep] {
+			case "third party image":
+				deps = append(deps, ids.ThirdPartyImages[dep])
+			case "custom image":
+				deps = append(deps, ids.CustomImages[dep])
+			case "image archive":
+				deps = append(deps, ids.ImageArchives[dep])
+			case "release":
+				deps = append(deps, ids.Releases[dep])
+			case "manifest set":
+				deps = append(deps, ids.Manifests[dep])
+			}
+		}
+		return deps
+	}
+	for _, name := range resourceOrder {
+		if release, ok := def.Releases[name]; ok {
+			ids.Releases[name] = g.Release(ids.Clusters[release.Cluster], &release.Release, resourceDeps(release.DependsOn)...)
+			continue
+		}
+		manifests := def.Manifests[name]
+		ids.Manifests[name] = g.Manifests(ids.Clusters[manifests.Cluster], &manifests.Manifests, resourceDeps(manifests.DependsOn)...)
+	}
+
+	return ids, nil
+}
+
+// resourceOrder returns the names of releases and manifests such that each comes after all of its dependencies,
+// as a resource's dependencies must already be registered to have IDs
+func (def *SuiteDefinition) resourceOrder() ([]string, error) {
+	order := make([]string, 0, len(def.Releases)+len(def.Manifests))
+	done := map[string]bool{}
+	visiting := map[string]bool{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		var deps []string
+		if release, ok := def.Releases[name]; ok {
+			deps = release.DependsOn
+		} else if manifests, ok := def.Manifests[name]; ok {
+			deps = manifests.DependsOn
+		} else {
+			// Images have no dependencies that need ordering
+			return nil
+		}
+		if done[name] {
+			return nil
+		}
+		path = append(path, name)
+		if visiting[name] {
+			return fmt.Errorf("Dependency cycle: %v", path)
+		}
+		visiting[name] = true
+		for _, dep := range deps {
+			err := visit(dep, path)
+			if err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		done[name] = true
+		order = append(order, name)
+		return nil
+	}
+	for _, names := range [][]string{sortedKeys(def.Releases), sortedKeys(def.Manifests)} {
+		for _, name := range names {
+			err := visit(name, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return order, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
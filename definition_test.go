@@ -0,0 +1,233 @@
+package gingk8s
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSuiteDefinition(t *testing.T) {
+	cases := []struct {
+		name string
+		def  string
+		// err is a substring of the expected error, or empty if none is expected
+		err string
+	}{
+		{
+			name: "valid",
+			def: `
+clusters:
+  main:
+    kind: Dummy
+    spec: {name: main}
+`,
+		},
+		{
+			name: "JSON",
+			def:  `{"clusters": {"main": {"kind": "Dummy", "spec": {"name": "main"}}}}`,
+		},
+		{
+			name: "unknown top-level field",
+			def: `
+clustres:
+  main:
+    kind: Dummy
+`,
+			err: "clustres",
+		},
+		{
+			name: "unknown release field",
+			def: `
+releases:
+  app:
+    cluster: main
+    release: {name: app, chartt: {}}
+`,
+			err: "chartt",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseSuiteDefinition([]byte(tc.def))
+			checkErr(t, err, tc.err)
+		})
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	const cluster = `
+clusters:
+  main:
+    kind: Dummy
+    spec: {name: main}
+    images: [app-image]
+customImages:
+  app-image: {repository: app}
+thirdPartyImages:
+  other-image: {name: other}
+`
+	cases := []struct {
+		name string
+		def  string
+		// err is a substring of the expected error, or empty if none is expected
+		err string
+		// releases and manifests are the number of each expected to be registered
+		releases, manifests int
+	}{
+		{
+			name: "valid",
+			def: cluster + `
+releases:
+  app:
+    cluster: main
+    release: {name: app, chart: {name: app}}
+    dependsOn: [app-image, config]
+manifests:
+  config:
+    cluster: main
+    manifests: {name: config}
+`,
+			releases:  1,
+			manifests: 1,
+		},
+		{
+			name: "unknown cluster kind",
+			def: `
+clusters:
+  main: {kind: Nonexistent, spec: {}}
+`,
+			err: "unregistered kind Nonexistent",
+		},
+		{
+			name: "unknown cluster spec field",
+			def: `
+clusters:
+  main: {kind: Dummy, spec: {nmae: main}}
+`,
+			err: "nmae",
+		},
+		{
+			name: "duplicate name",
+			def: cluster + `
+manifests:
+  main: {cluster: main}
+`,
+			err: "Name main is used by both a cluster and a manifest set",
+		},
+		{
+			name: "cluster loads non-image",
+			def: `
+clusters:
+  main: {kind: Dummy, spec: {name: main}, images: [missing]}
+`,
+			err: "cluster main: missing is not an image",
+		},
+		{
+			name: "release without chart",
+			def: cluster + `
+releases:
+  app: {cluster: main, release: {name: app}}
+`,
+			err: "release app: chart is required",
+		},
+		{
+			name: "unknown cluster",
+			def: cluster + `
+manifests:
+  config: {cluster: other}
+`,
+			err: "manifest set config: other is not a cluster",
+		},
+		{
+			name: "image not loaded into cluster",
+			def: cluster + `
+manifests:
+  config: {cluster: main, dependsOn: [other-image]}
+`,
+			err: "image other-image is not loaded into cluster main",
+		},
+		{
+			name: "unknown dependency",
+			def: cluster + `
+manifests:
+  config: {cluster: main, dependsOn: [missing]}
+`,
+			err: "missing is not an image, release, or manifest set",
+		},
+		{
+			name: "self dependency",
+			def: cluster + `
+manifests:
+  config: {cluster: main, dependsOn: [config]}
+`,
+			err: "Dependency cycle: [config config]",
+		},
+		{
+			name: "dependency cycle",
+			def: cluster + `
+releases:
+  app: {cluster: main, release: {name: app, chart: {name: app}}, dependsOn: [config]}
+manifests:
+  config: {cluster: main, dependsOn: [crds]}
+  crds: {cluster: main, dependsOn: [app]}
+`,
+			err: "Dependency cycle: [app config crds app]",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			def, err := ParseSuiteDefinition([]byte(tc.def))
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := ForTest(t)
+			ids, err := g.Definition(def)
+			checkErr(t, err, tc.err)
+			if err != nil {
+				if len(g.setup) != 0 {
+					t.Errorf("expected nothing to be registered for an invalid definition, got %d nodes", len(g.setup))
+				}
+				return
+			}
+			if len(ids.Releases) != tc.releases || len(ids.Manifests) != tc.manifests {
+				t.Errorf("expected %d releases and %d manifests, got %d and %d", tc.releases, tc.manifests, len(ids.Releases), len(ids.Manifests))
+			}
+		})
+	}
+}
+
+func TestResourceOrder(t *testing.T) {
+	def := &SuiteDefinition{
+		Releases: map[string]ReleaseDefinition{
+			"a": {DependsOn: []string{"c", "image"}},
+			"b": {},
+		},
+		Manifests: map[string]ManifestsDefinition{
+			"c": {DependsOn: []string{"d"}},
+			"d": {},
+		},
+	}
+	order, err := def.resourceOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := strings.Join(order, ","), "d,c,a,b"; got != expected {
+		t.Errorf("expected order %s, got %s", expected, got)
+	}
+}
+
+// checkErr fails a test if err does not contain expected, or is not nil if expected is empty
+func checkErr(t *testing.T, err error, expected string) {
+	t.Helper()
+	if expected == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	if err == nil {
+		t.Fatalf("expected an error containing %q, got none", expected)
+	}
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected an error containing %q, got: %v", expected, err)
+	}
+}
@@ -4,13 +4,19 @@ import (
 	"fmt"
 )
 
+// ResourceDependencies are what a release, manifest set, or cluster action must wait for before it is set up.
+// These may belong to any cluster, not only the one the resource is deployed to.
 type ResourceDependencies struct {
+	// Clusters are other clusters which must be created first, e.g. to pass their endpoints as values
+	Clusters         []ClusterID
 	ThirdPartyImages []ThirdPartyImageID
 	CustomImages     []CustomImageID
 	ImageArchives    []ImageArchiveID
 	Manifests        []ManifestsID
 	Releases         []ReleaseID
 	ClusterActions   []ClusterActionID
+	// ImagesInClusters are images which are loaded into clusters other than the one the resource is deployed to
+	ImagesInClusters []ImageInCluster
 }
 
 type ClusterDependencies struct {
@@ -30,12 +36,14 @@ type ClusterDependency interface {
 }
 
 func (r *ResourceDependencies) AddResourceDependency(dep *ResourceDependencies) {
+	dep.Clusters = append(dep.Clusters, r.Clusters...)
 	dep.ThirdPartyImages = append(dep.ThirdPartyImages, r.ThirdPartyImages...)
 	dep.CustomImages = append(dep.CustomImages, r.CustomImages...)
 	dep.Manifests = append(dep.Manifests, r.Manifests...)
 	dep.Releases = append(dep.Releases, r.Releases...)
-	dep.CustomImages = append(dep.CustomImages, r.CustomImages...)
 	dep.ImageArchives = append(dep.ImageArchives, r.ImageArchives...)
+	dep.ClusterActions = append(dep.ClusterActions, r.ClusterActions...)
+	dep.ImagesInClusters = append(dep.ImagesInClusters, r.ImagesInClusters...)
 }
 
 func (c ClusterDependencies) AddClusterDependency(dep *ClusterDependencies) {
@@ -62,34 +70,61 @@ func forClusterDependencies(deps ...ClusterDependency) *ClusterDependencies {
 	return &allDeps
 }
 
+// ImageInCluster is an image as it is loaded into a specific cluster. Images a resource depends on must be loaded into
+// the cluster it is deployed to, so this must be used instead to depend on an image loaded into a different cluster,
+// including in ImageValues and KustomizeImage, e.g. to run it with a cluster action against that cluster.
+type ImageInCluster struct {
+	Cluster ClusterID
+	Image   ImageID
+}
+
+var _ = ImageID(ImageInCluster{})
+
+func (i ImageInCluster) AddResourceDependency(dep *ResourceDependencies) {
+	dep.ImagesInClusters = append(dep.ImagesInClusters, i)
+}
+
+func (i ImageInCluster) imageReference(state *specState) string {
+	return i.Image.imageReference(state)
+}
+
+// allIDs returns the IDs of the nodes a resource in a cluster must depend on.
+// Images are depended on through their load into that cluster, which must exist, except for ImagesInClusters,
+// which are depended on through their load into the cluster they name.
 func (r *ResourceDependencies) allIDs(state *specState, clusterID string) []string {
 	dependsOn := []string{}
-	if _, ok := state.clusters[clusterID]; !ok {
+	if state.getCluster(clusterID) == nil {
 		panic(fmt.Sprintf("BUG: No cluster with ID %s", clusterID))
 	}
-	for _, image := range r.ThirdPartyImages {
-		if _, ok := state.clusterThirdPartyLoads[clusterID][image.id]; !ok {
-			panic(fmt.Sprintf("BUG: Third-Party image %s is not set to load to cluster %s", image.id, clusterID))
+	for _, cluster := range r.Clusters {
+		if state.getCluster(cluster.id) == nil {
+			panic(fmt.Sprintf("BUG: No cluster with ID %s", cluster.id))
 		}
-		dependsOn = append(dependsOn, state.clusterThirdPartyLoads[clusterID][image.id])
+		dependsOn = append(dependsOn, cluster.id)
+	}
+	for _, image := range r.ThirdPartyImages {
+		dependsOn = append(dependsOn, state.mustImageLoadID("Third-Party image", clusterID, image.id, thirdPartyLoads))
 	}
 	for _, image := range r.CustomImages {
-		if _, ok := state.clusterCustomLoads[clusterID]; !ok {
-			panic(fmt.Sprintf("BUG: No cluster with ID %s", clusterID))
-		}
-		if _, ok := state.clusterCustomLoads[clusterID][image.id]; !ok {
-			panic(fmt.Sprintf("BUG: Custom image %s is not set to load to cluster %s", image.id, clusterID))
-		}
-		dependsOn = append(dependsOn, state.clusterCustomLoads[clusterID][image.id])
+		dependsOn = append(dependsOn, state.mustImageLoadID("Custom image", clusterID, image.id, customLoads))
 	}
-	for _, image := range r.ImageArchives {
-		if _, ok := state.clusterImageArchiveLoads[clusterID]; !ok {
-			panic(fmt.Sprintf("BUG: No cluster with ID %s", clusterID))
+	for _, archive := range r.ImageArchives {
+		dependsOn = append(dependsOn, state.mustImageLoadID("Image archive", clusterID, archive.id, imageArchiveLoads))
+	}
+	for _, image := range r.ImagesInClusters {
+		if state.getCluster(image.Cluster.id) == nil {
+			panic(fmt.Sprintf("BUG: No cluster with ID %s", image.Cluster.id))
 		}
-		if _, ok := state.clusterImageArchiveLoads[clusterID][image.id]; !ok {
-			panic(fmt.Sprintf("BUG: Custom image %s is not set to load to cluster %s", image.id, clusterID))
+		switch id := image.Image.(type) {
+		case ThirdPartyImageID:
+			dependsOn = append(dependsOn, state.mustImageLoadID("Third-Party image", image.Cluster.id, id.id, thirdPartyLoads))
+		case CustomImageID:
+			dependsOn = append(dependsOn, state.mustImageLoadID("Custom image", image.Cluster.id, id.id, customLoads))
+		case ImageArchiveID:
+			dependsOn = append(dependsOn, state.mustImageLoadID("Image archive", image.Cluster.id, id.id, imageArchiveLoads))
+		default:
+			panic(fmt.Sprintf("BUG: Unsupported image type %T in ImageInCluster", image.Image))
 		}
-		dependsOn = append(dependsOn, state.clusterImageArchiveLoads[clusterID][image.id])
 	}
 	for _, manifests := range r.Manifests {
 		dependsOn = append(dependsOn, manifests.id)
@@ -102,3 +137,18 @@ func (r *ResourceDependencies) allIDs(state *specState, clusterID string) []stri
 	}
 	return dependsOn
 }
+
+func thirdPartyLoads(s *specState) map[string]map[string]string   { return s.clusterThirdPartyLoads }
+func customLoads(s *specState) map[string]map[string]string       { return s.clusterCustomLoads }
+func imageArchiveLoads(s *specState) map[string]map[string]string { return s.clusterImageArchiveLoads }
+
+// mustImageLoadID returns the ID of the node which loads an image into a cluster, using the loads registered by this spec
+// and its parents, and panics if it is not loaded into that cluster
+func (s *specState) mustImageLoadID(kind, clusterID, imageID string, loadsOf func(*specState) map[string]map[string]string) string {
+	for state := s; state != nil; state = state.parent {
+		if loadID, ok := loadsOf(state)[clusterID][imageID]; ok {
+			return loadID
+		}
+	}
+	panic(fmt.Sprintf("BUG: %s %s is not set to load to cluster %s, use ImageInCluster to depend on an image in another cluster", kind, imageID, clusterID))
+}
@@ -0,0 +1,70 @@
+package gingk8s
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAllIDs(t *testing.T) {
+	g := ForTest(t)
+	thirdParty := g.ThirdPartyImage(&ThirdPartyImage{Name: "nginx"})
+	custom := g.CustomImage(&CustomImage{Repository: "app"})
+	archive := g.ImageArchive(&ImageArchive{Name: "archived", Path: "archived.tar"})
+	images := g.Cluster(&DummyCluster{Name: "images"}, thirdParty, custom, archive)
+	other := g.Cluster(&DummyCluster{Name: "other"})
+	spec := g.ForSpec()
+	specArchive := spec.ImageArchive(&ImageArchive{Name: "spec-archived", Path: "spec-archived.tar"})
+	specCluster := spec.Cluster(&DummyCluster{Name: "spec"}, specArchive)
+
+	deps := ResourceDependencies{
+		Clusters: []ClusterID{images},
+		ImagesInClusters: []ImageInCluster{
+			{Cluster: images, Image: thirdParty},
+			{Cluster: images, Image: custom},
+			{Cluster: images, Image: archive},
+			{Cluster: specCluster, Image: specArchive},
+		},
+	}
+	expected := []string{
+		images.id,
+		g.clusterThirdPartyLoads[images.id][thirdParty.id],
+		g.clusterCustomLoads[images.id][custom.id],
+		g.clusterImageArchiveLoads[images.id][archive.id],
+		spec.clusterImageArchiveLoads[specCluster.id][specArchive.id],
+	}
+	if ids := deps.allIDs(spec.specState, other.id); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v, got %v", expected, ids)
+	}
+
+	// Images in the resource's own cluster are depended on directly
+	deps = ResourceDependencies{ImageArchives: []ImageArchiveID{archive}}
+	expected = []string{g.clusterImageArchiveLoads[images.id][archive.id]}
+	if ids := deps.allIDs(g.specState, images.id); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v, got %v", expected, ids)
+	}
+
+	for name, deps := range map[string]ResourceDependencies{
+		"not loaded":       {ImageArchives: []ImageArchiveID{archive}},
+		"not loaded there": {ImagesInClusters: []ImageInCluster{{Cluster: other, Image: archive}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if r, _ := recover().(string); !strings.Contains(r, "is not set to load to cluster") {
+					t.Errorf("expected a panic about the image not being loaded, got %v", r)
+				}
+			}()
+			deps.allIDs(g.specState, other.id)
+		})
+	}
+}
+
+func TestImageArchiveReference(t *testing.T) {
+	g := ForTest(t)
+	archive := g.ImageArchive(&ImageArchive{Name: "archived:1.0", Path: "archived.tar"})
+	cluster := g.Cluster(&DummyCluster{Name: "images"}, archive)
+	ref := ImageInCluster{Cluster: cluster, Image: archive}.imageReference(g.specState)
+	if ref != "archived:1.0" {
+		t.Errorf("expected the name of the archive, got %q", ref)
+	}
+}
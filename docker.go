@@ -27,7 +27,7 @@ func (d *DockerCommand) docker(ctx context.Context, args []string) *gosh.Cmd {
 		cmd = append(cmd, DefaultDockerCommand...)
 	}
 	cmd = append(cmd, args...)
-	return gosh.Command(cmd...).WithContext(ctx).WithStreams(GinkgoOutErr).WithLog(log)
+	return gosh.Command(cmd...).WithContext(ctx).WithStreams(outErrStreams(ctx)).WithLog(log)
 }
 
 func (d *DockerCommand) Docker(ctx context.Context, args ...string) *gosh.Cmd {
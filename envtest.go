@@ -8,8 +8,6 @@ import (
 
 	"github.com/meln5674/gosh"
 
-	. "github.com/onsi/ginkgo/v2"
-
 	configv1 "k8s.io/client-go/tools/clientcmd/api/v1"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	"sigs.k8s.io/yaml"
@@ -19,6 +17,8 @@ type EnvTestCluster struct {
 	Environment envtest.Environment
 	TempDir     string
 	Name        string
+	// Conditions control if this cluster is created
+	Conditions
 }
 
 var _ = Cluster(&EnvTestCluster{})
@@ -33,19 +33,19 @@ func (e *EnvTestCluster) Create(ctx context.Context, skipExisting bool) gosh.Com
 		e.Environment.ControlPlane.APIServer = &envtest.APIServer{}
 	}
 	if e.Environment.ControlPlane.APIServer.Out == nil {
-		e.Environment.ControlPlane.APIServer.Out = GinkgoWriter
+		e.Environment.ControlPlane.APIServer.Out = outWriter(ctx)
 	}
 	if e.Environment.ControlPlane.APIServer.Err == nil {
-		e.Environment.ControlPlane.APIServer.Err = GinkgoWriter
+		e.Environment.ControlPlane.APIServer.Err = errWriter(ctx)
 	}
 	if e.Environment.ControlPlane.Etcd == nil {
 		e.Environment.ControlPlane.Etcd = &envtest.Etcd{}
 	}
 	if e.Environment.ControlPlane.Etcd.Out == nil {
-		e.Environment.ControlPlane.Etcd.Out = GinkgoWriter
+		e.Environment.ControlPlane.Etcd.Out = outWriter(ctx)
 	}
 	if e.Environment.ControlPlane.Etcd.Err == nil {
-		e.Environment.ControlPlane.Etcd.Err = GinkgoWriter
+		e.Environment.ControlPlane.Etcd.Err = errWriter(ctx)
 	}
 
 	return gosh.FromFunc(ctx, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
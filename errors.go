@@ -0,0 +1,32 @@
+package gingk8s
+
+import "strings"
+
+// MultiError is a set of errors which occurred independently of each other
+type MultiError []error
+
+// Error implements error
+func (m MultiError) Error() string {
+	msgs := make([]string, len(m))
+	for ix, err := range m {
+		msgs[ix] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap allows errors.Is and errors.As to match any of the errors
+func (m MultiError) Unwrap() []error {
+	return m
+}
+
+// joinErrors returns nil if there are no errors, the error itself if there is only one, or a MultiError
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return MultiError(errs)
+	}
+}
@@ -0,0 +1,164 @@
+package gingk8s
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the type of an Event
+type EventType string
+
+const (
+	// NodeStarted is emitted when the setup of a node starts
+	NodeStarted EventType = "NodeStarted"
+	// NodeSucceeded is emitted when the setup of a node succeeds
+	NodeSucceeded EventType = "NodeSucceeded"
+	// NodeFailed is emitted when the setup of a node fails, and will not be retried
+	NodeFailed EventType = "NodeFailed"
+	// NodeSkipped is emitted when the setup of a node is skipped due to its Conditions or a selector
+	NodeSkipped EventType = "NodeSkipped"
+	// NodeUnchanged is emitted when the setup of a node is skipped because its fingerprint has not changed.
+	// See SuiteOpts.Incremental
+	NodeUnchanged EventType = "NodeUnchanged"
+	// NodeRetried is emitted when the setup of a node fails, and will be retried. See SuiteOpts.SetupRetries
+	NodeRetried EventType = "NodeRetried"
+	// CleanupStarted is emitted when the cleanup of a node starts
+	CleanupStarted EventType = "CleanupStarted"
+	// CleanupSucceeded is emitted when the cleanup of a node succeeds
+	CleanupSucceeded EventType = "CleanupSucceeded"
+	// CleanupFailed is emitted when the cleanup of a node fails
+	CleanupFailed EventType = "CleanupFailed"
+	// CleanupKept is emitted instead of CleanupStarted when a node is not cleaned up due to its CleanupPolicy,
+	// or SuiteOpts.NoSuiteCleanup or SuiteOpts.NoSpecCleanup
+	CleanupKept EventType = "CleanupKept"
+)
+
+// Event describes a change in the progress of a node, that is, a single step of Setup() or its cleanup
+type Event struct {
+	// Type is what happened
+	Type EventType
+	// NodeID is the ID of the node, as returned when registering it, e.g. a ReleaseID.
+	// Image loads are not registered directly, and have their own IDs.
+	NodeID string
+	// NodeKind is the kind of the node, one of Cluster, ThirdPartyImage, CustomImage, ImageArchive,
+	// ThirdPartyImageLoad, CustomImageLoad, ImageArchiveLoad, Release, ReleaseUpgradeStep, Manifests, or ClusterAction
+	NodeKind string
+	// Cluster is the name of the cluster the node is executed against, if any
+	Cluster string
+	// Title is the human-readable description of the node
+	Title string
+	// Time is when the event happened
+	Time time.Time
+	// Duration is how long the setup or cleanup took, for NodeSucceeded, NodeFailed, NodeRetried, CleanupSucceeded,
+	// and CleanupFailed events
+	Duration time.Duration
+	// Attempt is the number of the setup attempt, starting at 1, for node events
+	Attempt int
+	// Err is the error that caused a NodeFailed, NodeRetried, or CleanupFailed event
+	Err error
+}
+
+// EventHandler receives Events. Handlers are called one at a time, in the order events occur.
+// They may call Subscribe or unsubscribe, which takes effect from the next event.
+type EventHandler func(Event)
+
+type eventSubscribers struct {
+	// emitLock is held while calling handlers, so that they are called one at a time
+	emitLock sync.Mutex
+	lock     sync.Mutex
+	next     int
+	handlers map[int]EventHandler
+}
+
+// Subscribe registers a handler to be called with events for the setup and cleanup of every node in the suite,
+// including those of specs. The returned function removes the handler.
+func (g Gingk8s) Subscribe(handler EventHandler) (unsubscribe func()) {
+	subs := &g.suite.subscribers
+	subs.lock.Lock()
+	defer subs.lock.Unlock()
+	if subs.handlers == nil {
+		subs.handlers = make(map[int]EventHandler)
+	}
+	id := subs.next
+	subs.next++
+	subs.handlers[id] = handler
+	return func() {
+		subs.lock.Lock()
+		defer subs.lock.Unlock()
+		delete(subs.handlers, id)
+	}
+}
+
+// emit calls each subscribed handler with an event, in the order they subscribed.
+// The handlers are called without holding the subscribers lock, so that they may subscribe or unsubscribe.
+func (s *suiteState) emit(event Event) {
+	s.subscribers.emitLock.Lock()
+	defer s.subscribers.emitLock.Unlock()
+	s.subscribers.lock.Lock()
+	handlers := make([]func(Event), 0, len(s.subscribers.handlers))
+	for id := 0; id < s.subscribers.next; id++ {
+		handler, ok := s.subscribers.handlers[id]
+		if !ok {
+			continue
+		}
+		handlers = append(handlers, handler)
+	}
+	s.subscribers.lock.Unlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// event returns a new event for this node
+func (s *specNode) event(eventType EventType) Event {
+	event := Event{
+		Type:   eventType,
+		NodeID: s.id,
+		Title:  s.Title(s.state),
+		Time:   time.Now(),
+	}
+	var clusterID string
+	event.NodeKind, clusterID = s.kindAndClusterID()
+	if cluster := s.state.getCluster(clusterID); cluster != nil {
+		event.Cluster = cluster.GetName()
+	}
+	return event
+}
+
+// kindAndClusterID returns the kind of this node, and the ID of the cluster it is executed against, if any.
+// For clusters, this is their own ID.
+func (s *specNode) kindAndClusterID() (kind string, clusterID string) {
+	switch action := s.specAction.(type) {
+	case *createClusterAction:
+		return "Cluster", action.id
+	case *pullThirdPartyImageAction:
+		return "ThirdPartyImage", ""
+	case *buildCustomImageAction:
+		return "CustomImage", ""
+	case *pullImageArchiveAction:
+		return "ImageArchive", ""
+	case *loadThirdPartyImageAction:
+		return "ThirdPartyImageLoad", action.clusterID
+	case *loadCustomImageAction:
+		return "CustomImageLoad", action.clusterID
+	case *loadImageArchiveAction:
+		return "ImageArchiveLoad", action.clusterID
+	case *releaseAction:
+		return "Release", action.clusterID
+	case *releaseUpgradeStepAction:
+		return "ReleaseUpgradeStep", action.clusterID
+	case *manifestsAction:
+		return "Manifests", action.clusterID
+	case *clusterActionAction:
+		return "ClusterAction", action.clusterID
+	}
+	return "", ""
+}
+
+// emit emits an event for this node, unless it is a placeholder for a node of a parent spec
+func (s *specNode) emit(event Event) {
+	if _, ok := s.specAction.(*specNoop); ok {
+		return
+	}
+	s.state.suite.emit(event)
+}
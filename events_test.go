@@ -0,0 +1,186 @@
+package gingk8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// manualHarness is a TestingHarness whose cleanup is run by calling cleanup() instead of at the end of the test,
+// and which records failures instead of failing the test, so that both can be checked
+type manualHarness struct {
+	TestingHarness
+	lock     sync.Mutex
+	cleanups []func(context.Context)
+	failures []error
+	failed   bool
+}
+
+func newManualHarness(t *testing.T) *manualHarness {
+	return &manualHarness{TestingHarness: TestingHarness{T: t}}
+}
+
+func (h *manualHarness) DeferCleanup(f func(context.Context)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.cleanups = append(h.cleanups, f)
+}
+
+func (h *manualHarness) Failed() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.failed || len(h.failures) != 0
+}
+
+func (h *manualHarness) Fail(err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.failures = append(h.failures, err)
+}
+
+// cleanup calls the deferred cleanup functions in reverse order, like testing.T.Cleanup
+func (h *manualHarness) cleanup() {
+	h.lock.Lock()
+	cleanups := h.cleanups
+	h.cleanups = nil
+	h.lock.Unlock()
+	for ix := len(cleanups) - 1; ix >= 0; ix-- {
+		cleanups[ix](context.Background())
+	}
+}
+
+// eventRecorder records the events of a suite, formatted as "<type> <title> <attempt>"
+type eventRecorder struct {
+	lock   sync.Mutex
+	events []string
+	errs   []error
+}
+
+func (r *eventRecorder) handle(event Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, fmt.Sprintf("%s %s %d", event.Type, event.Title, event.Attempt))
+	if event.Err != nil {
+		r.errs = append(r.errs, event.Err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	h := newManualHarness(t)
+	g := New(h)
+	g.Options(SuiteOpts{SetupRetries: 1})
+	r := &eventRecorder{}
+	g.Subscribe(r.handle)
+
+	errFlaky := errors.New("flaky")
+	errCleanup := errors.New("cleanup")
+	cluster := g.Cluster(testCluster(t))
+	attempts := 0
+	flaky := g.ClusterAction(cluster, "flaky", ClusterAction(func(Gingk8s, context.Context, Cluster) error {
+		attempts++
+		if attempts == 1 {
+			return errFlaky
+		}
+		return nil
+	}))
+	skipped := g.ClusterAction(cluster, "skipped", &ConditionalClusterAction{
+		ClusterActionable: ClusterAction(func(Gingk8s, context.Context, Cluster) error { return nil }),
+		Conditions:        Conditions{If: func(context.Context) bool { return false }},
+	}, flaky)
+	kept := g.ClusterAction(cluster, "kept", &ConditionalClusterAction{
+		ClusterActionable: ClusterAction(func(Gingk8s, context.Context, Cluster) error { return nil }),
+		Conditions:        Conditions{CleanupPolicy: CleanupNever},
+	}, skipped)
+	g.ClusterAction(cluster, "broken", ClusterCleanupAction(func(Gingk8s, context.Context, Cluster) error {
+		return errCleanup
+	}), kept)
+
+	err := g.TrySetup(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.cleanup()
+
+	expected := []string{
+		"NodeStarted Create cluster test 1",
+		"NodeSucceeded Create cluster test 1",
+		"NodeStarted Execute action flaky in cluster test 1",
+		"NodeRetried Execute action flaky in cluster test 1",
+		"NodeStarted Execute action flaky in cluster test 2",
+		"NodeSucceeded Execute action flaky in cluster test 2",
+		"NodeSkipped Execute action skipped in cluster test 0",
+		"NodeStarted Execute action kept in cluster test 1",
+		"NodeSucceeded Execute action kept in cluster test 1",
+		"NodeStarted Execute action broken in cluster test 1",
+		"NodeSucceeded Execute action broken in cluster test 1",
+		"CleanupStarted Execute action broken in cluster test 0",
+		"CleanupFailed Execute action broken in cluster test 0",
+		"CleanupKept Execute action kept in cluster test 0",
+		"CleanupStarted Execute action flaky in cluster test 0",
+		"CleanupSucceeded Execute action flaky in cluster test 0",
+		"CleanupStarted Create cluster test 0",
+		"CleanupSucceeded Create cluster test 0",
+	}
+	if strings.Join(r.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected events:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(r.events, "\n"))
+	}
+	if len(r.errs) != 2 || !errors.Is(r.errs[0], errFlaky) || !errors.Is(r.errs[1], errCleanup) {
+		t.Errorf("expected the retried and cleanup errors, got %v", r.errs)
+	}
+	if len(h.failures) != 1 || !errors.Is(h.failures[0], errCleanup) {
+		t.Errorf("expected the cleanup error to fail the suite, got %v", h.failures)
+	}
+}
+
+func TestEventFields(t *testing.T) {
+	h := newManualHarness(t)
+	g := New(h)
+	var events []Event
+	g.Subscribe(func(event Event) { events = append(events, event) })
+	cluster := g.Cluster(testCluster(t))
+	spec := g.ForSpec()
+	action := spec.ClusterAction(cluster, "action", ClusterAction(func(Gingk8s, context.Context, Cluster) error { return nil }))
+	if err := spec.TrySetup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	h.cleanup()
+	// The cluster belongs to the suite, which was not set up, so only the spec's own node has events
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %#v", events)
+	}
+	for _, event := range events {
+		if event.NodeID != action.id || event.NodeKind != "ClusterAction" || event.Cluster != "test" || event.Time.IsZero() {
+			t.Errorf("unexpected event %#v", event)
+		}
+	}
+	if events[1].Type != NodeSucceeded || events[1].Duration != events[1].Time.Sub(events[0].Time) {
+		t.Errorf("expected the duration of the setup, got %#v", events[1])
+	}
+	if events[3].Type != CleanupSucceeded || events[3].Duration != events[3].Time.Sub(events[2].Time) {
+		t.Errorf("expected the duration of the cleanup, got %#v", events[3])
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	g := ForTest(t)
+	calls := []string{}
+	var unsubscribeSecond func()
+	g.Subscribe(func(Event) { calls = append(calls, "first") })
+	unsubscribeSecond = g.Subscribe(func(Event) {
+		calls = append(calls, "second")
+		// Handlers may unsubscribe, including themselves, without deadlocking
+		unsubscribeSecond()
+		g.Subscribe(func(Event) { calls = append(calls, "third") })
+	})
+
+	g.suite.emit(Event{Type: NodeStarted})
+	g.suite.emit(Event{Type: NodeSucceeded})
+
+	expected := "first,second,first,third"
+	if strings.Join(calls, ",") != expected {
+		t.Errorf("expected calls %s, got %s", expected, strings.Join(calls, ","))
+	}
+}
@@ -0,0 +1,286 @@
+package gingk8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/meln5674/gosh"
+)
+
+const (
+	// fingerprintGroup is the ClusterTempPath group that fingerprints are stored in
+	fingerprintGroup = "fingerprints"
+	// clusterIdentityFile is the file in fingerprintGroup that the identity of the cluster the fingerprints were recorded
+	// against is stored in
+	clusterIdentityFile = "cluster-identity"
+)
+
+// fingerprintedAction is a specAction whose inputs can be summarized to determine if it needs to be re-executed
+type fingerprintedAction interface {
+	// Fingerprint writes a summary of all of the inputs to this action.
+	// If the output does not change, this action will not be re-executed.
+	Fingerprint(ctx context.Context, state *specState, w io.Writer) error
+	// FingerprintClusterID returns the cluster this action targets, or the empty string if it does not target a cluster,
+	// in which case its fingerprint is stored in all clusters
+	FingerprintClusterID() string
+	// FingerprintName returns the namespace, if any, and name of the resource this action sets up,
+	// which identify it between runs, unlike its node ID
+	FingerprintName(state *specState) (namespace, name string)
+}
+
+// fingerprintFields writes a set of values to a fingerprint, using a separator that cannot occur in the %q-formatted values
+func fingerprintFields(w io.Writer, fields ...interface{}) error {
+	for _, field := range fields {
+		_, err := fmt.Fprintf(w, "%q\n", fmt.Sprintf("%v", field))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fingerprintStringMap writes the keys and values of a map to a fingerprint in a consistent order
+func fingerprintStringMap(w io.Writer, m map[string]string) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		err := fingerprintFields(w, k, m[k])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fingerprintFile writes the path and contents of a file to a fingerprint
+func fingerprintFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = fingerprintFields(w, path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// fingerprintPath writes the paths and contents of a file or all files within a directory to a fingerprint.
+// If recursive is false, subdirectories are ignored.
+func fingerprintPath(w io.Writer, root string, recursive bool) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fingerprintFile(w, root)
+	}
+	paths := []string{}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		err = fingerprintFile(w, path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fingerprintKey returns the filename to store a node's fingerprint under.
+// Node IDs are random, so the kind of the node, its cluster, and the namespace and name of its resource are used instead.
+func (s *specNode) fingerprintKey(action fingerprintedAction) string {
+	kind, clusterID := s.kindAndClusterID()
+	var clusterName string
+	if cluster := s.state.getCluster(clusterID); cluster != nil {
+		clusterName = cluster.GetName()
+	}
+	namespace, name := action.FingerprintName(s.state)
+	h := sha256.New()
+	// Writing to a hash never fails
+	_ = fingerprintFields(h, kind, clusterName, namespace, name)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fingerprintPaths returns the files to store a node's fingerprint in
+func (s *specNode) fingerprintPaths(action fingerprintedAction) []string {
+	key := s.fingerprintKey(action)
+	clusterID := action.FingerprintClusterID()
+	if clusterID != "" {
+		return []string{ClusterTempPath(s.state.getCluster(clusterID), fingerprintGroup, key)}
+	}
+	paths := []string{}
+	for _, cluster := range s.state.allClusters() {
+		paths = append(paths, ClusterTempPath(cluster, fingerprintGroup, key))
+	}
+	return paths
+}
+
+// computeFingerprint computes the fingerprint of a node, which includes the fingerprints of its dependencies,
+// so that if any dependency changes, so does this node
+func (s *specNode) computeFingerprint(ctx context.Context) (string, error) {
+	h := sha256.New()
+	action, ok := s.specAction.(fingerprintedAction)
+	if ok {
+		err := action.Fingerprint(ctx, s.state, h)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		err := fingerprintFields(h, s.Title(s.state))
+		if err != nil {
+			return "", err
+		}
+	}
+	deps := make([]string, 0, len(s.dependsOn))
+	for _, dep := range s.dependsOn {
+		deps = append(deps, s.state.nodeFingerprint(dep))
+	}
+	sort.Strings(deps)
+	err := fingerprintFields(h, strings.Join(deps, ","))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// unchanged returns true if a node's fingerprint matches the fingerprint from the last time it was executed
+func (s *specNode) unchanged() (bool, error) {
+	action, ok := s.specAction.(fingerprintedAction)
+	if !ok {
+		return false, nil
+	}
+	paths := s.fingerprintPaths(action)
+	if len(paths) == 0 {
+		return false, nil
+	}
+	for _, path := range paths {
+		previous, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if string(previous) != s.fingerprint {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// saveFingerprint records a node's fingerprint after it has been successfully executed
+func (s *specNode) saveFingerprint() error {
+	action, ok := s.specAction.(fingerprintedAction)
+	if !ok {
+		return nil
+	}
+	for _, path := range s.fingerprintPaths(action) {
+		err := os.MkdirAll(filepath.Dir(path), 0700)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(path, []byte(s.fingerprint), 0600)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nodeFingerprint returns the fingerprint of a node in this spec or any parent spec
+func (s *specState) nodeFingerprint(id string) string {
+	for _, node := range s.setup {
+		if node.id == id {
+			return node.fingerprint
+		}
+	}
+	if s.parent != nil {
+		return s.parent.nodeFingerprint(id)
+	}
+	return ""
+}
+
+// allClusters returns all clusters in this spec and any parent spec
+func (s *specState) allClusters() map[string]Cluster {
+	clusters := map[string]Cluster{}
+	if s.parent != nil {
+		clusters = s.parent.allClusters()
+	}
+	for id, cluster := range s.clusters {
+		clusters[id] = cluster
+	}
+	return clusters
+}
+
+// clusterIdentity returns a value which is unique to each instance of a cluster, even if it has the same name as a previous one
+func clusterIdentity(ctx context.Context, state *specState, cluster Cluster) (string, error) {
+	identity := strings.Builder{}
+	err := Gingk8s{specState: state}.
+		Kubectl(ctx, cluster, "get", "namespace", "kube-system", "--output", "jsonpath={.metadata.uid}").
+		WithStreams(gosh.WriterOut(&identity)).
+		Run()
+	if err != nil {
+		return "", err
+	}
+	return identity.String(), nil
+}
+
+// checkClusterIdentity discards the fingerprints stored for a cluster if they were recorded against a different instance of it,
+// such as one that was deleted outside of gingk8s and then recreated, as nothing they describe exists in the new one.
+// If the identity of the cluster cannot be determined, the fingerprints are always discarded.
+func checkClusterIdentity(ctx context.Context, state *specState, cluster Cluster) error {
+	dir := ClusterTempPath(cluster, fingerprintGroup)
+	path := filepath.Join(dir, clusterIdentityFile)
+	identity, err := clusterIdentity(ctx, state, cluster)
+	if err == nil && identity != "" {
+		previous, err := os.ReadFile(path)
+		if err == nil && string(previous) == identity {
+			return nil
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+	if identity == "" {
+		return nil
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(identity), 0600)
+}
@@ -0,0 +1,207 @@
+package gingk8s
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for path, contents := range files {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFingerprintPath(t *testing.T) {
+	base := map[string]string{
+		"a.yaml":     "a",
+		"b.yaml":     "b",
+		"sub/c.yaml": "c",
+	}
+	cases := []struct {
+		name      string
+		recursive bool
+		changes   map[string]string
+		changed   bool
+	}{
+		{name: "no changes", changed: false},
+		{name: "top-level file changed", changes: map[string]string{"a.yaml": "a2"}, changed: true},
+		{name: "top-level file added", changes: map[string]string{"d.yaml": "d"}, changed: true},
+		{name: "subdirectory ignored", changes: map[string]string{"sub/c.yaml": "c2"}, changed: false},
+		{name: "subdirectory recursive", recursive: true, changes: map[string]string{"sub/c.yaml": "c2"}, changed: true},
+		{name: "contents moved between files", changes: map[string]string{"a.yaml": "ab", "b.yaml": ""}, changed: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, base)
+			before := strings.Builder{}
+			if err := fingerprintPath(&before, root, tc.recursive); err != nil {
+				t.Fatal(err)
+			}
+			writeFiles(t, root, tc.changes)
+			after := strings.Builder{}
+			if err := fingerprintPath(&after, root, tc.recursive); err != nil {
+				t.Fatal(err)
+			}
+			if changed := before.String() != after.String(); changed != tc.changed {
+				t.Errorf("expected changed=%v, got %v", tc.changed, changed)
+			}
+		})
+	}
+}
+
+func TestFingerprintPathFile(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"a.yaml": "a"})
+	out := strings.Builder{}
+	if err := fingerprintPath(&out, filepath.Join(root, "a.yaml"), false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out.String(), "a") {
+		t.Errorf("expected fingerprint to include file contents, got %q", out.String())
+	}
+	if err := fingerprintPath(&out, filepath.Join(root, "missing.yaml"), false); err == nil {
+		t.Error("expected an error for a missing path")
+	}
+}
+
+func TestUnchanged(t *testing.T) {
+	cases := []struct {
+		name string
+		// saved is the fingerprint saved before checking, or empty to save none
+		saved string
+		// clearCluster, if true, removes the fingerprints of the cluster, as if it were deleted
+		clearCluster bool
+		unchanged    bool
+	}{
+		{name: "never executed", unchanged: false},
+		{name: "same fingerprint", saved: "current", unchanged: true},
+		{name: "different fingerprint", saved: "previous", unchanged: false},
+		{name: "cluster deleted", saved: "current", clearCluster: true, unchanged: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := ForTest(t)
+			g.Options(SuiteOpts{Incremental: true})
+			cluster := &DummyCluster{Name: "cluster", TempDir: t.TempDir()}
+			clusterID := g.Cluster(cluster)
+			g.Manifests(clusterID, &KubernetesManifests{Name: "manifests"})
+			node := g.setup[len(g.setup)-1]
+			if _, ok := node.specAction.(*manifestsAction); !ok {
+				t.Fatalf("expected the last node to be the manifests, got %T", node.specAction)
+			}
+			if tc.saved != "" {
+				node.fingerprint = tc.saved
+				if err := node.saveFingerprint(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tc.clearCluster {
+				cleanup := &createClusterAction{id: clusterID.id}
+				if err := cleanup.Cleanup(context.Background(), g.specState); err != nil {
+					t.Fatal(err)
+				}
+			}
+			node.fingerprint = "current"
+			unchanged, err := node.unchanged()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if unchanged != tc.unchanged {
+				t.Errorf("expected unchanged=%v, got %v", tc.unchanged, unchanged)
+			}
+		})
+	}
+}
+
+func TestFingerprintKey(t *testing.T) {
+	// key registers a set of manifests or a release in a new suite, and returns the fingerprint key of its node
+	key := func(t *testing.T, clusterName string, kind string, namespace, name string) string {
+		g := ForTest(t)
+		cluster := g.Cluster(&DummyCluster{Name: clusterName})
+		switch kind {
+		case "Manifests":
+			g.Manifests(cluster, &KubernetesManifests{Namespace: namespace, Name: name})
+		case "Release":
+			g.Release(cluster, &HelmRelease{Namespace: namespace, Name: name})
+		}
+		node := g.setup[len(g.setup)-1]
+		return node.fingerprintKey(node.specAction.(fingerprintedAction))
+	}
+	base := key(t, "cluster", "Manifests", "ns", "name")
+	if key(t, "cluster", "Manifests", "ns", "name") != base {
+		t.Error("expected the same key for the same resource in a different run")
+	}
+	cases := []struct {
+		name                                   string
+		clusterName, kind, namespace, resource string
+	}{
+		{name: "different namespace", clusterName: "cluster", kind: "Manifests", namespace: "other", resource: "name"},
+		{name: "different name", clusterName: "cluster", kind: "Manifests", namespace: "ns", resource: "other"},
+		{name: "different cluster", clusterName: "other", kind: "Manifests", namespace: "ns", resource: "name"},
+		{name: "different kind", clusterName: "cluster", kind: "Release", namespace: "ns", resource: "name"},
+		{name: "fields not concatenated", clusterName: "cluster", kind: "Manifests", namespace: "nsn", resource: "ame"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if key(t, tc.clusterName, tc.kind, tc.namespace, tc.resource) == base {
+				t.Error("expected a different key")
+			}
+		})
+	}
+}
+
+func TestClusterCleanupFingerprints(t *testing.T) {
+	cases := []struct {
+		name        string
+		incremental bool
+		noTempDir   bool
+		removed     bool
+	}{
+		{name: "incremental", incremental: true, removed: true},
+		{name: "not incremental", incremental: false, removed: false},
+		{name: "no temp dir", incremental: true, noTempDir: true, removed: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cluster := &DummyCluster{Name: "cluster", TempDir: dir}
+			if tc.noTempDir {
+				// Without a temp dir, the fingerprints would be relative to the working directory
+				wd, err := os.Getwd()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chdir(dir); err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { os.Chdir(wd) })
+				cluster.TempDir = ""
+			}
+			writeFiles(t, dir, map[string]string{filepath.Join(fingerprintGroup, "key"): "fingerprint"})
+
+			g := ForTest(t)
+			g.Options(SuiteOpts{Incremental: tc.incremental})
+			clusterID := g.Cluster(cluster)
+			cleanup := &createClusterAction{id: clusterID.id}
+			if err := cleanup.Cleanup(context.Background(), g.specState); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := os.Stat(filepath.Join(dir, fingerprintGroup, "key"))
+			if removed := os.IsNotExist(err); removed != tc.removed {
+				t.Errorf("expected removed=%v, got %v (%v)", tc.removed, removed, err)
+			}
+		})
+	}
+}
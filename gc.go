@@ -0,0 +1,359 @@
+package gingk8s
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/meln5674/gosh"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// RunIDLabel is the label set on kind cluster nodes, namespaces, and helm release secrets created by gingk8s
+	// to identify the run which created them
+	RunIDLabel = "gingk8s.meln5674.io/run-id"
+	// CreatedLabel is the label holding the unix timestamp a resource was created at
+	CreatedLabel = "gingk8s.meln5674.io/created"
+	// HostLabel is the label holding the (sanitized) hostname of the machine which created a resource
+	HostLabel = "gingk8s.meln5674.io/host"
+	// PIDLabel is the label holding the process ID which created a resource
+	PIDLabel = "gingk8s.meln5674.io/pid"
+
+	// RunIDEnv is the environment variable used to override the run ID, e.g. to set it to a CI job ID
+	RunIDEnv = "GINGK8S_RUN_ID"
+)
+
+var (
+	runID = os.Getenv(RunIDEnv)
+
+	invalidLabelChars = regexp.MustCompile("[^A-Za-z0-9_.-]+")
+)
+
+func init() {
+	if runID == "" {
+		runID = uuid.NewString()
+	}
+}
+
+// RunID returns the ID which is used to label the resources created by this process.
+// It is random unless GINGK8S_RUN_ID is set.
+func RunID() string {
+	return runID
+}
+
+func labelValue(value string) string {
+	value = invalidLabelChars.ReplaceAllString(value, "-")
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	return strings.Trim(value, "-_.")
+}
+
+// OwnerLabels returns the labels that identify a resource as being created by this process now
+func OwnerLabels() map[string]string {
+	host, _ := os.Hostname()
+	return map[string]string{
+		RunIDLabel:   labelValue(runID),
+		CreatedLabel: strconv.FormatInt(time.Now().Unix(), 10),
+		HostLabel:    labelValue(host),
+		PIDLabel:     strconv.Itoa(os.Getpid()),
+	}
+}
+
+func ownerLabelArgs() []string {
+	labels := OwnerLabels()
+	args := []string{}
+	for _, k := range sortedKeys(labels) {
+		args = append(args, k+"="+labels[k])
+	}
+	return args
+}
+
+// labelOwned labels a resource with OwnerLabels(). Failing to do so is logged, but not treated as an error,
+// as the resource itself was still created successfully.
+func labelOwned(ctx context.Context, kubectl Kubectl, cluster Cluster, args ...string) gosh.Commander {
+	allArgs := append([]string{"label", "--overwrite"}, args...)
+	allArgs = append(allArgs, ownerLabelArgs()...)
+	return gosh.Or(
+		kubectl.Kubectl(ctx, cluster, allArgs),
+		gosh.FromFunc(ctx, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
+			log.Info("Failed to label resource as owned by gingk8s, it will not be garbage collected", "cluster", cluster.GetName(), "args", args)
+			close(done)
+			return nil
+		}),
+	)
+}
+
+// GarbageCollectOpts controls which leaked resources are deleted by GarbageCollect
+type GarbageCollectOpts struct {
+	// MaxAge, if non-zero, causes resources created longer ago than it to be deleted
+	MaxAge time.Duration
+	// DeadRuns causes resources created by a process on this host which is no longer running to be deleted,
+	// unless that process deliberately kept resources, e.g. due to NoSuiteCleanup or a CleanupPolicy
+	DeadRuns bool
+	// Kind, if set, is used to find kind clusters to garbage collect. If not set, DefaultKind is used.
+	Kind *KindCommand
+	// NoKind disables garbage collecting kind clusters
+	NoKind bool
+	// DryRun causes leaked resources to be found but not deleted
+	DryRun bool
+}
+
+// LeakedResource is a resource found by GarbageCollect
+type LeakedResource struct {
+	// Kind is the kind of resource, one of KindCluster, Namespace, or HelmRelease
+	Kind string
+	// Cluster is the name of the cluster the resource is in, or the name of the cluster itself
+	Cluster string
+	// Namespace is the namespace of a HelmRelease
+	Namespace string
+	// Name is the name of the resource
+	Name string
+	// RunID is the run that created the resource
+	RunID string
+	// Created is when the resource was created
+	Created time.Time
+}
+
+type ownedObjectList struct {
+	Items []struct {
+		metav1.ObjectMeta `json:"metadata"`
+	} `json:"items"`
+}
+
+// leaked returns true if a resource with the given owner labels should be garbage collected
+func (o *GarbageCollectOpts) leaked(labels map[string]string, now time.Time) (leaked bool, created time.Time) {
+	runID, ok := labels[RunIDLabel]
+	if !ok || runID == labelValue(RunID()) {
+		return false, created
+	}
+	createdUnix, err := strconv.ParseInt(labels[CreatedLabel], 10, 64)
+	if err == nil {
+		created = time.Unix(createdUnix, 0)
+		if o.MaxAge != 0 && now.Sub(created) > o.MaxAge {
+			return true, created
+		}
+	}
+	if !o.DeadRuns {
+		return false, created
+	}
+	host, _ := os.Hostname()
+	if labels[HostLabel] != labelValue(host) {
+		return false, created
+	}
+	pid, err := strconv.Atoi(labels[PIDLabel])
+	if err != nil {
+		return false, created
+	}
+	if processAlive(pid) {
+		return false, created
+	}
+	_, err = os.Stat(keptRunPath(runID))
+	return err != nil, created
+}
+
+// keptRunPath is the path to a file which marks that a run deliberately kept resources
+func keptRunPath(runID string) string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	return filepath.Join(cacheDir, "gingk8s", "kept-runs", runID)
+}
+
+// markRunKept records that the current run deliberately kept resources, so that they are not garbage collected
+// as belonging to a dead run
+func markRunKept() error {
+	path := keptRunPath(labelValue(RunID()))
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(time.Now().Format(time.RFC3339)), 0600)
+}
+
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// GarbageCollect finds and deletes resources created by other gingk8s runs which have leaked, e.g. because
+// their process was killed before it could clean up. Namespaces and helm releases are searched for in every cluster
+// registered with this Gingk8s, which must already exist, and kind clusters are searched for using the kind command.
+// Only resources labeled with RunIDLabel are considered, and those from the current run are never deleted.
+func (g Gingk8s) GarbageCollect(ctx context.Context, opts GarbageCollectOpts) ([]LeakedResource, error) {
+	g.setDefaults()
+	ctx = g.context(ctx)
+	now := time.Now()
+	leaked := []LeakedResource{}
+	var errs []error
+
+	if !opts.NoKind {
+		clusters, err := g.leakedKindClusters(ctx, &opts, now)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		leaked = append(leaked, clusters...)
+	}
+
+	for _, id := range sortedKeys(g.allClusters()) {
+		cluster := g.getCluster(id)
+		resources, err := g.leakedClusterResources(ctx, &opts, cluster, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cluster %s: %w", cluster.GetName(), err))
+		}
+		leaked = append(leaked, resources...)
+	}
+
+	return leaked, joinErrors(errs)
+}
+
+func (g Gingk8s) leakedClusterResources(ctx context.Context, opts *GarbageCollectOpts, cluster Cluster, now time.Time) ([]LeakedResource, error) {
+	leaked := []LeakedResource{}
+
+	var releaseSecrets ownedObjectList
+	err := g.suite.opts.Kubectl.Kubectl(ctx, cluster, []string{"get", "secrets", "--all-namespaces", "-l", "owner=helm," + RunIDLabel, "-o", "json"}).
+		WithStreams(gosh.FuncOut(gosh.SaveJSON(&releaseSecrets)), errStream(ctx)).
+		Run()
+	if err != nil {
+		return nil, err
+	}
+	releases := map[string]LeakedResource{}
+	for _, secret := range releaseSecrets.Items {
+		isLeaked, created := opts.leaked(secret.Labels, now)
+		if !isLeaked {
+			continue
+		}
+		release := LeakedResource{
+			Kind:      "HelmRelease",
+			Cluster:   cluster.GetName(),
+			Namespace: secret.Namespace,
+			Name:      secret.Labels["name"],
+			RunID:     secret.Labels[RunIDLabel],
+			Created:   created,
+		}
+		releases[release.Namespace+"/"+release.Name] = release
+	}
+	for _, key := range sortedKeys(releases) {
+		release := releases[key]
+		if !opts.DryRun {
+			err := g.suite.opts.Helm.Delete(ctx, cluster, &HelmRelease{Name: release.Name, Namespace: release.Namespace}, true).Run()
+			if err != nil {
+				return leaked, err
+			}
+		}
+		leaked = append(leaked, release)
+	}
+
+	var namespaces ownedObjectList
+	err = g.suite.opts.Kubectl.Kubectl(ctx, cluster, []string{"get", "namespaces", "-l", RunIDLabel, "-o", "json"}).
+		WithStreams(gosh.FuncOut(gosh.SaveJSON(&namespaces)), errStream(ctx)).
+		Run()
+	if err != nil {
+		return leaked, err
+	}
+	for _, namespace := range namespaces.Items {
+		isLeaked, created := opts.leaked(namespace.Labels, now)
+		if !isLeaked {
+			continue
+		}
+		if !opts.DryRun {
+			err := g.Kubectl(ctx, cluster, "delete", "namespace", namespace.Name, "--wait=false").Run()
+			if err != nil {
+				return leaked, err
+			}
+		}
+		leaked = append(leaked, LeakedResource{
+			Kind:    "Namespace",
+			Cluster: cluster.GetName(),
+			Name:    namespace.Name,
+			RunID:   namespace.Labels[RunIDLabel],
+			Created: created,
+		})
+	}
+	return leaked, nil
+}
+
+func (g Gingk8s) leakedKindClusters(ctx context.Context, opts *GarbageCollectOpts, now time.Time) ([]LeakedResource, error) {
+	kind := opts.Kind
+	if kind == nil {
+		kind = DefaultKind
+	}
+	var clusterNames bytes.Buffer
+	err := kind.kind(ctx, []string{"get", "clusters"}).WithStreams(gosh.WriterOut(&clusterNames), errStream(ctx)).Run()
+	if err != nil {
+		return nil, err
+	}
+	tempDir, err := os.MkdirTemp("", "gingk8s-gc-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	leaked := []LeakedResource{}
+	lines := bufio.NewScanner(&clusterNames)
+	for lines.Scan() {
+		name := strings.TrimSpace(lines.Text())
+		if name == "" {
+			continue
+		}
+		cluster := &DummyCluster{
+			Name:       name,
+			Connection: KubernetesConnection{Kubeconfig: filepath.Join(tempDir, name)},
+		}
+		kubeconfig, err := os.Create(cluster.Connection.Kubeconfig)
+		if err != nil {
+			return leaked, err
+		}
+		err = kind.kind(ctx, []string{"get", "kubeconfig", "--name", name}).WithStreams(gosh.WriterOut(kubeconfig), errStream(ctx)).Run()
+		kubeconfig.Close()
+		if err != nil {
+			return leaked, err
+		}
+		var nodes ownedObjectList
+		err = g.suite.opts.Kubectl.Kubectl(ctx, cluster, []string{"get", "nodes", "-l", RunIDLabel, "-o", "json"}).
+			WithStreams(gosh.FuncOut(gosh.SaveJSON(&nodes)), errStream(ctx)).
+			Run()
+		if err != nil {
+			log.Info("Could not list nodes of kind cluster, it may be unhealthy, not garbage collecting it", "cluster", name, "error", err)
+			continue
+		}
+		if len(nodes.Items) == 0 {
+			continue
+		}
+		isLeaked, created := opts.leaked(nodes.Items[0].Labels, now)
+		if !isLeaked {
+			continue
+		}
+		if !opts.DryRun {
+			err = (&KindCluster{KindCommand: kind, Name: name}).Delete(ctx).Run()
+			if err != nil {
+				return leaked, err
+			}
+		}
+		leaked = append(leaked, LeakedResource{
+			Kind:    "KindCluster",
+			Cluster: name,
+			Name:    name,
+			RunID:   nodes.Items[0].Labels[RunIDLabel],
+			Created: created,
+		})
+	}
+	return leaked, lines.Err()
+}
@@ -0,0 +1,170 @@
+package gingk8s
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLabelValue(t *testing.T) {
+	cases := []struct {
+		value, label string
+	}{
+		{value: "abc-123", label: "abc-123"},
+		{value: "my host.example.com", label: "my-host.example.com"},
+		{value: "user@host:8080", label: "user-host-8080"},
+		{value: "-leading and trailing_", label: "leading-and-trailing"},
+		{value: strings.Repeat("a", 70), label: strings.Repeat("a", 63)},
+		{value: strings.Repeat("a", 62) + "-b", label: strings.Repeat("a", 62)},
+		{value: "", label: ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.value, func(t *testing.T) {
+			if label := labelValue(tc.value); label != tc.label {
+				t.Errorf("expected %q, got %q", tc.label, label)
+			}
+		})
+	}
+}
+
+func TestOwnerLabels(t *testing.T) {
+	before := time.Now().Unix()
+	labels := OwnerLabels()
+	if labels[RunIDLabel] != labelValue(RunID()) {
+		t.Errorf("expected run ID %s, got %s", labelValue(RunID()), labels[RunIDLabel])
+	}
+	if labels[PIDLabel] != strconv.Itoa(os.Getpid()) {
+		t.Errorf("expected PID %d, got %s", os.Getpid(), labels[PIDLabel])
+	}
+	host, _ := os.Hostname()
+	if labels[HostLabel] != labelValue(host) {
+		t.Errorf("expected host %s, got %s", labelValue(host), labels[HostLabel])
+	}
+	created, err := strconv.ParseInt(labels[CreatedLabel], 10, 64)
+	if err != nil || created < before || created > time.Now().Unix() {
+		t.Errorf("expected the current time, got %s", labels[CreatedLabel])
+	}
+
+	args := ownerLabelArgs()
+	if len(args) != 4 || !strings.HasPrefix(args[0], CreatedLabel+"=") || !strings.HasPrefix(args[3], RunIDLabel+"=") {
+		t.Errorf("expected the labels as sorted arguments, got %v", args)
+	}
+}
+
+// deadPID returns the PID of a process which has exited
+func deadPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestLeaked(t *testing.T) {
+	// Kept runs are recorded in the user's cache directory
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	now := time.Now()
+	host, _ := os.Hostname()
+	dead := strconv.Itoa(deadPID(t))
+	alive := strconv.Itoa(os.Getpid())
+	labels := func(runID string, age time.Duration, host, pid string) map[string]string {
+		return map[string]string{
+			RunIDLabel:   runID,
+			CreatedLabel: strconv.FormatInt(now.Add(-age).Unix(), 10),
+			HostLabel:    labelValue(host),
+			PIDLabel:     pid,
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(keptRunPath("kept")), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keptRunPath("kept"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		opts   GarbageCollectOpts
+		labels map[string]string
+		leaked bool
+	}{
+		{name: "unlabeled", opts: GarbageCollectOpts{MaxAge: time.Second, DeadRuns: true}, labels: map[string]string{}},
+		{name: "current run", opts: GarbageCollectOpts{MaxAge: time.Second, DeadRuns: true}, labels: labels(labelValue(RunID()), time.Hour, host, dead)},
+		{name: "older than max age", opts: GarbageCollectOpts{MaxAge: time.Minute}, labels: labels("other", time.Hour, "other-host", alive), leaked: true},
+		{name: "younger than max age", opts: GarbageCollectOpts{MaxAge: 2 * time.Hour}, labels: labels("other", time.Hour, host, dead)},
+		{name: "no max age", opts: GarbageCollectOpts{}, labels: labels("other", 1000*time.Hour, host, dead)},
+		{name: "dead run", opts: GarbageCollectOpts{DeadRuns: true}, labels: labels("other", time.Hour, host, dead), leaked: true},
+		{name: "live run", opts: GarbageCollectOpts{DeadRuns: true}, labels: labels("other", time.Hour, host, alive)},
+		{name: "other host", opts: GarbageCollectOpts{DeadRuns: true}, labels: labels("other", time.Hour, "other-host", dead)},
+		{name: "invalid pid", opts: GarbageCollectOpts{DeadRuns: true}, labels: labels("other", time.Hour, host, "nope")},
+		{name: "kept run", opts: GarbageCollectOpts{DeadRuns: true}, labels: labels("kept", time.Hour, host, dead)},
+		{name: "kept run older than max age", opts: GarbageCollectOpts{MaxAge: time.Minute, DeadRuns: true}, labels: labels("kept", time.Hour, host, dead), leaked: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			leaked, _ := tc.opts.leaked(tc.labels, now)
+			if leaked != tc.leaked {
+				t.Errorf("expected leaked=%v, got %v", tc.leaked, leaked)
+			}
+		})
+	}
+}
+
+func TestMarkRunKept(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	if err := markRunKept(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(keptRunPath(labelValue(RunID()))); err != nil {
+		t.Errorf("expected the current run to be marked as kept: %v", err)
+	}
+}
+
+func TestGarbageCollect(t *testing.T) {
+	created := time.Now().Add(-time.Hour).Unix()
+	// object returns the JSON of an object, where release is the value of the name label helm sets on release secrets
+	object := func(namespace, name, release, runID string) string {
+		return fmt.Sprintf(`{"metadata": {"namespace": %q, "name": %q, "labels": {"name": %q, %q: %q, %q: "%d"}}}`,
+			namespace, name, release, RunIDLabel, runID, CreatedLabel, created)
+	}
+	g := ForTest(t)
+	g.Options(SuiteOpts{Kubectl: scriptKubectl(fmt.Sprintf(`
+case "$3" in
+secrets) echo '{"items": [%s, %s, %s, %s]}' ;;
+namespaces) echo '{"items": [%s, %s]}' ;;
+*) exit 1 ;;
+esac
+`,
+		object("ns", "sh.helm.release.v1.b.v1", "b", "old"),
+		object("ns", "sh.helm.release.v1.a.v1", "a", "old"),
+		object("ns", "sh.helm.release.v1.a.v2", "a", "old"),
+		object("ns", "sh.helm.release.v1.current.v1", "current", labelValue(RunID())),
+		object("", "old-ns", "", "old"),
+		object("", "current-ns", "", labelValue(RunID())),
+	))})
+	g.Cluster(&DummyCluster{Name: "main"})
+
+	leaked, err := g.GarbageCollect(context.Background(), GarbageCollectOpts{MaxAge: time.Minute, NoKind: true, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, resource := range leaked {
+		if resource.Cluster != "main" || resource.RunID != "old" || resource.Created.Unix() != created {
+			t.Errorf("unexpected resource %#v", resource)
+		}
+		got = append(got, resource.Kind+" "+resource.Namespace+"/"+resource.Name)
+	}
+	// Releases are identified by the name label of their secrets, and have one secret per revision
+	expected := "HelmRelease ns/a,HelmRelease ns/b,Namespace /old-ns"
+	if strings.Join(got, ",") != expected {
+		t.Errorf("expected %s, got %s", expected, strings.Join(got, ","))
+	}
+}
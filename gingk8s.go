@@ -6,15 +6,15 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"sync"
+	"testing"
 
 	"github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/ginkgo/v2"
-	. "github.com/onsi/gomega"
 	"k8s.io/klog/v2"
 
 	"github.com/google/uuid"
 	"github.com/meln5674/godag"
-	"github.com/meln5674/gosh"
 )
 
 var log = klog.NewKlogr().WithName("Gingk8s")
@@ -24,23 +24,38 @@ func ByStartStop(msg string) func() {
 	return func() { By(fmt.Sprintf("FINISHED: %s", msg)) }
 }
 
+func (s *suiteState) byStartStop(msg string) func() {
+	s.By(fmt.Sprintf("STARTING: %s", msg))
+	return func() { s.By(fmt.Sprintf("FINISHED: %s", msg)) }
+}
+
 func newID() string {
-	id, err := uuid.NewRandom()
-	Expect(err).ToNot(HaveOccurred())
-	return id.String()
+	return uuid.NewString()
 }
 
 type Gingk8s struct {
 	*specState
 }
 
+// ForSuite returns the Gingk8s shared by the current ginkgo suite, reporting to g, e.g. GinkgoT().
 func ForSuite(g ginkgo.FullGinkgoTInterface) Gingk8s {
 
-	state.ginkgo = g
+	state.harness = GinkgoHarness{T: g}
 
 	return Gingk8s{specState: &state.specState}
 }
 
+// New returns a new, independent Gingk8s which reports to the given harness.
+// Unlike ForSuite(), each call returns a separate suite, so multiple may coexist in one process.
+func New(harness Harness) Gingk8s {
+	return Gingk8s{specState: &newSuiteState(harness).specState}
+}
+
+// ForTest returns a new Gingk8s which reports to a plain go test or benchmark, without Ginkgo.
+func ForTest(t testing.TB) Gingk8s {
+	return New(TestingHarness{T: t})
+}
+
 func (g Gingk8s) Options(opts SuiteOpts) {
 	g.suite.opts = opts
 }
@@ -50,16 +65,12 @@ func (g Gingk8s) GetOptions() SuiteOpts {
 }
 
 func (g Gingk8s) ForSpec() Gingk8s {
-	return Gingk8s{specState: g.child()}
+	child := g.child()
+	child.isolateNamespaces = g.suite.opts.IsolateSpecNamespaces
+	return Gingk8s{specState: child}
 }
 
-func (g *Gingk8s) Setup(ctx context.Context) {
-	if g.specState.parent == nil || g.suite.opts.KLogFlags != nil {
-		klogFlags := flag.NewFlagSet("klog", flag.PanicOnError)
-		klog.InitFlags(klogFlags)
-		Expect(klogFlags.Parse(g.suite.opts.KLogFlags)).To(Succeed())
-		klog.SetOutput(GinkgoWriter)
-	}
+func (g *Gingk8s) setDefaults() {
 	if g.suite.opts.CustomImageTag == "" {
 		g.suite.opts.CustomImageTag = DefaultCustomImageTag
 	}
@@ -79,75 +90,68 @@ func (g *Gingk8s) Setup(ctx context.Context) {
 	if g.suite.opts.Kubectl == nil {
 		g.suite.opts.Kubectl = DefaultKubectl
 	}
+}
 
-	repos := make(map[string]*HelmRepo, len(g.releases))
-	repoReleases := make(map[string]string)
-
-	for _, release := range g.releases {
-		if !release.Chart.IsLocal() && !release.Chart.IsOCI() {
-			existing, ok := repos[release.Chart.Name]
-			if !ok {
-				repos[release.Chart.Repo.Name] = release.Chart.Repo
-				repoReleases[release.Chart.Repo.Name] = release.Name
-				continue
-			}
-			Expect(existing).To(Equal(release.Chart.Repo), fmt.Sprintf("Releases %s and %s have incompatible chart repos", release.Name, repoReleases[release.Chart.Repo.Name]))
+func (g *Gingk8s) initKlog() error {
+	if g.specState.parent == nil || g.suite.opts.KLogFlags != nil {
+		klogFlags := flag.NewFlagSet("klog", flag.ContinueOnError)
+		klog.InitFlags(klogFlags)
+		err := klogFlags.Parse(g.suite.opts.KLogFlags)
+		if err != nil {
+			return fmt.Errorf("invalid klog flags: %w", err)
 		}
+		klog.SetOutput(g.suite.harness.Writer())
 	}
+	return nil
+}
 
-	repoAdds := make([]gosh.Commander, 0, len(repos))
-	for _, repo := range repos {
-		repoAdds = append(repoAdds, g.suite.opts.Helm.AddRepo(ctx, repo))
-	}
-	Expect(gosh.FanOut(repoAdds...).WithLog(log).Run()).To(Succeed())
-
-	ex := godag.Executor[string, *specNode]{
-		Log: log.WithName("Setup"),
-	}
-
+// buildDAG builds the DAG of nodes registered for this spec, including placeholders for those of the parent spec,
+// and determines which nodes should be skipped
+func (g *Gingk8s) buildDAG(ctx context.Context) (godag.DAG[string, *specNode], godag.Set[string], error) {
 	log.V(10).Info("Executing Spec", "spec", fmt.Sprintf("%#v", g.specState))
 
 	nodes := make([]*specNode, len(g.setup))
 	copy(nodes, g.setup)
-	if g.parent != nil {
+	// Anything registered by a parent has already been set up by the time the spec starts
+	for parent := g.parent; parent != nil; parent = parent.parent {
 		noopIDs := make(
 			[]string,
 			0,
-			len(g.parent.clusters)+
-				len(g.parent.thirdPartyImages)+
-				len(g.parent.customImages)+
-				len(g.parent.imageArchives)+
-				len(g.parent.releases)+
-				len(g.parent.clusterActions)+
-				len(g.parent.manifests),
+			len(parent.clusters)+
+				len(parent.thirdPartyImages)+
+				len(parent.customImages)+
+				len(parent.imageArchives)+
+				len(parent.releases)+
+				len(parent.clusterActions)+
+				len(parent.manifests),
 		)
-		for id := range g.parent.clusters {
-			for _, id := range g.parent.clusterCustomLoads[id] {
+		for id := range parent.clusters {
+			for _, id := range parent.clusterCustomLoads[id] {
 				noopIDs = append(noopIDs, id)
 			}
-			for _, id := range g.parent.clusterThirdPartyLoads[id] {
+			for _, id := range parent.clusterThirdPartyLoads[id] {
 				noopIDs = append(noopIDs, id)
 			}
-			for _, id := range g.parent.clusterImageArchiveLoads[id] {
+			for _, id := range parent.clusterImageArchiveLoads[id] {
 				noopIDs = append(noopIDs, id)
 			}
 		}
-		for id := range g.parent.thirdPartyImages {
+		for id := range parent.thirdPartyImages {
 			noopIDs = append(noopIDs, id)
 		}
-		for id := range g.parent.customImages {
+		for id := range parent.customImages {
 			noopIDs = append(noopIDs, id)
 		}
-		for id := range g.parent.imageArchives {
+		for id := range parent.imageArchives {
 			noopIDs = append(noopIDs, id)
 		}
-		for id := range g.parent.releases {
+		for id := range parent.releases {
 			noopIDs = append(noopIDs, id)
 		}
-		for id := range g.parent.manifests {
+		for id := range parent.manifests {
 			noopIDs = append(noopIDs, id)
 		}
-		for id := range g.parent.clusterActions {
+		for id := range parent.clusterActions {
 			noopIDs = append(noopIDs, id)
 		}
 
@@ -167,96 +171,286 @@ func (g *Gingk8s) Setup(ctx context.Context) {
 	}
 
 	dag, err := godag.Build[string, *specNode](nodes)
-	Expect(err).ToNot(HaveOccurred())
-	DeferCleanup(func(ctx context.Context) {
-		startFrom := godag.NewSet[string]()
-		for _, node := range g.cleanup {
-			startFrom.Add(node.id)
+	if err != nil {
+		return dag, godag.Set[string]{}, err
+	}
+	skipped, err := g.skippedNodes(nodes)
+	return dag, skipped, err
+}
+
+// runCleanup executes the cleanup of the nodes in the DAG in reverse order, starting from a set of nodes.
+// If startFrom is empty, all nodes are cleaned up.
+// Nodes which fail to clean up do not prevent the nodes they depend on from being cleaned up,
+// and all failures are returned together as a MultiError.
+func (g *Gingk8s) runCleanup(ctx context.Context, dag godag.DAG[string, *specNode], startFrom godag.Set[string]) error {
+	errs := &cleanupErrors{}
+	cleanupDag := godag.DAG[string, cleanupSpecNode]{Nodes: make(map[string]cleanupSpecNode)}
+	for k, v := range dag.Nodes {
+		cleanupDag.Nodes[k] = cleanupSpecNode{specNode: v, ctx: ctx, errors: errs}
+	}
+
+	cleanupEx := godag.Executor[string, godag.NodeWithDependencies[string, cleanupSpecNode]]{
+		Log: klog.NewKlogr().WithName("Cleanup"),
+	}
+
+	reversed := godag.Reverse[string, cleanupSpecNode](cleanupDag)
+	log.V(10).Info("Cleaning up", "reversedDAG", reversed)
+	err := cleanupEx.Run(ctx, reversed, godag.Options[string]{
+		StartFrom: startFrom,
+	})
+	if err != nil {
+		errs.add(err)
+	}
+	if len(errs.errors) == 0 {
+		return nil
+	}
+	return MultiError(errs.errors)
+}
+
+// Setup builds the environment registered for this suite or spec, failing it through its Harness if that fails.
+// Cleanup of the environment is registered with the Harness.
+func (g *Gingk8s) Setup(ctx context.Context) {
+	err := g.TrySetup(ctx)
+	if err != nil {
+		g.suite.harness.Fail(err)
+	}
+}
+
+// TrySetup is Setup, but returns an error instead of failing through the Harness.
+// Cleanup is still registered with the Harness, and will happen even if an error is returned.
+func (g *Gingk8s) TrySetup(ctx context.Context) error {
+	err := g.initKlog()
+	if err != nil {
+		return err
+	}
+	g.setDefaults()
+	ctx = g.context(ctx)
+
+	err = g.addRepos(ctx)
+	if err != nil {
+		return err
+	}
+
+	ex := godag.Executor[string, *specNode]{
+		Log: log.WithName("Setup"),
+	}
+
+	ctx, stop := g.suite.notifySetupInterrupt(ctx)
+	defer stop()
+
+	dag, skipped, err := g.buildDAG(ctx)
+	if err != nil {
+		return err
+	}
+	for id := range skipped.Elems {
+		g.suite.By(fmt.Sprintf("SKIPPED: Gingk8s Node: %s (%s)", dag.Nodes[id].Title(g.specState), id))
+		dag.Nodes[id].emit(dag.Nodes[id].event(NodeSkipped))
+		dag.Nodes[id].skipped = true
+	}
+	g.suite.harness.DeferCleanup(func(ctx context.Context) {
+		ctx = g.context(ctx)
+		if g.parent != nil && g.suite.harness.Failed() {
+			g.MarkFailed()
 		}
+		ctx, stop := g.suite.notifyCleanupInterrupt(ctx)
+		defer stop()
+		g.waitForAbandoned(ctx)
+		startFrom := godag.NewSet[string]()
+		func() {
+			cleanLock.Lock()
+			defer cleanLock.Unlock()
+			for _, node := range g.cleanup {
+				startFrom.Add(node.id)
+			}
+		}()
 		if startFrom.Len() == 0 {
-			startFrom = godag.Set[string]{}
+			return
 		}
-		cleanupDag := godag.DAG[string, cleanupSpecNode]{Nodes: make(map[string]cleanupSpecNode)}
-		for k, v := range dag.Nodes {
-			cleanupDag.Nodes[k] = cleanupSpecNode{specNode: v, ctx: ctx}
+		err := g.runCleanup(ctx, dag, startFrom)
+		if err != nil {
+			g.suite.harness.Fail(err)
 		}
-
-		cleanupEx := godag.Executor[string, godag.NodeWithDependencies[string, cleanupSpecNode]]{
-			Log: klog.NewKlogr().WithName("Cleanup"),
-		}
-
-		reversed := godag.Reverse[string, cleanupSpecNode](cleanupDag)
-		log.V(10).Info("Cleaning up", "reversedDAG", reversed)
-		Expect(cleanupEx.Run(ctx, reversed, godag.Options[string]{
-			StartFrom: startFrom,
-		})).To(Succeed())
 	})
-	if os.Getenv("GINGK8S_INTERACTIVE") != "" {
-		DeferCleanup(func(ctx context.Context) {
-			if g.suite.ginkgo.Failed() {
-				fmt.Println(g.suite.ginkgo.F("{{red}}{{bold}}This setup has failed and you are running in interactive mode.  Here's a timeline of the spec:{{/}}"))
-				fmt.Println(g.suite.ginkgo.Fi(1, g.suite.ginkgo.Name()))
-				fmt.Println(g.suite.ginkgo.Fi(1, g.suite.ginkgo.RenderTimeline()))
-
-				fmt.Println(g.suite.ginkgo.F("{{red}}{{bold}}Gingk8s will now sleep so you can interact with the cluster(s).  Hit ^C when you're done to shut down the suite{{/}}"))
-				<-ctx.Done()
+	succeeded := godag.NewSet[string]()
+	succeededLock := sync.Mutex{}
+	ex.OnSuccess = func(id string, node *specNode) {
+		succeededLock.Lock()
+		defer succeededLock.Unlock()
+		succeeded.Add(id)
+	}
+	if os.Getenv(InteractiveEnv) != "" {
+		g.suite.harness.DeferCleanup(func(ctx context.Context) {
+			if !g.suite.harness.Failed() {
+				return
 			}
+			g.interact(g.context(ctx), func(ctx context.Context) error {
+				succeededLock.Lock()
+				rerunSkipped := succeeded.Copy()
+				succeededLock.Unlock()
+				for id := range skipped.Elems {
+					rerunSkipped.Add(id)
+				}
+				for _, node := range dag.Nodes {
+					node.ctx = ctx
+				}
+				return g.runSetup(ctx, &ex, dag, rerunSkipped)
+			})
 		})
 	}
 	log.V(10).Info("Running setup", "dag", dag)
-	Expect(ex.Run(ctx, dag, godag.Options[string]{})).To(Succeed())
+	return g.runSetup(ctx, &ex, dag, skipped)
+}
+
+// Teardown cleans up every resource registered for this spec, regardless of whether Setup() was called in this process,
+// e.g. to tear down an environment that was left running with NoSuiteCleanup.
+// Resources which require state from Setup() to clean up, such as a RandomNamespace, cannot be torn down this way.
+func (g *Gingk8s) Teardown(ctx context.Context) {
+	err := g.TryTeardown(ctx)
+	if err != nil {
+		g.suite.harness.Fail(err)
+	}
+}
+
+// TryTeardown is Teardown, but returns an error instead of failing through the Harness.
+func (g *Gingk8s) TryTeardown(ctx context.Context) error {
+	err := g.initKlog()
+	if err != nil {
+		return err
+	}
+	g.setDefaults()
+	ctx = g.context(ctx)
+
+	dag, _, err := g.buildDAG(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, stop := g.suite.notifyCleanupInterrupt(ctx)
+	defer stop()
+	return g.runCleanup(ctx, dag, godag.Set[string]{})
 }
 
 type serializableGingk8s struct {
-	Specs      []serializableSpec
-	ClusterIDs []string
+	Opts  SuiteOpts
+	Specs []serializableSpec
+	IDs   []serializedID
+}
+
+type serializedID struct {
+	Kind string
+	ID   string
+}
+
+// SerializableID is an ID returned by registering a resource that can be passed to Serialize().
+// ClusterID, ThirdPartyImageID, CustomImageID, ImageArchiveID, ReleaseID, ManifestsID, and ClusterActionID
+// all implement this interface.
+type SerializableID interface {
+	serializeID() serializedID
+}
+
+// DeserializableID is a pointer to an ID that can be restored with Deserialize().
+// Pointers to ClusterID, ThirdPartyImageID, CustomImageID, ImageArchiveID, ReleaseID, ManifestsID, and ClusterActionID
+// all implement this interface.
+type DeserializableID interface {
+	deserializeID(serializedID) error
+}
+
+func deserializeID(kind string, id *string, serialized serializedID) error {
+	if serialized.Kind != kind {
+		return fmt.Errorf("Serialized ID %s is a %s, not a %s", serialized.ID, serialized.Kind, kind)
+	}
+	*id = serialized.ID
+	return nil
+}
+
+// Serialize takes a gingk8s instance and a set of IDs and serializes them to be
+// used with ginkgo.BeforeSuiteSynchronized, failing the suite through its Harness if that fails.
+// Clusters, images, releases, manifests, and cluster actions will all be valid dependencies in the "rehydrated" gingk8s
+// instance, but only clusters of a kind registered with RegisterClusterKind will retain their original type, others
+// will be restored as a DummyCluster, meaning images cannot be loaded into them.
+// The suite options are restored, except for Images, Manifests, Helm, and Kubectl, which fall back to their defaults.
+// Releases and manifest sets only retain their name and namespace, so they can be depended on, but not re-deployed,
+// diffed, tested, or upgraded, and their Output is not populated. Cluster actions cannot be executed again.
+// Serialize() MUST be called AFTER Setup(), as none of the resources will be re-created on the parallel processes.
+func (g *Gingk8s) Serialize(ids ...SerializableID) []byte {
+	out, err := g.TrySerialize(ids...)
+	if err != nil {
+		g.suite.harness.Fail(err)
+	}
+	return out
 }
 
-// Serialize takes a gingk8s instance and a set of cluster IDs and serializes them to be
-// used with ginkgo.BeforeSuiteSynchronized.
-// Only cluster ID's will be valid dependencies in the "rehydrated" gingk8s instance, so
-// Serialize() MUST be called AFTER Setup(), as any images, manifests, releases, etc,
-// will be inaccessible on the parallel processes.
-func (g *Gingk8s) Serialize(clusterIDs ...ClusterID) []byte {
+// TrySerialize is Serialize, but returns an error instead of failing through the Harness.
+func (g *Gingk8s) TrySerialize(ids ...SerializableID) ([]byte, error) {
 	g2 := serializableGingk8s{
-		Specs:      []serializableSpec{},
-		ClusterIDs: make([]string, len(clusterIDs)),
+		Opts:  g.suite.opts,
+		Specs: []serializableSpec{},
+		IDs:   make([]serializedID, len(ids)),
 	}
-	for spec := g.specState; spec != nil; spec = g.specState.parent {
-		g2.Specs = append(g2.Specs, spec.serialize())
+	for spec := g.specState; spec != nil; spec = spec.parent {
+		serialized, err := spec.serialize()
+		if err != nil {
+			return nil, err
+		}
+		g2.Specs = append(g2.Specs, serialized)
 	}
 	// TODO: This is on the honnor system, we don't check if these ID's are valid,
-	// but, there shouldn't be a way for a user to construct a cluster id
-	for ix, id := range clusterIDs {
-		g2.ClusterIDs[ix] = id.id
+	// but, there shouldn't be a way for a user to construct an id
+	for ix, id := range ids {
+		g2.IDs[ix] = id.serializeID()
 	}
 
-	out, err := json.Marshal(&g2)
-	Expect(err).ToNot(HaveOccurred())
-	return out
+	return json.Marshal(&g2)
 }
 
 // Deserialize takes the opaque output from Serialize() and restores a stub gingk8s, along with
-// the same set of cluster IDs.
-// It is the user's responsibility to ensure that the equivalent cluster ID's are passed to both
+// the same set of IDs, failing the spec through Ginkgo if that fails.
+// It is the user's responsibility to ensure that the equivalent ID's are passed to both
 // Serialize and Deserialize in the same order.
-func (g *Gingk8s) Deserialize(in []byte, gt ginkgo.FullGinkgoTInterface, clusterIDs ...*ClusterID) {
+func (g *Gingk8s) Deserialize(in []byte, gt ginkgo.FullGinkgoTInterface, ids ...DeserializableID) {
+	harness := GinkgoHarness{T: gt}
+	err := g.TryDeserialize(in, harness, ids...)
+	if err != nil {
+		harness.Fail(err)
+	}
+}
+
+// TryDeserialize is Deserialize, but restores a gingk8s which reports to any Harness, and returns an error instead
+// of failing.
+func (g *Gingk8s) TryDeserialize(in []byte, harness Harness, ids ...DeserializableID) error {
 	var g2 serializableGingk8s
-	Expect(json.Unmarshal(in, &g2)).To(Succeed())
+	err := json.Unmarshal(in, &g2)
+	if err != nil {
+		return err
+	}
+	if len(ids) != len(g2.IDs) {
+		return fmt.Errorf("Deserialize() must be passed the same number of IDs as Serialize(), got %d, expected %d", len(ids), len(g2.IDs))
+	}
 
-	var suite suiteState
-	suite.suite = &suite
-	suite.ginkgo = gt
+	suite := newSuiteState(harness)
+	suite.opts = g2.Opts
 
 	var parent *specState
-	spec := &suite.specState
 	for ix := len(g2.Specs) - 1; ix >= 0; ix-- {
-		spec.deserialize(parent, g2.Specs[ix])
+		var spec *specState
+		if parent == nil {
+			spec = &suite.specState
+		} else {
+			child := newSpecState(suite, parent)
+			spec = &child
+		}
+		err = spec.deserialize(parent, g2.Specs[ix])
+		if err != nil {
+			return err
+		}
 		parent = spec
 	}
-	for ix, id := range g2.ClusterIDs {
-		clusterIDs[ix].id = id
+	for ix, id := range g2.IDs {
+		err = ids[ix].deserializeID(id)
+		if err != nil {
+			return err
+		}
 	}
 
-	g.specState = &suite.specState
+	g.specState = parent
+	return nil
 }
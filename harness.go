@@ -0,0 +1,168 @@
+package gingk8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/meln5674/gosh"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+// Harness is how Gingk8s interacts with the test framework it is running under.
+// Gingk8s itself only reports errors, the Harness decides how to surface them.
+type Harness interface {
+	// By reports a progress message
+	By(text string)
+	// Writer returns where logs and command output should be written
+	Writer() io.Writer
+	// DeferCleanup registers a function to be called once the current suite, spec, or test has finished
+	DeferCleanup(func(context.Context))
+	// Failed returns true if the current suite, spec, or test has failed
+	Failed() bool
+	// Fail fails the current suite, spec, or test with an error returned by Gingk8s
+	Fail(err error)
+}
+
+// ParallelHarness is a Harness for a test framework which runs a suite in multiple processes in parallel.
+// Harnesses which do not implement it are treated as always running in the first process.
+type ParallelHarness interface {
+	Harness
+	// ParallelProcess returns the index of the current process, starting at 1
+	ParallelProcess() int
+}
+
+// GinkgoHarness is a Harness that reports to Ginkgo, e.g. GinkgoHarness{T: GinkgoT()}.
+type GinkgoHarness struct {
+	T ginkgo.FullGinkgoTInterface
+}
+
+var _ = ParallelHarness(GinkgoHarness{})
+
+// By implements Harness
+func (h GinkgoHarness) By(text string) {
+	ginkgo.By(text)
+}
+
+// Writer implements Harness
+func (h GinkgoHarness) Writer() io.Writer {
+	return ginkgo.GinkgoWriter
+}
+
+// DeferCleanup implements Harness
+func (h GinkgoHarness) DeferCleanup(f func(context.Context)) {
+	h.T.DeferCleanup(f)
+}
+
+// Failed implements Harness
+func (h GinkgoHarness) Failed() bool {
+	return h.T.Failed()
+}
+
+// Fail implements Harness
+func (h GinkgoHarness) Fail(err error) {
+	gomega.ExpectWithOffset(2, err).ToNot(gomega.HaveOccurred())
+}
+
+// ParallelProcess implements ParallelHarness
+func (h GinkgoHarness) ParallelProcess() int {
+	return ginkgo.GinkgoParallelProcess()
+}
+
+// describeFailure prints the timeline of the failed spec
+func (h GinkgoHarness) describeFailure(w io.Writer) {
+	fmt.Fprintln(w, h.T.F("{{red}}{{bold}}This setup has failed and you are running in interactive mode.  Here's a timeline of the spec:{{/}}"))
+	fmt.Fprintln(w, h.T.Fi(1, h.T.Name()))
+	fmt.Fprintln(w, h.T.Fi(1, h.T.RenderTimeline()))
+}
+
+// TestingHarness is a Harness that reports to a plain go test, e.g. TestingHarness{T: t}.
+type TestingHarness struct {
+	T testing.TB
+	// Out is where logs and command output are written. If nil, os.Stdout is used.
+	Out io.Writer
+}
+
+var _ = Harness(TestingHarness{})
+
+// By implements Harness
+func (h TestingHarness) By(text string) {
+	h.T.Helper()
+	h.T.Log("STEP: " + text)
+}
+
+// Writer implements Harness
+func (h TestingHarness) Writer() io.Writer {
+	if h.Out == nil {
+		return os.Stdout
+	}
+	return h.Out
+}
+
+// DeferCleanup implements Harness
+func (h TestingHarness) DeferCleanup(f func(context.Context)) {
+	h.T.Cleanup(func() { f(context.Background()) })
+}
+
+// Failed implements Harness
+func (h TestingHarness) Failed() bool {
+	return h.T.Failed()
+}
+
+// Fail implements Harness
+func (h TestingHarness) Fail(err error) {
+	h.T.Helper()
+	h.T.Fatal(err)
+}
+
+// describeFailure prints the name of the failed test
+func (h TestingHarness) describeFailure(w io.Writer) {
+	fmt.Fprintf(w, "%s has failed and you are running in interactive mode.\n", h.T.Name())
+}
+
+// outputKey is the context key for the writer that commands write their output to
+type outputKey struct{}
+
+// WithOutput returns a context which makes commands run with it by Gingk8s, such as kubectl and helm,
+// write their output to w. Setup(), Teardown(), and other methods of Gingk8s use the Writer() of their Harness.
+// Commands run with a context without an output write to os.Stdout and os.Stderr.
+func WithOutput(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, outputKey{}, w)
+}
+
+// outWriter returns the writer for the standard output of commands run with a context
+func outWriter(ctx context.Context) io.Writer {
+	if w, ok := ctx.Value(outputKey{}).(io.Writer); ok {
+		return w
+	}
+	return os.Stdout
+}
+
+// errWriter returns the writer for the standard error of commands run with a context
+func errWriter(ctx context.Context) io.Writer {
+	if w, ok := ctx.Value(outputKey{}).(io.Writer); ok {
+		return w
+	}
+	return os.Stderr
+}
+
+// outErrStreams forwards the standard output and error of a command to the output of a context
+func outErrStreams(ctx context.Context) gosh.StreamSetter {
+	return gosh.SetStreams(gosh.WriterOut(outWriter(ctx)), gosh.WriterErr(errWriter(ctx)))
+}
+
+// errStream forwards the standard error of a command to the output of a context
+func errStream(ctx context.Context) gosh.StreamSetter {
+	return gosh.WriterErr(errWriter(ctx))
+}
+
+// context returns a context which makes commands write their output to the Harness, unless it already has an output
+func (g Gingk8s) context(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(outputKey{}).(io.Writer); ok {
+		return ctx
+	}
+	return WithOutput(ctx, g.suite.harness.Writer())
+}
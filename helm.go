@@ -2,12 +2,14 @@ package gingk8s
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
 
-	. "github.com/onsi/gomega"
-
 	"github.com/meln5674/gosh"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 var (
@@ -20,12 +22,32 @@ type ReleaseID struct {
 	id string
 }
 
+func (r ReleaseID) serializeID() serializedID {
+	return serializedID{Kind: "Release", ID: r.id}
+}
+
+func (r *ReleaseID) deserializeID(id serializedID) error {
+	return deserializeID("Release", &r.id, id)
+}
+
 func (r ReleaseID) AddResourceDependency(dep *ResourceDependencies) {
 	dep.Releases = append(dep.Releases, r)
 }
 
 func (g Gingk8s) Release(cluster ClusterID, release *HelmRelease, deps ...ResourceDependency) ReleaseID {
 	releaseID := newID()
+	deps = append(deps, release.imageDependencies()...)
+
+	var namespace *RandomNamespace
+	if release.Namespace == "" {
+		if ns := g.isolatedNamespace(cluster); ns != nil {
+			// Copy the release so that the same release can be registered from multiple specs
+			release2 := *release
+			release = &release2
+			namespace = ns.namespace
+			deps = append(deps, ns.id)
+		}
+	}
 	g.releases[releaseID] = release
 
 	dependsOn := append([]string{cluster.id}, forResourceDependencies(deps...).allIDs(g.specState, cluster.id)...)
@@ -33,7 +55,8 @@ func (g Gingk8s) Release(cluster ClusterID, release *HelmRelease, deps ...Resour
 		state:      g.specState,
 		id:         releaseID,
 		dependsOn:  dependsOn,
-		specAction: &releaseAction{id: releaseID, clusterID: cluster.id, g: g},
+		specAction: &releaseAction{id: releaseID, clusterID: cluster.id, namespace: namespace, g: g},
+		conditions: &release.Conditions,
 	}
 
 	g.setup = append(g.setup, &node)
@@ -44,21 +67,141 @@ func (g Gingk8s) Release(cluster ClusterID, release *HelmRelease, deps ...Resour
 type releaseAction struct {
 	id        string
 	clusterID string
+	namespace *RandomNamespace
 	g         Gingk8s
 }
 
 func (r *releaseAction) Setup(ctx context.Context, state *specState) error {
+	if r.namespace != nil {
+		state.releases[r.id].Namespace = r.namespace.Get()
+	}
 	if state.suite.opts.NoDeps {
 		return nil
 	}
-	return state.suite.opts.Helm.InstallOrUpgrade(r.g, ctx, state.getCluster(r.clusterID), state.releases[r.id]).Run()
+	release := state.releases[r.id].withImageValues(state)
+	cluster := state.getCluster(r.clusterID)
+	if release.Diff || release.StrictDiff {
+		err := diffRelease(r.g, ctx, state, cluster, release)
+		if err != nil {
+			return err
+		}
+	}
+	return gosh.And(
+		state.suite.opts.Helm.InstallOrUpgrade(r.g, ctx, cluster, release),
+		labelRelease(ctx, state, cluster, release),
+	).Run()
 }
 
-func (r *releaseAction) Cleanup(ctx context.Context, state *specState) {
-	if state.NoCleanup() || state.releases[r.id].SkipDelete {
-		return
+// labelRelease labels the revisions of a release as owned by this run.
+// Helm stores each revision of a release as a secret, labeling them allows leaked releases to be found
+func labelRelease(ctx context.Context, state *specState, cluster Cluster, release *HelmRelease) gosh.Commander {
+	labelArgs := []string{"secrets", "-l", "owner=helm,name=" + release.Name}
+	if release.Namespace != "" {
+		labelArgs = append(labelArgs, "--namespace", release.Namespace)
 	}
-	Expect(state.suite.opts.Helm.Delete(ctx, state.getCluster(r.clusterID), state.releases[r.id], true).Run()).To(Succeed())
+	return labelOwned(ctx, state.suite.opts.Kubectl, cluster, labelArgs...)
+}
+
+func (r *releaseAction) Cleanup(ctx context.Context, state *specState) error {
+	if state.releases[r.id].SkipDelete {
+		return nil
+	}
+	return state.suite.opts.Helm.Delete(ctx, state.getCluster(r.clusterID), state.releases[r.id], true).Run()
+}
+
+func (r *releaseAction) Fingerprint(ctx context.Context, state *specState, w io.Writer) error {
+	release := state.releases[r.id].withImageValues(state)
+	cluster := state.getCluster(r.clusterID)
+	namespace := release.Namespace
+	if r.namespace != nil {
+		namespace = r.namespace.Get()
+	}
+	err := fingerprintFields(
+		w,
+		release.Name,
+		namespace,
+		release.Chart.Fullname(),
+		release.Chart.Version(),
+		strings.Join(release.Chart.UpgradeFlags, " "),
+		strings.Join(release.ExtraFlags, " "),
+		strings.Join(release.UpgradeFlags, " "),
+		release.NoWait,
+		fmt.Sprintf("%v", release.Wait),
+	)
+	if err != nil {
+		return err
+	}
+	if release.Chart.IsLocal() {
+		err = fingerprintPath(w, release.Chart.Path, true)
+		if err != nil {
+			return err
+		}
+	}
+	set := make(map[string]string, len(release.Set))
+	for k, v := range release.Set {
+		s := strings.Builder{}
+		err = valueString(r.g, ctx, cluster, &s, v)
+		if err != nil {
+			return err
+		}
+		set[k] = s.String()
+	}
+	err = fingerprintStringMap(w, set)
+	if err != nil {
+		return err
+	}
+	err = fingerprintStringMap(w, release.SetString)
+	if err != nil {
+		return err
+	}
+	err = fingerprintStringMap(w, release.SetFile)
+	if err != nil {
+		return err
+	}
+	for _, path := range release.SetFile {
+		err = fingerprintPath(w, path, false)
+		if err != nil {
+			return err
+		}
+	}
+	// encoding/json sorts map keys, so this is consistent
+	setJSON, err := json.Marshal(release.SetJSON)
+	if err != nil {
+		return err
+	}
+	err = fingerprintFields(w, string(setJSON))
+	if err != nil {
+		return err
+	}
+	for _, path := range release.ValuesFiles {
+		err = fingerprintPath(w, path, false)
+		if err != nil {
+			return err
+		}
+	}
+	for _, v := range release.Values {
+		resolved, err := resolveNestedObject(r.g, ctx, cluster, v)
+		if err != nil {
+			return err
+		}
+		valuesJSON, err := json.Marshal(resolved)
+		if err != nil {
+			return err
+		}
+		err = fingerprintFields(w, string(valuesJSON))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *releaseAction) FingerprintClusterID() string {
+	return r.clusterID
+}
+
+func (r *releaseAction) FingerprintName(state *specState) (string, string) {
+	return state.releases[r.id].Namespace, state.releases[r.id].Name
 }
 
 func (r *releaseAction) Title(state *specState) string {
@@ -73,6 +216,11 @@ type HelmRepo struct {
 	URL string
 	// Flags are any extra flags to provide to the `helm repo add` command
 	Flags []string
+	// UsernameFile, if set, is the path to a file containing the username to provide to `helm repo add`
+	UsernameFile string
+	// PasswordFile, if set, is the path to a file containing the password to provide to `helm repo add`.
+	// It is passed through stdin, so that it is not logged.
+	PasswordFile string
 	// Update indicates that `helm repo update` should be run for this repo
 	Update bool
 }
@@ -168,13 +316,16 @@ type HelmRelease struct {
 	SetString StringObject
 	// SetFile is a map of --set-file arguments
 	SetFile StringObject
+	// ImageValues binds images to values of the release, which are set as with SetString once the release is installed.
+	// The images are added as dependencies of the release.
+	ImageValues []ImageValues
 	// SetJSON is map of --set-json arguments. Its values will be passed to encoding/json.Marshal.
 	SetJSON NestedObject
 	// ValuesFiles is a list of files to be provided with --values
 	ValuesFiles []string
 	// Values is a set of objects to be serialized as YAML files and provided with --values
 	Values []NestedObject
-	// ExtraFlags is a set of extra arguments to pass to both helm upgrade and delete
+	// ExtraFlags is a set of extra arguments to pass to helm upgrade, rollback, and delete
 	ExtraFlags []string
 	// UpgradeFlags is a set of extra arguments to pass to helm upgrade
 	UpgradeFlags []string
@@ -187,13 +338,83 @@ type HelmRelease struct {
 	NoWait bool
 
 	SkipDelete bool
+
+	// Diff, if true, compares the objects of the release as it is deployed to those upgrading it would deploy, and logs any
+	// differences before upgrading it, e.g. to catch changes to a chart when re-running a suite with SuiteOpts.NoSuiteCleanup.
+	// Nothing is compared the first time the release is installed.
+	// SuiteOpts.Helm must implement HelmDiffer, which HelmCommand does.
+	Diff bool
+	// StrictDiff, if true, implies Diff, and fails the release instead of upgrading it if there are any differences
+	StrictDiff bool
+
+	// Output, if non-nil, is populated with the state of the release once it has been installed or upgraded.
+	// It is not populated if the release is skipped, including when it is unchanged (see SuiteOpts.Incremental).
+	Output *HelmReleaseOutput
+
+	// Conditions control if this release is installed
+	Conditions
+}
+
+// HelmTemplater knows how to render helm charts without installing them
+type HelmTemplater interface {
+	// Template renders a release and returns the objects it would create, without connecting to a cluster.
+	// The repo of its chart, if any, has already been added.
+	Template(g Gingk8s, ctx context.Context, release *HelmRelease) ([]unstructured.Unstructured, error)
+}
+
+// Template renders a release without installing it, e.g. `helm template`, and returns the objects it would create,
+// not including hooks. No cluster is needed, and any func values are passed a nil Cluster.
+// SuiteOpts.Helm must implement HelmTemplater, which HelmCommand does.
+// The repo of the chart, if any, is added in the same way as during Setup(), so it is only added once per suite.
+// See HaveObject and HaveObjectField for matching against the result.
+func (g Gingk8s) Template(ctx context.Context, release *HelmRelease) ([]unstructured.Unstructured, error) {
+	ctx = g.context(ctx)
+	helm := g.suite.opts.Helm
+	if helm == nil {
+		helm = DefaultHelm
+	}
+	templater, ok := helm.(HelmTemplater)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support rendering templates", helm)
+	}
+	use, err := releaseRepoUse(release)
+	if err != nil {
+		return nil, err
+	}
+	if use != nil {
+		err = g.suite.addRepos(ctx, helm, []repoUse{*use})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return templater.Template(g, ctx, release.withImageValues(g.specState))
+}
+
+// HelmRollbacker knows how to roll back helm releases
+type HelmRollbacker interface {
+	// Rollback rolls a release back to a previous revision. If revision is zero, it is rolled back to the revision before the current one.
+	Rollback(ctx context.Context, cluster Cluster, release *HelmRelease, revision int) gosh.Commander
+}
+
+// HelmReleaseOutput is the state of a release once it has been installed or upgraded
+type HelmReleaseOutput struct {
+	// Revision is the revision number of the release
+	Revision int
+	// Status is the status of the release, e.g. "deployed"
+	Status string
+	// Notes is the rendered NOTES.txt of the chart
+	Notes string
+	// Values are the computed values of the release, including the defaults from the chart
+	Values map[string]interface{}
+	// Objects are the objects rendered by the chart, not including hooks, in the order helm rendered them
+	Objects []unstructured.Unstructured
 }
 
 // Helm knows how to install and uninstall helm charts
 type Helm interface {
 	// AddRepo adds a repo that only this HelmReleaser can use
 	AddRepo(ctx context.Context, repo *HelmRepo) gosh.Commander
-	// InstallOrUpgrade upgrades or installs a release into a cluster
+	// InstallOrUpgrade upgrades or installs a release into a cluster, and populates its Output, if set
 	InstallOrUpgrade(g Gingk8s, ctx context.Context, cluster Cluster, release *HelmRelease) gosh.Commander
 	// Delete removes a release from a cluster. If skipNotExists is true, this should not fail if the release does not exist.
 	Delete(ctx context.Context, cluster Cluster, release *HelmRelease, skipNotExists bool) gosh.Commander
@@ -0,0 +1,232 @@
+package gingk8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/meln5674/gosh"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// HelmOfflineEnv is an environment variable which, if set to "true", makes every HelmCommand behave as if Offline were set
+	HelmOfflineEnv = "GINGK8S_HELM_OFFLINE"
+)
+
+// DefaultHelmHome returns the directory HelmCommand keeps helm's configuration and cache in if its Home is not set.
+// It is in the user's cache directory, so that it is kept between runs.
+func DefaultHelmHome() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	return filepath.Join(cacheDir, "gingk8s", "helm")
+}
+
+func (h *HelmCommand) home() string {
+	if h.Home != "" {
+		return h.Home
+	}
+	return DefaultHelmHome()
+}
+
+func (h *HelmCommand) offline() bool {
+	return h.Offline || os.Getenv(HelmOfflineEnv) == "true"
+}
+
+func (h *HelmCommand) configHome() string {
+	return filepath.Join(h.home(), "config")
+}
+
+func (h *HelmCommand) cacheHome() string {
+	return filepath.Join(h.home(), "cache")
+}
+
+// chartCacheDir is where remote charts are pulled to before they are installed
+func (h *HelmCommand) chartCacheDir() string {
+	return filepath.Join(h.cacheHome(), "gingk8s-charts")
+}
+
+// env returns the environment variables to isolate helm to the gingk8s configuration and cache
+func (h *HelmCommand) env() map[string]string {
+	if h.UseUserHome {
+		return nil
+	}
+	return map[string]string{
+		"HELM_CONFIG_HOME": h.configHome(),
+		"HELM_CACHE_HOME":  h.cacheHome(),
+	}
+}
+
+// repoCached returns true if a repo with the same name and URL has been added, and its index has been cached
+func (h *HelmCommand) repoCached(repo *HelmRepo) (bool, error) {
+	reposYAML, err := os.ReadFile(filepath.Join(h.configHome(), "repositories.yaml"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var repos struct {
+		Repositories []struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"repositories"`
+	}
+	err = yaml.Unmarshal(reposYAML, &repos)
+	if err != nil {
+		return false, err
+	}
+	for _, cached := range repos.Repositories {
+		if cached.Name != repo.Name {
+			continue
+		}
+		if cached.URL != repo.URL {
+			return false, nil
+		}
+		_, err := os.Stat(h.repoIndexPath(repo.Name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	return false, nil
+}
+
+func (h *HelmCommand) repoIndexPath(repoName string) string {
+	return filepath.Join(h.cacheHome(), "repository", repoName+"-index.yaml")
+}
+
+// latestCachedVersion returns the latest version of a chart in the cached index of its repo
+func (h *HelmCommand) latestCachedVersion(chart *HelmChart) (string, error) {
+	indexYAML, err := os.ReadFile(h.repoIndexPath(chart.Repo.Name))
+	if err != nil {
+		return "", fmt.Errorf("Index of helm repo %s has not been cached: %w", chart.Repo.Name, err)
+	}
+	var index struct {
+		Entries map[string][]struct {
+			Version string `json:"version"`
+		} `json:"entries"`
+	}
+	err = yaml.Unmarshal(indexYAML, &index)
+	if err != nil {
+		return "", err
+	}
+	// Helm sorts the versions of each chart from newest to oldest
+	versions := index.Entries[chart.Name]
+	if len(versions) == 0 {
+		return "", fmt.Errorf("Cached index of helm repo %s has no chart %s", chart.Repo.Name, chart.Name)
+	}
+	return versions[0].Version, nil
+}
+
+// chartPullDir is the directory a remote or OCI chart is pulled to. Charts are kept separately for each repo or registry,
+// as charts with the same name and version from different repos may differ.
+func (h *HelmCommand) chartPullDir(chart *HelmChart) string {
+	var source string
+	if chart.IsOCI() {
+		source = "oci://" + chart.Registry.Hostname + "/" + path.Dir(chart.Repository)
+	} else {
+		source = chart.Repo.URL
+	}
+	hash := sha256.Sum256([]byte(source))
+	return filepath.Join(h.chartCacheDir(), hex.EncodeToString(hash[:8]))
+}
+
+// cachedChartPath is the path a version of a remote or OCI chart is pulled to
+func (h *HelmCommand) cachedChartPath(chart *HelmChart, version string) string {
+	return filepath.Join(h.chartPullDir(chart), fmt.Sprintf("%s-%s.tgz", chartBaseName(chart), version))
+}
+
+var exactVersion = regexp.MustCompile(`^v?[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// isExactVersion returns true if a chart version is an exact semantic version, and not a range such as ^1.2,
+// so that helm pull writes the tarball named after it
+func isExactVersion(version string) bool {
+	return exactVersion.MatchString(version)
+}
+
+// errOfflineUserHome is returned when a HelmCommand is offline, but uses the user's home, which it does not manage a cache in
+func errOfflineUserHome() error {
+	return fmt.Errorf("Helm cannot be used offline with UseUserHome, as charts and repos are only cached in its own home (set %s=false, or unset UseUserHome)", HelmOfflineEnv)
+}
+
+// chartBaseName returns the name of a remote or OCI chart, which its tarball is named after
+func chartBaseName(chart *HelmChart) string {
+	if chart.IsOCI() {
+		return path.Base(chart.Repository)
+	}
+	return chart.Name
+}
+
+// chartRef returns the reference to install a chart from, and a command to run first to fetch it, if needed.
+// Unless the user's home is used, remote and OCI charts are pulled into the cache, and installed from there.
+// If the exact version of the chart is known and it has already been pulled, or in offline mode, the cached chart is used.
+// Charts with a version range are pulled so that they are cached, but are installed from the repo, as with no version.
+// If usingCache is true, ref is the path to a tarball, and --version must not be passed.
+func (h *HelmCommand) chartRef(ctx context.Context, chart *HelmChart) (ref string, fetch gosh.Commander, usingCache bool, err error) {
+	if chart.IsLocal() {
+		return chart.Fullname(), nil, false, nil
+	}
+	if h.UseUserHome {
+		if h.offline() {
+			return "", nil, false, errOfflineUserHome()
+		}
+		return chart.Fullname(), nil, false, nil
+	}
+	version := chart.Version()
+	if version != "" && !isExactVersion(version) {
+		if h.offline() {
+			return "", nil, false, fmt.Errorf("Chart %s version %s is not an exact version, and cannot be used offline", chart.Fullname(), version)
+		}
+		fetch = gosh.And(
+			gosh.FromFunc(ctx, MkdirAll(h.chartPullDir(chart), 0700)),
+			h.helm(ctx, &KubernetesConnection{}, []string{"pull", chart.Fullname(), "--destination", h.chartPullDir(chart), "--version", version}),
+		)
+		return chart.Fullname(), fetch, false, nil
+	}
+	if version == "" && h.offline() {
+		if chart.IsOCI() {
+			return "", nil, false, fmt.Errorf("OCI chart %s must have a version to be used offline", chart.Fullname())
+		}
+		version, err = h.latestCachedVersion(chart)
+		if err != nil {
+			return "", nil, false, err
+		}
+	}
+	if version != "" {
+		tarball := h.cachedChartPath(chart, version)
+		_, err := os.Stat(tarball)
+		if err == nil {
+			return tarball, nil, true, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", nil, false, err
+		}
+		if h.offline() {
+			return "", nil, false, fmt.Errorf("Chart %s version %s has not been cached", chart.Fullname(), version)
+		}
+	}
+	args := []string{"pull", chart.Fullname(), "--destination", h.chartPullDir(chart)}
+	if version != "" {
+		args = append(args, "--version", version)
+	}
+	fetch = gosh.And(
+		gosh.FromFunc(ctx, MkdirAll(h.chartPullDir(chart), 0700)),
+		h.helm(ctx, &KubernetesConnection{}, args),
+	)
+	if version == "" {
+		// The latest version is pulled so that it is cached for offline use, but the name of its tarball is not known
+		// until then, so it is installed from the repo as normal
+		return chart.Fullname(), fetch, false, nil
+	}
+	return h.cachedChartPath(chart, version), fetch, true, nil
+}
@@ -0,0 +1,256 @@
+package gingk8s
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeFile writes a file, creating its directory
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, []byte(contents), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func remoteChart(repo *HelmRepo, name, version string) *HelmChart {
+	return &HelmChart{RemoteChartInfo: RemoteChartInfo{Name: name, Repo: repo, Version: version}}
+}
+
+func ociChart(hostname, repository, version string) *HelmChart {
+	return &HelmChart{OCIChartInfo: OCIChartInfo{Registry: HelmRegistry{Hostname: hostname}, Repository: repository, Version: version}}
+}
+
+func TestIsExactVersion(t *testing.T) {
+	cases := map[string]bool{
+		"1.2.3":             true,
+		"v1.2.3":            true,
+		"1.2.3-rc.1":        true,
+		"1.2.3+build.5":     true,
+		"1.2.3-rc.1+build5": true,
+		"":                  false,
+		"1.2":               false,
+		"^1.2.3":            false,
+		"~1.2.3":            false,
+		">=1.2.3":           false,
+		"1.2.x":             false,
+		"1.2.3 - 1.4.0":     false,
+		"1.2.3 || 2.0.0":    false,
+	}
+	for version, exact := range cases {
+		if isExactVersion(version) != exact {
+			t.Errorf("expected isExactVersion(%q) to be %v", version, exact)
+		}
+	}
+}
+
+func TestChartPullDir(t *testing.T) {
+	h := &HelmCommand{Home: t.TempDir()}
+	repo := &HelmRepo{Name: "repo", URL: "https://example.com/charts"}
+	dir := h.chartPullDir(remoteChart(repo, "app", "1.0.0"))
+	if filepath.Dir(dir) != h.chartCacheDir() {
+		t.Errorf("expected %s to be in the chart cache %s", dir, h.chartCacheDir())
+	}
+
+	same := map[string]*HelmChart{
+		"other chart":                    remoteChart(repo, "other", "2.0.0"),
+		"same URL with a different name": remoteChart(&HelmRepo{Name: "renamed", URL: repo.URL}, "app", "1.0.0"),
+	}
+	for name, chart := range same {
+		if h.chartPullDir(chart) != dir {
+			t.Errorf("%s: expected charts from the same repo to be pulled to the same directory", name)
+		}
+	}
+
+	// Charts with the same name and version from different sources may differ, so must not share a directory
+	different := map[string]*HelmChart{
+		"same name with a different URL": remoteChart(&HelmRepo{Name: "repo", URL: "https://example.com/other"}, "app", "1.0.0"),
+		"OCI":                            ociChart("example.com", "charts/app", "1.0.0"),
+	}
+	for name, chart := range different {
+		if h.chartPullDir(chart) == dir {
+			t.Errorf("%s: expected charts from different repos to be pulled to different directories", name)
+		}
+	}
+
+	oci := h.chartPullDir(ociChart("example.com", "charts/app", "1.0.0"))
+	if h.chartPullDir(ociChart("example.com", "charts/other", "1.0.0")) != oci {
+		t.Error("expected charts in the same OCI repository to be pulled to the same directory")
+	}
+	if h.chartPullDir(ociChart("registry.example.com", "charts/app", "1.0.0")) == oci {
+		t.Error("expected charts in different OCI registries to be pulled to different directories")
+	}
+	if h.cachedChartPath(ociChart("example.com", "charts/app", "1.0.0"), "1.0.0") != filepath.Join(oci, "app-1.0.0.tgz") {
+		t.Error("expected OCI charts to be cached by the last component of their repository")
+	}
+}
+
+func TestChartRef(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test helm is a shell script")
+	}
+	repo := &HelmRepo{Name: "repo", URL: "https://example.com/charts"}
+	const index = `
+entries:
+  app:
+  - version: 1.1.0
+  - version: 1.0.0
+`
+	cases := []struct {
+		name        string
+		chart       *HelmChart
+		offline     bool
+		offlineEnv  bool
+		useUserHome bool
+		// cached are the versions of the chart that have already been pulled
+		cached []string
+		// index, if true, caches the index of the repo
+		index bool
+		// ref is the expected reference, relative to the directory the chart is pulled to if usingCache
+		ref        string
+		usingCache bool
+		// pull is the expected args to pull the chart, if any
+		pull string
+		err  string
+	}{
+		{name: "local", chart: localChart("chart"), offline: true, ref: "./chart"},
+		{name: "user home", chart: remoteChart(repo, "app", "^1.0"), useUserHome: true, ref: "repo/app"},
+		{name: "user home offline", chart: remoteChart(repo, "app", "1.0.0"), useUserHome: true, offline: true, err: "cannot be used offline with UseUserHome"},
+		{name: "user home offline from environment", chart: remoteChart(repo, "app", "1.0.0"), useUserHome: true, offlineEnv: true, err: "cannot be used offline with UseUserHome"},
+		{name: "exact version", chart: remoteChart(repo, "app", "1.0.0"), ref: "app-1.0.0.tgz", usingCache: true, pull: "pull repo/app --destination {dir} --version 1.0.0"},
+		{name: "exact version cached", chart: remoteChart(repo, "app", "1.0.0"), cached: []string{"1.0.0"}, ref: "app-1.0.0.tgz", usingCache: true},
+		{name: "exact version cached offline", chart: remoteChart(repo, "app", "1.0.0"), cached: []string{"1.0.0"}, offline: true, ref: "app-1.0.0.tgz", usingCache: true},
+		{name: "exact version not cached offline", chart: remoteChart(repo, "app", "1.0.0"), cached: []string{"1.1.0"}, offline: true, err: "version 1.0.0 has not been cached"},
+		// Ranges are not installed from the cache, as the tarball helm pulls is named after the version it resolves to
+		{name: "range", chart: remoteChart(repo, "app", "^1.0"), cached: []string{"1.0.0"}, ref: "repo/app", pull: "pull repo/app --destination {dir} --version ^1.0"},
+		{name: "range offline", chart: remoteChart(repo, "app", "^1.0"), cached: []string{"1.0.0"}, offline: true, err: "is not an exact version"},
+		{name: "latest", chart: remoteChart(repo, "app", ""), ref: "repo/app", pull: "pull repo/app --destination {dir}"},
+		{name: "latest offline", chart: remoteChart(repo, "app", ""), index: true, cached: []string{"1.1.0"}, offline: true, ref: "app-1.1.0.tgz", usingCache: true},
+		{name: "latest offline from environment", chart: remoteChart(repo, "app", ""), index: true, cached: []string{"1.1.0"}, offlineEnv: true, ref: "app-1.1.0.tgz", usingCache: true},
+		{name: "latest offline not cached", chart: remoteChart(repo, "app", ""), index: true, cached: []string{"1.0.0"}, offline: true, err: "version 1.1.0 has not been cached"},
+		{name: "latest offline without index", chart: remoteChart(repo, "app", ""), offline: true, err: "Index of helm repo repo has not been cached"},
+		{name: "latest offline not in index", chart: remoteChart(repo, "other", ""), index: true, offline: true, err: "has no chart other"},
+		{name: "OCI", chart: ociChart("example.com", "charts/app", "1.0.0"), ref: "app-1.0.0.tgz", usingCache: true, pull: "pull oci://example.com/charts/app --destination {dir} --version 1.0.0"},
+		{name: "OCI latest offline", chart: ociChart("example.com", "charts/app", ""), offline: true, err: "must have a version to be used offline"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			offlineEnv := ""
+			if tc.offlineEnv {
+				offlineEnv = "true"
+			}
+			t.Setenv(HelmOfflineEnv, offlineEnv)
+			h, log := loggingHelm(t)
+			h.Offline = tc.offline
+			h.UseUserHome = tc.useUserHome
+			dir := ""
+			if !tc.chart.IsLocal() {
+				dir = h.chartPullDir(tc.chart)
+			}
+			for _, version := range tc.cached {
+				writeFile(t, h.cachedChartPath(tc.chart, version), "")
+			}
+			if tc.index {
+				writeFile(t, h.repoIndexPath(repo.Name), index)
+			}
+
+			ref, fetch, usingCache, err := h.chartRef(context.Background(), tc.chart)
+			checkErr(t, err, tc.err)
+			if err != nil {
+				return
+			}
+			expectedRef := tc.ref
+			if tc.usingCache {
+				expectedRef = filepath.Join(dir, tc.ref)
+			}
+			if ref != expectedRef || usingCache != tc.usingCache {
+				t.Errorf("expected (%s, %v), got (%s, %v)", expectedRef, tc.usingCache, ref, usingCache)
+			}
+			if (fetch != nil) != (tc.pull != "") {
+				t.Fatalf("expected fetch=%v, got %v", tc.pull != "", fetch != nil)
+			}
+			if fetch == nil {
+				return
+			}
+			err = fetch.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := strings.ReplaceAll(tc.pull, "{dir}", dir)
+			if got := strings.Join(readLog(t, log), "\n"); got != expected {
+				t.Errorf("expected helm to be run as %q, got %q", expected, got)
+			}
+			if _, err := os.Stat(dir); err != nil {
+				t.Errorf("expected the directory to pull to to be created: %v", err)
+			}
+		})
+	}
+}
+
+func TestOfflineAddRepo(t *testing.T) {
+	repo := &HelmRepo{Name: "repo", URL: "https://example.com/charts"}
+	repositories := `
+repositories:
+- name: other
+  url: https://example.com/other
+- name: repo
+  url: https://example.com/charts
+`
+	cases := []struct {
+		name         string
+		repo         *HelmRepo
+		repositories string
+		index        bool
+		useUserHome  bool
+		err          string
+	}{
+		{name: "cached", repo: repo, repositories: repositories, index: true},
+		{name: "not added", repo: repo, err: "has not been cached"},
+		{name: "no index", repo: repo, repositories: repositories, err: "has not been cached"},
+		{name: "different URL", repo: &HelmRepo{Name: "repo", URL: "https://example.com/moved"}, repositories: repositories, index: true, err: "has not been cached"},
+		{name: "user home", repo: repo, repositories: repositories, index: true, useUserHome: true, err: "cannot be used offline with UseUserHome"},
+		{name: "invalid", repo: repo, repositories: "repositories: {", err: "yaml"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, log := loggingHelm(t)
+			h.Offline = true
+			h.UseUserHome = tc.useUserHome
+			if tc.repositories != "" {
+				writeFile(t, filepath.Join(h.configHome(), "repositories.yaml"), tc.repositories)
+			}
+			if tc.index {
+				writeFile(t, h.repoIndexPath(repo.Name), "entries: {}")
+			}
+			checkErr(t, h.AddRepo(context.Background(), tc.repo).Run(), tc.err)
+			if got := readLog(t, log); len(got) != 0 {
+				t.Errorf("expected helm not to be run offline, got %v", got)
+			}
+		})
+	}
+}
+
+func TestHelmEnv(t *testing.T) {
+	h := &HelmCommand{Home: "/home"}
+	env := h.env()
+	if env["HELM_CONFIG_HOME"] != filepath.Join("/home", "config") || env["HELM_CACHE_HOME"] != filepath.Join("/home", "cache") {
+		t.Errorf("expected helm to be isolated to its home, got %v", env)
+	}
+	h.UseUserHome = true
+	if h.env() != nil {
+		t.Errorf("expected the user's home to be used, got %v", h.env())
+	}
+	h = &HelmCommand{}
+	if h.configHome() != filepath.Join(DefaultHelmHome(), "config") {
+		t.Errorf("expected the default home to be used, got %s", h.configHome())
+	}
+}
@@ -3,15 +3,19 @@ package gingk8s
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/meln5674/gosh"
-	. "github.com/onsi/ginkgo/v2"
-	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
 	"sigs.k8s.io/yaml"
 )
 
@@ -25,9 +29,23 @@ type HelmCommand struct {
 	// Command is the command to execute for helm.
 	// If absent, $PATH is used
 	Command []string
+	// Home is the directory that helm's configuration, such as repos and registry logins, and its cache, such as repo indexes,
+	// are kept in instead of the user's own, so that suites do not modify them. Remote and OCI charts are pulled into this cache
+	// before they are installed. If absent, DefaultHelmHome() is used.
+	Home string
+	// UseUserHome, if true, uses the user's own helm configuration and cache instead of Home
+	UseUserHome bool
+	// Offline, if true, uses the repos and charts cached in Home by previous runs instead of fetching them, and does not
+	// update the dependencies of local charts, using what is already in their charts/ directory. See also HelmOfflineEnv.
+	// Only charts with an exact version, or no version, can be used offline. It cannot be combined with UseUserHome.
+	Offline bool
 }
 
 var _ = Helm(&HelmCommand{})
+var _ = HelmTemplater(&HelmCommand{})
+var _ = HelmRollbacker(&HelmCommand{})
+var _ = HelmTester(&HelmCommand{})
+var _ = HelmDiffer(&HelmCommand{})
 
 func (h *HelmCommand) Helm(ctx context.Context, kube *KubernetesConnection, args ...string) *gosh.Cmd {
 	return h.helm(ctx, kube, args)
@@ -47,14 +65,40 @@ func (h *HelmCommand) helm(ctx context.Context, kube *KubernetesConnection, args
 		cmd = append(cmd, "--context", kube.Context)
 	}
 	cmd = append(cmd, args...)
-	return gosh.Command(cmd...).WithContext(ctx).WithStreams(GinkgoOutErr).WithLog(log)
+	return gosh.Command(cmd...).WithContext(ctx).WithParentEnvAnd(h.env()).WithStreams(outErrStreams(ctx)).WithLog(log)
 }
 
 // AddRepo implements Helm
 func (h *HelmCommand) AddRepo(ctx context.Context, repo *HelmRepo) gosh.Commander {
+	if h.offline() {
+		if h.UseUserHome {
+			return gosh.FromFunc(ctx, Error(errOfflineUserHome()))
+		}
+		cached, err := h.repoCached(repo)
+		if err != nil {
+			return gosh.FromFunc(ctx, Error(err))
+		}
+		if !cached {
+			return gosh.FromFunc(ctx, Error(fmt.Errorf("Helm repo %s has not been cached", repo.Name)))
+		}
+		return noopCommander(ctx)
+	}
 	args := []string{"repo", "add", repo.Name, repo.URL}
 	args = append(args, repo.Flags...)
+	if repo.UsernameFile != "" {
+		username, err := os.ReadFile(repo.UsernameFile)
+		if err != nil {
+			return gosh.FromFunc(ctx, Error(err))
+		}
+		args = append(args, "--username", strings.TrimSpace(string(username)))
+	}
+	if repo.PasswordFile != "" {
+		args = append(args, "--password-stdin")
+	}
 	add := h.helm(ctx, &KubernetesConnection{}, args)
+	if repo.PasswordFile != "" {
+		add = add.WithStreams(gosh.FileIn(repo.PasswordFile))
+	}
 	if !repo.Update {
 		return add
 	}
@@ -71,14 +115,44 @@ func (h *HelmCommand) RegistryLogin(ctx context.Context, registry *HelmRegistry)
 
 // InstallOrUpgrade implements Helm
 func (h *HelmCommand) InstallOrUpgrade(g Gingk8s, ctx context.Context, cluster Cluster, release *HelmRelease) gosh.Commander {
-	cmds := []gosh.Commander{}
-
-	args := []string{"upgrade", "--install", release.Name, release.Chart.Fullname()}
+	cmds, args, err := h.upgrade(g, ctx, cluster, release)
+	if err != nil {
+		return gosh.FromFunc(ctx, Error(err))
+	}
 	if !release.NoWait {
 		args = append(args, "--wait")
 	}
+
+	conn := cluster.GetConnection()
+	cmds = append(cmds, h.helm(ctx, conn, args))
+
+	if len(release.Wait) != 0 {
+		cmds = append(cmds, g.KubectlWait(ctx, cluster, release.Wait...))
+	}
+
+	if release.Output != nil {
+		cmds = append(cmds, h.getOutput(ctx, conn, release))
+	}
+
+	return gosh.And(cmds...)
+}
+
+// upgrade returns the arguments to `helm upgrade --install` a release, and the commands which must be run first,
+// e.g. to fetch its chart and write its values
+func (h *HelmCommand) upgrade(g Gingk8s, ctx context.Context, cluster Cluster, release *HelmRelease) ([]gosh.Commander, []string, error) {
+	cmds := []gosh.Commander{}
+
+	chartRef, fetch, usingCache, err := h.chartRef(ctx, release.Chart)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fetch != nil {
+		cmds = append(cmds, fetch)
+	}
+
+	args := []string{"upgrade", "--install", release.Name, chartRef}
 	version := release.Chart.Version()
-	if version != "" {
+	if version != "" && !usingCache {
 		args = append(args, "--version", version)
 	}
 	args = append(args, release.Chart.UpgradeFlags...)
@@ -87,10 +161,145 @@ func (h *HelmCommand) InstallOrUpgrade(g Gingk8s, ctx context.Context, cluster C
 	if release.Namespace != "" {
 		args = append(args, "--namespace", release.Namespace)
 	}
+
+	namespacePathPart := release.Namespace
+	if namespacePathPart == "" {
+		namespacePathPart = "_DEFAULT_"
+	}
+	valueDir := filepath.Join(ClusterTempPath(cluster, "helm", "releases", namespacePathPart, release.Name, "values"))
+	setArgs, writeValues, err := valueArgs(g, ctx, cluster, release, valueDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	args = append(args, setArgs...)
+	if writeValues != nil {
+		cmds = append(cmds, writeValues)
+	}
+
+	if release.Chart.LocalChartInfo.DependencyUpdate && !h.offline() {
+		cmds = append(cmds, h.helm(ctx, cluster.GetConnection(), []string{"dependency", "update", release.Chart.Fullname()}))
+	}
+
+	return cmds, args, nil
+}
+
+// Diff implements HelmDiffer
+func (h *HelmCommand) Diff(g Gingk8s, ctx context.Context, cluster Cluster, release *HelmRelease) (string, error) {
+	conn := cluster.GetConnection()
+	namespaceArgs := []string{}
+	if release.Namespace != "" {
+		namespaceArgs = append(namespaceArgs, "--namespace", release.Namespace)
+	}
+
+	var deployed []struct {
+		Name string `json:"name"`
+	}
+	listArgs := append([]string{"list", "--filter", "^" + regexp.QuoteMeta(release.Name) + "$", "--output", "json"}, namespaceArgs...)
+	err := h.helm(ctx, conn, listArgs).WithStreams(gosh.FuncOut(gosh.SaveJSON(&deployed))).Run()
+	if err != nil {
+		return "", err
+	}
+	if len(deployed) == 0 {
+		return "", nil
+	}
+
+	cmds, args, err := h.upgrade(g, ctx, cluster, release)
+	if err != nil {
+		return "", err
+	}
+	args = append(args, "--dry-run", "--output", "json")
+	var rendered struct {
+		Manifest string `json:"manifest"`
+	}
+	var current []unstructured.Unstructured
+	getArgs := append([]string{"get", "manifest", release.Name}, namespaceArgs...)
+	cmds = append(
+		cmds,
+		h.helm(ctx, conn, getArgs).WithStreams(gosh.FuncOut(func(stdout io.Reader) error {
+			var err error
+			current, err = parseObjects(stdout)
+			return err
+		})),
+		h.helm(ctx, conn, args).WithStreams(gosh.FuncOut(gosh.SaveJSON(&rendered))),
+	)
+	err = gosh.And(cmds...).Run()
+	if err != nil {
+		return "", err
+	}
+	next, err := parseObjects(strings.NewReader(rendered.Manifest))
+	if err != nil {
+		return "", err
+	}
+	return diffObjects(current, next), nil
+}
+
+// Template implements HelmTemplater
+func (h *HelmCommand) Template(g Gingk8s, ctx context.Context, release *HelmRelease) ([]unstructured.Unstructured, error) {
+	cmds := []gosh.Commander{}
+
+	chartRef, fetch, usingCache, err := h.chartRef(ctx, release.Chart)
+	if err != nil {
+		return nil, err
+	}
+	if fetch != nil {
+		cmds = append(cmds, fetch)
+	}
+
+	args := []string{"template", release.Name, chartRef, "--no-hooks"}
+	version := release.Chart.Version()
+	if version != "" && !usingCache {
+		args = append(args, "--version", version)
+	}
+	args = append(args, release.Chart.UpgradeFlags...)
+	args = append(args, release.ExtraFlags...)
+	args = append(args, release.UpgradeFlags...)
+	if release.Namespace != "" {
+		args = append(args, "--namespace", release.Namespace)
+	}
+
+	valueDir, err := os.MkdirTemp("", "gingk8s-template-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(valueDir)
+	setArgs, writeValues, err := valueArgs(g, ctx, nil, release, valueDir)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, setArgs...)
+	if writeValues != nil {
+		cmds = append(cmds, writeValues)
+	}
+
+	conn := &KubernetesConnection{}
+	if release.Chart.LocalChartInfo.DependencyUpdate && !h.offline() {
+		cmds = append(cmds, h.helm(ctx, conn, []string{"dependency", "update", release.Chart.Fullname()}))
+	}
+
+	var objects []unstructured.Unstructured
+	cmds = append(cmds, h.helm(ctx, conn, args).WithStreams(gosh.FuncOut(func(stdout io.Reader) error {
+		var err error
+		objects, err = parseObjects(stdout)
+		return err
+	})))
+
+	err = gosh.And(cmds...).Run()
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// valueArgs returns the flags to pass the values of a release to helm, resolved against a cluster, which may be nil.
+// If the release has Values, they are written to files in valueDir by the returned command, which must be run first.
+func valueArgs(g Gingk8s, ctx context.Context, cluster Cluster, release *HelmRelease, valueDir string) ([]string, gosh.Commander, error) {
+	args := []string{}
 	for k, v := range release.Set {
 		s := strings.Builder{}
 		err := valueString(g, ctx, cluster, &s, v)
-		Expect(err).ToNot(HaveOccurred())
+		if err != nil {
+			return nil, nil, err
+		}
 		args = append(args, "--set", fmt.Sprintf("%s=%s", k, s.String()))
 	}
 	for k, v := range release.SetString {
@@ -101,73 +310,231 @@ func (h *HelmCommand) InstallOrUpgrade(g Gingk8s, ctx context.Context, cluster C
 	}
 	for k, v := range release.SetJSON {
 		vBytes, err := json.Marshal(v)
-		Expect(err).ToNot(HaveOccurred())
+		if err != nil {
+			return nil, nil, err
+		}
 		args = append(args, "--set-json", k+"="+string(vBytes))
 	}
 	for _, v := range release.ValuesFiles {
 		args = append(args, "--values", v)
 	}
 
-	conn := cluster.GetConnection()
-	if len(release.Values) != 0 {
-		namespacePathPart := release.Namespace
-		if namespacePathPart == "" {
-			namespacePathPart = "_DEFAULT_"
-		}
-		valueDir := filepath.Join(ClusterTempPath(cluster, "helm", "releases", namespacePathPart, release.Name, "values"))
-		tempValueBasename := func(ix int) string {
-			return fmt.Sprintf("%d.yaml", ix)
-		}
-		tempValuePath := func(ix int) string {
-			return filepath.Join(valueDir, tempValueBasename(ix))
-		}
-		mktemp := gosh.FromFunc(ctx, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
-			go func() {
-				defer GinkgoRecover()
-				var err error
-				defer func() { done <- err; close(done) }()
-				err = os.MkdirAll(valueDir, 0700)
-				if err != nil {
-					return
-				}
-				err = func() error {
-					for ix, v := range release.Values {
-						resolved, err := resolveNestedObject(g, ctx, cluster, v)
-						if err != nil {
-							return err
-						}
-						valuesYAML, err := yaml.Marshal(resolved)
-						if err != nil {
-							return err
-						}
-						valuesPath := tempValuePath(ix)
-						err = os.WriteFile(valuesPath, valuesYAML, 0600)
-						if err != nil {
-							return err
-						}
+	if len(release.Values) == 0 {
+		return args, nil, nil
+	}
+	tempValueBasename := func(ix int) string {
+		return fmt.Sprintf("%d.yaml", ix)
+	}
+	tempValuePath := func(ix int) string {
+		return filepath.Join(valueDir, tempValueBasename(ix))
+	}
+	mktemp := gosh.FromFunc(ctx, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
+		go func() {
+			var err error
+			defer func() { done <- err; close(done) }()
+			defer recoverError(&err)
+			err = os.MkdirAll(valueDir, 0700)
+			if err != nil {
+				return
+			}
+			err = func() error {
+				for ix, v := range release.Values {
+					resolved, err := resolveNestedObject(g, ctx, cluster, v)
+					if err != nil {
+						return err
+					}
+					valuesYAML, err := yaml.Marshal(resolved)
+					if err != nil {
+						return err
+					}
+					valuesPath := tempValuePath(ix)
+					err = os.WriteFile(valuesPath, valuesYAML, 0600)
+					if err != nil {
+						return err
 					}
-					return nil
-				}()
+				}
+				return nil
 			}()
+		}()
+		return nil
+	})
+	for ix := range release.Values {
+		args = append(args, "--values", tempValuePath(ix))
+	}
+	return args, mktemp, nil
+}
+
+// helmStatus is the subset of the output of `helm status -o json` used to populate a HelmReleaseOutput
+type helmStatus struct {
+	Version int `json:"version"`
+	Info    struct {
+		Status string `json:"status"`
+		Notes  string `json:"notes"`
+	} `json:"info"`
+	Manifest string `json:"manifest"`
+	Hooks    []struct {
+		Name    string   `json:"name"`
+		Kind    string   `json:"kind"`
+		Events  []string `json:"events"`
+		LastRun struct {
+			Phase string `json:"phase"`
+		} `json:"last_run"`
+	} `json:"hooks"`
+}
+
+// status returns the status of a release
+func (h *HelmCommand) status(ctx context.Context, conn *KubernetesConnection, release *HelmRelease, status *helmStatus) gosh.Commander {
+	args := []string{"status", release.Name, "--output", "json"}
+	if release.Namespace != "" {
+		args = append(args, "--namespace", release.Namespace)
+	}
+	return h.helm(ctx, conn, args).WithStreams(gosh.FuncOut(gosh.SaveJSON(status)))
+}
+
+// getOutput populates the output of a release from `helm status` and `helm get values`
+func (h *HelmCommand) getOutput(ctx context.Context, conn *KubernetesConnection, release *HelmRelease) gosh.Commander {
+	var status helmStatus
+	var values map[string]interface{}
+	namespaceArgs := []string{}
+	if release.Namespace != "" {
+		namespaceArgs = append(namespaceArgs, "--namespace", release.Namespace)
+	}
+	valuesArgs := append([]string{"get", "values", release.Name, "--all", "--output", "json"}, namespaceArgs...)
+	return gosh.And(
+		h.status(ctx, conn, release, &status),
+		h.helm(ctx, conn, valuesArgs).WithStreams(gosh.FuncOut(gosh.SaveJSON(&values))),
+		gosh.FromFunc(ctx, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
+			objects, err := parseObjects(strings.NewReader(status.Manifest))
+			if err != nil {
+				return err
+			}
+			*release.Output = HelmReleaseOutput{
+				Revision: status.Version,
+				Status:   status.Info.Status,
+				Notes:    status.Info.Notes,
+				Values:   values,
+				Objects:  objects,
+			}
+			close(done)
 			return nil
-		})
-		for ix := range release.Values {
-			args = append(args, "--values", tempValuePath(ix))
+		}),
+	)
+}
+
+// parseObjects parses a stream of YAML or JSON documents into objects, skipping empty documents.
+// As with unstructured objects decoded from the API server, integers are decoded as int64, not float64
+func parseObjects(r io.Reader) ([]unstructured.Unstructured, error) {
+	objects := []unstructured.Unstructured{}
+	dec := k8syaml.NewYAMLOrJSONDecoder(r, 1024)
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Empty documents, e.g. before a leading "---", or containing only comments, decode to nothing
+		if len(raw) == 0 {
+			continue
 		}
-		cmds = append(cmds, mktemp)
+		var obj map[string]interface{}
+		err = utiljson.Unmarshal(raw, &obj)
+		if err != nil {
+			return nil, err
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		objects = append(objects, unstructured.Unstructured{Object: obj})
 	}
+}
 
-	if release.Chart.LocalChartInfo.DependencyUpdate {
-		cmds = append(cmds, h.helm(ctx, conn, []string{"dependency", "update", release.Chart.Fullname()}))
+// Rollback implements HelmRollbacker
+func (h *HelmCommand) Rollback(ctx context.Context, cluster Cluster, release *HelmRelease, revision int) gosh.Commander {
+	args := []string{"rollback", release.Name}
+	if revision != 0 {
+		args = append(args, strconv.Itoa(revision))
 	}
+	if !release.NoWait {
+		args = append(args, "--wait")
+	}
+	if release.Namespace != "" {
+		args = append(args, "--namespace", release.Namespace)
+	}
+	args = append(args, release.ExtraFlags...)
+	return h.helm(ctx, cluster.GetConnection(), args)
+}
 
-	cmds = append(cmds, h.helm(ctx, conn, args))
+// Test implements HelmTester
+func (h *HelmCommand) Test(g Gingk8s, ctx context.Context, cluster Cluster, release *HelmRelease, test *HelmTest) gosh.Commander {
+	return gosh.FromFunc(ctx, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
+		go func() {
+			var err error
+			defer func() { done <- err; close(done) }()
+			defer recoverError(&err)
+			err = h.test(g, ctx, cluster, release, test)
+		}()
+		return nil
+	})
+}
 
-	if len(release.Wait) != 0 {
-		cmds = append(cmds, g.KubectlWait(ctx, cluster, release.Wait...))
+func (h *HelmCommand) test(g Gingk8s, ctx context.Context, cluster Cluster, release *HelmRelease, test *HelmTest) error {
+	conn := cluster.GetConnection()
+	args := []string{"test", release.Name}
+	if release.Namespace != "" {
+		args = append(args, "--namespace", release.Namespace)
+	}
+	if test.Timeout != 0 {
+		args = append(args, "--timeout", test.Timeout.String())
+	}
+	for _, filter := range test.Filter {
+		args = append(args, "--filter", filter)
 	}
+	args = append(args, test.Flags...)
+	testErr := h.helm(ctx, conn, args).Run()
 
-	return gosh.And(cmds...)
+	// helm test --logs doesn't show the logs of failed tests, so they are fetched separately
+	var status helmStatus
+	err := h.status(ctx, conn, release, &status).Run()
+	if err != nil {
+		if testErr != nil {
+			return testErr
+		}
+		return err
+	}
+	logs := strings.Builder{}
+	for _, hook := range status.Hooks {
+		if hook.Kind != "Pod" || !isTestHook(hook.Events) {
+			continue
+		}
+		fmt.Fprintf(&logs, "==> Pod %s (%s)\n", hook.Name, hook.LastRun.Phase)
+		logArgs := []string{"logs", "pod/" + hook.Name, "--all-containers", "--prefix"}
+		if release.Namespace != "" {
+			logArgs = append(logArgs, "--namespace", release.Namespace)
+		}
+		err := g.Kubectl(ctx, cluster, logArgs...).WithStreams(gosh.WriterOut(&logs)).Run()
+		if err != nil {
+			// Test pods may have already been deleted due to their hook-delete-policy
+			fmt.Fprintf(&logs, "Could not get logs: %v\n", err)
+		}
+	}
+	fmt.Fprint(outWriter(ctx), logs.String())
+	if testErr != nil {
+		return fmt.Errorf("Tests of helm release %s failed: %w\nTest pod logs:\n%s", release.Name, testErr, logs.String())
+	}
+	return nil
+}
+
+func isTestHook(events []string) bool {
+	for _, event := range events {
+		// test-success is the deprecated name for test
+		if event == "test" || event == "test-success" {
+			return true
+		}
+	}
+	return false
 }
 
 // Delete implements Helm
@@ -0,0 +1,227 @@
+package gingk8s
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseObjects(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		// err is a substring of the expected error, or empty if none is expected
+		err string
+		// objects are the kind/name of each expected object, in order
+		objects []string
+	}{
+		{name: "empty"},
+		{
+			name: "single document",
+			input: `
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: a}
+`,
+			objects: []string{"ConfigMap/a"},
+		},
+		{
+			name: "multiple documents",
+			input: `
+---
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: a}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: b}
+`,
+			objects: []string{"ConfigMap/a", "Deployment/b"},
+		},
+		{
+			name: "empty documents and comments",
+			input: `
+---
+# Source: chart/templates/empty.yaml
+---
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: a}
+---
+`,
+			objects: []string{"ConfigMap/a"},
+		},
+		{
+			name:    "JSON",
+			input:   `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a"}}`,
+			objects: []string{"ConfigMap/a"},
+		},
+		{
+			name:  "invalid",
+			input: "kind: [ConfigMap\n",
+			err:   "yaml",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			objects, err := parseObjects(strings.NewReader(tc.input))
+			checkErr(t, err, tc.err)
+			if err != nil {
+				return
+			}
+			got := make([]string, 0, len(objects))
+			for _, obj := range objects {
+				got = append(got, obj.GetKind()+"/"+obj.GetName())
+			}
+			if strings.Join(got, ",") != strings.Join(tc.objects, ",") {
+				t.Errorf("expected objects %v, got %v", tc.objects, got)
+			}
+		})
+	}
+}
+
+// helmScript is a HelmCommand which runs a shell script in place of helm, with its args
+func helmScript(t *testing.T, script string) *HelmCommand {
+	return &HelmCommand{Command: []string{"sh", "-c", script, "helm"}, Home: t.TempDir()}
+}
+
+func TestReleaseOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test helm is a shell script")
+	}
+	h := helmScript(t, `
+case "$1" in
+status)
+	[ "$2" = app ] && [ "$5" = --namespace ] && [ "$6" = app-ns ] || exit 1
+	cat <<'JSON'
+{
+	"version": 3,
+	"info": {"status": "deployed", "notes": "Thanks for installing"},
+	"manifest": "---\n# Source: chart/templates/cm.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata: {name: a}\n---\napiVersion: apps/v1\nkind: Deployment\nmetadata: {name: b}\n"
+}
+JSON
+	;;
+get) echo '{"replicas": 2, "image": {"tag": "1.0"}}' ;;
+esac
+`)
+	g := ForTest(t)
+	g.setDefaults()
+	cluster := &DummyCluster{Name: "test"}
+
+	output := &HelmReleaseOutput{}
+	release := &HelmRelease{
+		Name:      "app",
+		Namespace: "app-ns",
+		Chart:     &HelmChart{LocalChartInfo: LocalChartInfo{Path: "chart"}},
+		Output:    output,
+	}
+	err := h.InstallOrUpgrade(g, context.Background(), cluster, release).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.Revision != 3 || output.Status != "deployed" || output.Notes != "Thanks for installing" {
+		t.Errorf("unexpected status %#v", output)
+	}
+	if !reflect.DeepEqual(output.Values, map[string]interface{}{"replicas": float64(2), "image": map[string]interface{}{"tag": "1.0"}}) {
+		t.Errorf("unexpected values %#v", output.Values)
+	}
+	if len(output.Objects) != 2 || output.Objects[0].GetKind() != "ConfigMap" || output.Objects[1].GetName() != "b" {
+		t.Errorf("unexpected objects %#v", output.Objects)
+	}
+
+	// The output is not populated if the release could not be inspected
+	release.Namespace = "other"
+	output2 := &HelmReleaseOutput{}
+	release.Output = output2
+	err = h.InstallOrUpgrade(g, context.Background(), cluster, release).Run()
+	if err == nil {
+		t.Fatal("expected the failure to get the status of the release to fail the install")
+	}
+	if !reflect.DeepEqual(*output2, HelmReleaseOutput{}) {
+		t.Errorf("expected no output, got %#v", output2)
+	}
+}
+
+// loggingHelm is a HelmCommand which logs its args to a file instead of running helm, other than to print
+// a ConfigMap named after the release for `helm template`
+func loggingHelm(t *testing.T) (*HelmCommand, string) {
+	log := filepath.Join(t.TempDir(), "log")
+	h := helmScript(t, `
+echo "$*" >> "`+log+`"
+[ "$1" = template ] && printf 'apiVersion: v1\nkind: ConfigMap\nmetadata: {name: %s}\n' "$2"
+exit 0
+`)
+	h.UseUserHome = true
+	return h, log
+}
+
+// readLog returns the lines logged by a loggingHelm
+func readLog(t *testing.T, log string) []string {
+	t.Helper()
+	contents, err := os.ReadFile(log)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(contents)), "\n")
+}
+
+func TestTemplateRepos(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test helm is a shell script")
+	}
+	helm, log := loggingHelm(t)
+	g := ForTest(t)
+	g.Options(SuiteOpts{Helm: helm})
+	repo := &HelmRepo{Name: "repo", URL: "https://example.com/charts"}
+	remote := func(name string, repo *HelmRepo) *HelmRelease {
+		return &HelmRelease{Name: name, Chart: &HelmChart{RemoteChartInfo: RemoteChartInfo{Name: "chart", Repo: repo}}}
+	}
+
+	for _, name := range []string{"a", "b"} {
+		objects, err := g.ForSpec().Template(context.Background(), remote(name, repo))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(objects) != 1 || objects[0].GetName() != name {
+			t.Errorf("unexpected objects %#v", objects)
+		}
+	}
+	_, err := g.Template(context.Background(), &HelmRelease{Name: "local", Chart: &HelmChart{LocalChartInfo: LocalChartInfo{Path: "chart"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The repo is shared with releases installed by the suite
+	g.Release(g.Cluster(testCluster(t)), remote("installed", &HelmRepo{Name: "repo", URL: "https://example.com/charts"}))
+	if err := g.addRepos(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"repo add repo https://example.com/charts",
+		"template a repo/chart --no-hooks",
+		"template b repo/chart --no-hooks",
+		"template local ./chart --no-hooks",
+	}
+	if got := readLog(t, log); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected helm to be run as:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	_, err = g.Template(context.Background(), remote("conflict", &HelmRepo{Name: "repo", URL: "https://example.com/other"}))
+	checkErr(t, err, "conflicts with the one used by")
+	_, err = g.Template(context.Background(), remote("invalid", &HelmRepo{Name: "invalid"}))
+	checkErr(t, err, "has no URL")
+	_, err = g.Template(context.Background(), remote("none", nil))
+	checkErr(t, err, "has no repo")
+	if got := readLog(t, log); len(got) != len(expected) {
+		t.Errorf("expected helm not to be run for invalid repos, got:\n%s", strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,136 @@
+package gingk8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// HelmDiffer knows how to compare a release as it is deployed to what upgrading it would deploy
+type HelmDiffer interface {
+	// Diff returns the differences between the objects of a release as it is deployed and as they would be after upgrading it,
+	// or an empty string if there are none, or the release has not been deployed
+	Diff(g Gingk8s, ctx context.Context, cluster Cluster, release *HelmRelease) (string, error)
+}
+
+// diffRelease logs the differences an upgrade would make to a release, and returns an error if there are any and it is strict
+func diffRelease(g Gingk8s, ctx context.Context, state *specState, cluster Cluster, release *HelmRelease) error {
+	differ, ok := state.suite.opts.Helm.(HelmDiffer)
+	if !ok {
+		return fmt.Errorf("%T does not support diffing releases", state.suite.opts.Helm)
+	}
+	diff, err := differ.Diff(g, ctx, cluster, release)
+	if err != nil {
+		return err
+	}
+	if diff == "" {
+		return nil
+	}
+	fmt.Fprintf(outWriter(ctx), "Upgrading helm release %s in cluster %s will change:\n%s", release.Name, cluster.GetName(), diff)
+	if release.StrictDiff {
+		return fmt.Errorf("Helm release %s in cluster %s has drifted from what is deployed:\n%s", release.Name, cluster.GetName(), diff)
+	}
+	return nil
+}
+
+// objectKey identifies an object in a manifest
+func objectKey(obj *unstructured.Unstructured) string {
+	key := obj.GetAPIVersion() + " " + obj.GetKind() + " "
+	if obj.GetNamespace() != "" {
+		key += obj.GetNamespace() + "/"
+	}
+	return key + obj.GetName()
+}
+
+// diffObjects returns a human-readable description of the objects which were added, removed, or changed between two manifests,
+// and the fields which were changed, or an empty string if they are the same
+func diffObjects(current, next []unstructured.Unstructured) string {
+	currentByKey := make(map[string]*unstructured.Unstructured, len(current))
+	for ix := range current {
+		currentByKey[objectKey(&current[ix])] = &current[ix]
+	}
+	nextByKey := make(map[string]*unstructured.Unstructured, len(next))
+	for ix := range next {
+		nextByKey[objectKey(&next[ix])] = &next[ix]
+	}
+
+	diff := strings.Builder{}
+	for _, key := range sortedKeys(currentByKey) {
+		if _, ok := nextByKey[key]; !ok {
+			fmt.Fprintf(&diff, "- %s\n", key)
+		}
+	}
+	for _, key := range sortedKeys(nextByKey) {
+		currentObj, ok := currentByKey[key]
+		if !ok {
+			fmt.Fprintf(&diff, "+ %s\n", key)
+			continue
+		}
+		fields := []string{}
+		diffValues("", currentObj.Object, nextByKey[key].Object, &fields)
+		if len(fields) == 0 {
+			continue
+		}
+		fmt.Fprintf(&diff, "~ %s\n", key)
+		for _, field := range fields {
+			fmt.Fprintf(&diff, "    %s\n", field)
+		}
+	}
+	return diff.String()
+}
+
+// diffValues appends a line for each field which differs between two unstructured values to fields
+func diffValues(path string, current, next interface{}, fields *[]string) {
+	currentMap, currentIsMap := current.(map[string]interface{})
+	nextMap, nextIsMap := next.(map[string]interface{})
+	if currentIsMap && nextIsMap {
+		keys := make(map[string]interface{}, len(currentMap)+len(nextMap))
+		for k := range currentMap {
+			keys[k] = nil
+		}
+		for k := range nextMap {
+			keys[k] = nil
+		}
+		for _, k := range sortedKeys(keys) {
+			subPath := k
+			if path != "" {
+				subPath = path + "." + k
+			}
+			currentValue, currentOk := currentMap[k]
+			nextValue, nextOk := nextMap[k]
+			switch {
+			case !currentOk:
+				*fields = append(*fields, fmt.Sprintf("%s: <none> -> %s", subPath, diffString(nextValue)))
+			case !nextOk:
+				*fields = append(*fields, fmt.Sprintf("%s: %s -> <none>", subPath, diffString(currentValue)))
+			default:
+				diffValues(subPath, currentValue, nextValue, fields)
+			}
+		}
+		return
+	}
+	currentList, currentIsList := current.([]interface{})
+	nextList, nextIsList := next.([]interface{})
+	if currentIsList && nextIsList && len(currentList) == len(nextList) {
+		for ix := range currentList {
+			diffValues(fmt.Sprintf("%s[%d]", path, ix), currentList[ix], nextList[ix], fields)
+		}
+		return
+	}
+	if !reflect.DeepEqual(current, next) {
+		*fields = append(*fields, fmt.Sprintf("%s: %s -> %s", path, diffString(current), diffString(next)))
+	}
+}
+
+// diffString formats a value compactly for a diff
+func diffString(value interface{}) string {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(bytes)
+}
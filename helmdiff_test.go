@@ -0,0 +1,220 @@
+package gingk8s
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDiffValues(t *testing.T) {
+	cases := []struct {
+		name          string
+		current, next interface{}
+		fields        []string
+	}{
+		{
+			name:    "equal",
+			current: map[string]interface{}{"a": int64(1), "b": []interface{}{"x"}},
+			next:    map[string]interface{}{"a": int64(1), "b": []interface{}{"x"}},
+		},
+		{
+			name:    "scalar changed",
+			current: map[string]interface{}{"a": int64(1)},
+			next:    map[string]interface{}{"a": int64(2)},
+			fields:  []string{"a: 1 -> 2"},
+		},
+		{
+			name:    "type changed",
+			current: map[string]interface{}{"a": int64(1)},
+			next:    map[string]interface{}{"a": "1"},
+			fields:  []string{`a: 1 -> "1"`},
+		},
+		{
+			name:    "key added",
+			current: map[string]interface{}{},
+			next:    map[string]interface{}{"a": map[string]interface{}{"b": true}},
+			fields:  []string{`a: <none> -> {"b":true}`},
+		},
+		{
+			name:    "key removed",
+			current: map[string]interface{}{"a": "x", "b": "y"},
+			next:    map[string]interface{}{"b": "y"},
+			fields:  []string{`a: "x" -> <none>`},
+		},
+		{
+			name:    "nested change",
+			current: map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1), "paused": false}},
+			next:    map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(3), "paused": true}},
+			fields:  []string{"spec.paused: false -> true", "spec.replicas: 1 -> 3"},
+		},
+		{
+			name:    "list element changed",
+			current: map[string]interface{}{"l": []interface{}{map[string]interface{}{"image": "a:1"}, "x"}},
+			next:    map[string]interface{}{"l": []interface{}{map[string]interface{}{"image": "a:2"}, "x"}},
+			fields:  []string{`l[0].image: "a:1" -> "a:2"`},
+		},
+		{
+			name:    "list grew",
+			current: map[string]interface{}{"l": []interface{}{"x"}},
+			next:    map[string]interface{}{"l": []interface{}{"x", "y"}},
+			fields:  []string{`l: ["x"] -> ["x","y"]`},
+		},
+		{
+			name:    "list shrank",
+			current: map[string]interface{}{"l": []interface{}{"x", "y"}},
+			next:    map[string]interface{}{"l": []interface{}{}},
+			fields:  []string{`l: ["x","y"] -> []`},
+		},
+		{
+			name:    "map replaced by list",
+			current: map[string]interface{}{"a": map[string]interface{}{"b": "c"}},
+			next:    map[string]interface{}{"a": []interface{}{"b"}},
+			fields:  []string{`a: {"b":"c"} -> ["b"]`},
+		},
+		{
+			name:    "null value",
+			current: map[string]interface{}{"a": nil},
+			next:    map[string]interface{}{"a": "x"},
+			fields:  []string{`a: null -> "x"`},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fields := []string{}
+			diffValues("", tc.current, tc.next, &fields)
+			if strings.Join(fields, "\n") != strings.Join(tc.fields, "\n") {
+				t.Errorf("expected fields:\n%s\ngot:\n%s", strings.Join(tc.fields, "\n"), strings.Join(fields, "\n"))
+			}
+		})
+	}
+}
+
+func TestDiffObjects(t *testing.T) {
+	object := func(kind, namespace, name string, data map[string]interface{}) unstructured.Unstructured {
+		obj := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": kind}}
+		obj.SetName(name)
+		if namespace != "" {
+			obj.SetNamespace(namespace)
+		}
+		if data != nil {
+			obj.Object["data"] = data
+		}
+		return obj
+	}
+	cases := []struct {
+		name          string
+		current, next []unstructured.Unstructured
+		diff          string
+	}{
+		{
+			name:    "no objects",
+			current: nil,
+			next:    nil,
+		},
+		{
+			name:    "unchanged",
+			current: []unstructured.Unstructured{object("ConfigMap", "ns", "a", map[string]interface{}{"k": "v"})},
+			next:    []unstructured.Unstructured{object("ConfigMap", "ns", "a", map[string]interface{}{"k": "v"})},
+		},
+		{
+			name:    "reordered",
+			current: []unstructured.Unstructured{object("ConfigMap", "", "a", nil), object("Secret", "", "b", nil)},
+			next:    []unstructured.Unstructured{object("Secret", "", "b", nil), object("ConfigMap", "", "a", nil)},
+		},
+		{
+			name:    "added",
+			current: []unstructured.Unstructured{},
+			next:    []unstructured.Unstructured{object("ConfigMap", "ns", "a", nil)},
+			diff:    "+ v1 ConfigMap ns/a\n",
+		},
+		{
+			name:    "removed",
+			current: []unstructured.Unstructured{object("ConfigMap", "", "a", nil)},
+			next:    []unstructured.Unstructured{},
+			diff:    "- v1 ConfigMap a\n",
+		},
+		{
+			name:    "changed",
+			current: []unstructured.Unstructured{object("ConfigMap", "ns", "a", map[string]interface{}{"k": "v1"})},
+			next:    []unstructured.Unstructured{object("ConfigMap", "ns", "a", map[string]interface{}{"k": "v2", "k2": "v"})},
+			diff:    "~ v1 ConfigMap ns/a\n    data.k: \"v1\" -> \"v2\"\n    data.k2: <none> -> \"v\"\n",
+		},
+		{
+			name:    "moved namespace",
+			current: []unstructured.Unstructured{object("ConfigMap", "ns1", "a", nil)},
+			next:    []unstructured.Unstructured{object("ConfigMap", "ns2", "a", nil)},
+			diff:    "- v1 ConfigMap ns1/a\n+ v1 ConfigMap ns2/a\n",
+		},
+		{
+			name: "removals before additions and changes",
+			current: []unstructured.Unstructured{
+				object("ConfigMap", "", "b", map[string]interface{}{"k": "v"}),
+				object("ConfigMap", "", "c", nil),
+			},
+			next: []unstructured.Unstructured{
+				object("ConfigMap", "", "a", nil),
+				object("ConfigMap", "", "b", map[string]interface{}{}),
+			},
+			diff: "- v1 ConfigMap c\n+ v1 ConfigMap a\n~ v1 ConfigMap b\n    data.k: \"v\" -> <none>\n",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := diffObjects(tc.current, tc.next); diff != tc.diff {
+				t.Errorf("expected diff:\n%s\ngot:\n%s", tc.diff, diff)
+			}
+		})
+	}
+}
+
+// staticDiffer is a Helm which always returns the same diff
+type staticDiffer struct {
+	Helm
+	diff string
+}
+
+func (d staticDiffer) Diff(g Gingk8s, ctx context.Context, cluster Cluster, release *HelmRelease) (string, error) {
+	return d.diff, nil
+}
+
+func TestDiffRelease(t *testing.T) {
+	cases := []struct {
+		name   string
+		helm   Helm
+		strict bool
+		output string
+		err    string
+	}{
+		{name: "unchanged", helm: staticDiffer{}},
+		{
+			name:   "changed",
+			helm:   staticDiffer{diff: "+ v1 ConfigMap a\n"},
+			output: "Upgrading helm release app in cluster test will change:\n+ v1 ConfigMap a\n",
+		},
+		{
+			name:   "changed strict",
+			helm:   staticDiffer{diff: "+ v1 ConfigMap a\n"},
+			strict: true,
+			output: "Upgrading helm release app in cluster test will change:\n+ v1 ConfigMap a\n",
+			err:    "Helm release app in cluster test has drifted from what is deployed:\n+ v1 ConfigMap a",
+		},
+		{name: "unsupported", helm: recordingHelm{}, err: "does not support diffing releases"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := ForTest(t)
+			g.Options(SuiteOpts{Helm: tc.helm})
+			out := &bytes.Buffer{}
+			// The diff is written to the output of the context, not directly to the harness
+			ctx := WithOutput(context.Background(), out)
+			release := &HelmRelease{Name: "app", StrictDiff: tc.strict}
+			checkErr(t, diffRelease(g, ctx, g.specState, &DummyCluster{Name: "test"}, release), tc.err)
+			if out.String() != tc.output {
+				t.Errorf("expected output %q, got %q", tc.output, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package gingk8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/meln5674/gosh"
+)
+
+// HelmTest is a ClusterActionable which runs the tests of a release with `helm test`, and writes the logs of the test pods
+// to the output of the harness. If the tests fail, the logs are also included in the error. See Gingk8s.ReleaseTest.
+// SuiteOpts.Helm must implement HelmTester, which HelmCommand does.
+type HelmTest struct {
+	// Release is the release to test
+	Release ReleaseID
+	// Timeout is how long to wait for the tests to complete. If zero, helm's default is used.
+	Timeout time.Duration
+	// Filter is a list of --filter arguments, e.g. name=my-test or !name=my-other-test
+	Filter []string
+	// Flags are any extra flags to pass to `helm test`
+	Flags []string
+}
+
+var _ = ClusterActionable(&HelmTest{})
+
+// HelmTester knows how to run the tests of helm releases
+type HelmTester interface {
+	// Test runs the tests of a release. It fails if any of the tests fail.
+	Test(g Gingk8s, ctx context.Context, cluster Cluster, release *HelmRelease, test *HelmTest) gosh.Commander
+}
+
+// ReleaseTest registers a HelmTest for a release which runs once it has been installed
+func (g Gingk8s) ReleaseTest(cluster ClusterID, release ReleaseID, test *HelmTest, deps ...ResourceDependency) ClusterActionID {
+	test.Release = release
+	deps = append(deps, release)
+	return g.ClusterAction(cluster, fmt.Sprintf("Test helm release %s", g.getRelease(release.id).Name), test, deps...)
+}
+
+func (h *HelmTest) Setup(g Gingk8s, ctx context.Context, cluster Cluster) error {
+	release := g.getRelease(h.Release.id)
+	if release == nil {
+		return fmt.Errorf("No release with ID %s", h.Release.id)
+	}
+	tester, ok := g.suite.opts.Helm.(HelmTester)
+	if !ok {
+		return fmt.Errorf("%T does not support testing releases", g.suite.opts.Helm)
+	}
+	return tester.Test(g, ctx, cluster, release, h).Run()
+}
+
+func (h *HelmTest) Cleanup(g Gingk8s, ctx context.Context, cluster Cluster) error {
+	return nil
+}
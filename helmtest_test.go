@@ -0,0 +1,127 @@
+package gingk8s
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meln5674/gosh"
+)
+
+// testStatus is the output of `helm status` for a release with test hooks
+const testStatus = `{
+	"version": 1,
+	"hooks": [
+		{"name": "app-test", "kind": "Pod", "events": ["test"], "last_run": {"phase": "Succeeded"}},
+		{"name": "app-test-old", "kind": "Pod", "events": ["test-success"], "last_run": {"phase": "Failed"}},
+		{"name": "app-test-deleted", "kind": "Pod", "events": ["test"], "last_run": {"phase": "Succeeded"}},
+		{"name": "app-test-config", "kind": "ConfigMap", "events": ["test"]},
+		{"name": "app-migrate", "kind": "Pod", "events": ["pre-install"], "last_run": {"phase": "Succeeded"}}
+	]
+}`
+
+func TestHelmCommandTest(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test helm and kubectl are shell scripts")
+	}
+	cases := []struct {
+		name string
+		// testExit and statusExit are the exit codes of `helm test` and `helm status`
+		testExit, statusExit int
+		err                  string
+		// logs, if true, expects the logs of the test pods to be written to the output
+		logs bool
+	}{
+		{name: "success", logs: true},
+		{name: "failure", testExit: 1, err: "Tests of helm release app failed: exit status 1\nTest pod logs:\n==> Pod app-test (Succeeded)", logs: true},
+		{name: "failure without status", testExit: 1, statusExit: 1, err: "exit status 1"},
+		{name: "status failure", statusExit: 2, err: "exit status 2"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			helm, log := loggingHelm(t)
+			helm.Command = []string{"sh", "-c", fmt.Sprintf(`
+echo "$*" >> "%s"
+case "$1" in
+test) exit %d ;;
+status) cat <<'JSON'
+%s
+JSON
+	exit %d ;;
+esac
+`, log, tc.testExit, testStatus, tc.statusExit), "helm"}
+			g := ForTest(t)
+			g.Options(SuiteOpts{Kubectl: scriptKubectl(`
+shift
+[ "$2" = pod/app-test-deleted ] && echo "pods not found" >&2 && exit 1
+echo "[$2/main] $*"
+`)})
+			out := &bytes.Buffer{}
+			ctx := WithOutput(context.Background(), out)
+			release := &HelmRelease{Name: "app", Namespace: "ns"}
+			test := &HelmTest{Timeout: time.Minute, Filter: []string{"name=app-test"}, Flags: []string{"--logs"}}
+
+			checkErr(t, helm.Test(g, ctx, &DummyCluster{Name: "test"}, release, test).Run(), tc.err)
+
+			expected := "test app --namespace ns --timeout 1m0s --filter name=app-test --logs\nstatus app --output json --namespace ns"
+			if got := strings.Join(readLog(t, log), "\n"); got != expected {
+				t.Errorf("expected helm to be run as:\n%s\ngot:\n%s", expected, got)
+			}
+			logs := strings.Join([]string{
+				"==> Pod app-test (Succeeded)",
+				"[pod/app-test/main] logs pod/app-test --all-containers --prefix --namespace ns",
+				"==> Pod app-test-old (Failed)",
+				"[pod/app-test-old/main] logs pod/app-test-old --all-containers --prefix --namespace ns",
+				"==> Pod app-test-deleted (Succeeded)",
+				"Could not get logs: exit status 1",
+			}, "\n")
+			if strings.Contains(out.String(), logs) != tc.logs {
+				t.Errorf("expected logs=%v in output:\n%s", tc.logs, out.String())
+			}
+		})
+	}
+}
+
+// recordingHelmTester is a recordingHelm which also records the tests it is asked to run
+type recordingHelmTester struct {
+	recordingHelm
+}
+
+func (h recordingHelmTester) Test(g Gingk8s, ctx context.Context, cluster Cluster, release *HelmRelease, test *HelmTest) gosh.Commander {
+	return recordCommander(ctx, h.r, fmt.Sprintf("test %s/%s %v", release.Namespace, release.Name, test.Filter))
+}
+
+func TestReleaseTest(t *testing.T) {
+	r := &recorder{}
+	h := newManualHarness(t)
+	g := New(h)
+	g.Options(SuiteOpts{Helm: recordingHelmTester{recordingHelm{r: r}}, Kubectl: scriptKubectl("exit 0")})
+	cluster := g.Cluster(testCluster(t))
+	release := g.Release(cluster, &HelmRelease{Name: "app", Namespace: "ns", Chart: localChart("chart")})
+	test := g.ReleaseTest(cluster, release, &HelmTest{Filter: []string{"name=a"}})
+	g.ClusterAction(cluster, "after", r.action("after"), test)
+
+	if title := g.setup[len(g.setup)-2].Title(g.specState); title != "Execute action Test helm release app in cluster test" {
+		t.Errorf("unexpected title %q", title)
+	}
+	if err := g.TrySetup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	h.cleanup()
+	expected := "install ns/app ./chart,test ns/app [name=a],setup after,cleanup after,delete ns/app"
+	if events := r.get(); events != expected {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+
+	g = ForTest(t)
+	g.Options(SuiteOpts{Helm: recordingHelm{r: r}})
+	err := (&HelmTest{Release: release}).Setup(g, context.Background(), &DummyCluster{})
+	checkErr(t, err, "No release with ID")
+	release = g.Release(g.Cluster(testCluster(t)), &HelmRelease{Name: "app", Chart: localChart("chart")})
+	err = (&HelmTest{Release: release}).Setup(g, context.Background(), &DummyCluster{})
+	checkErr(t, err, "does not support testing releases")
+}
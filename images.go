@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -11,7 +12,6 @@ import (
 	"github.com/google/go-containerregistry/pkg/crane"
 
 	"github.com/meln5674/gosh"
-	. "github.com/onsi/ginkgo/v2"
 )
 
 const (
@@ -32,6 +32,14 @@ type ThirdPartyImageID struct {
 	id string
 }
 
+func (t ThirdPartyImageID) serializeID() serializedID {
+	return serializedID{Kind: "ThirdPartyImage", ID: t.id}
+}
+
+func (t *ThirdPartyImageID) deserializeID(id serializedID) error {
+	return deserializeID("ThirdPartyImage", &t.id, id)
+}
+
 func (t ThirdPartyImageID) AddResourceDependency(dep *ResourceDependencies) {
 	dep.ThirdPartyImages = append(dep.ThirdPartyImages, t)
 }
@@ -60,7 +68,7 @@ func (g Gingk8s) ThirdPartyImages(images ...*ThirdPartyImage) ThirdPartyImageIDs
 		newID := newID()
 		newIDs = append(newIDs, ThirdPartyImageID{id: newID})
 		g.thirdPartyImages[newID] = images[ix]
-		g.setup = append(g.setup, &specNode{state: g.specState, id: newID, specAction: &pullThirdPartyImageAction{id: newID}})
+		g.setup = append(g.setup, &specNode{state: g.specState, id: newID, specAction: &pullThirdPartyImageAction{id: newID}, conditions: &images[ix].Conditions})
 	}
 	return newIDs
 }
@@ -69,6 +77,14 @@ type CustomImageID struct {
 	id string
 }
 
+func (t CustomImageID) serializeID() serializedID {
+	return serializedID{Kind: "CustomImage", ID: t.id}
+}
+
+func (t *CustomImageID) deserializeID(id serializedID) error {
+	return deserializeID("CustomImage", &t.id, id)
+}
+
 func (t CustomImageID) AddResourceDependency(dep *ResourceDependencies) {
 	dep.CustomImages = append(dep.CustomImages, t)
 }
@@ -97,7 +113,7 @@ func (g Gingk8s) CustomImages(images ...*CustomImage) CustomImageIDs {
 		newID := newID()
 		newIDs = append(newIDs, CustomImageID{id: newID})
 		g.customImages[newID] = images[ix]
-		g.setup = append(g.setup, &specNode{state: g.specState, id: newID, specAction: &buildCustomImageAction{id: newID}})
+		g.setup = append(g.setup, &specNode{state: g.specState, id: newID, specAction: &buildCustomImageAction{id: newID}, conditions: &images[ix].Conditions})
 	}
 	return newIDs
 }
@@ -108,16 +124,29 @@ type pullThirdPartyImageAction struct {
 
 func (p *pullThirdPartyImageAction) Setup(ctx context.Context, state *specState) error {
 	if state.suite.opts.NoPull {
-		By(fmt.Sprintf("SKIPPED: %s", p.Title(state)))
+		state.suite.By(fmt.Sprintf("SKIPPED: %s", p.Title(state)))
 		return nil
 	}
-	return state.suite.opts.Images.Pull(ctx, state.thirdPartyImages[p.id]).Run()
+	return state.suite.opts.Images.Pull(ctx, state.getThirdPartyImage(p.id)).Run()
 }
 
-func (p *pullThirdPartyImageAction) Cleanup(ctx context.Context, state *specState) {}
+func (p *pullThirdPartyImageAction) Cleanup(ctx context.Context, state *specState) error { return nil }
+
+func (p *pullThirdPartyImageAction) Fingerprint(ctx context.Context, state *specState, w io.Writer) error {
+	image := state.getThirdPartyImage(p.id)
+	return fingerprintFields(w, image.Name, image.Retag, image.NoPull)
+}
+
+func (p *pullThirdPartyImageAction) FingerprintClusterID() string {
+	return ""
+}
+
+func (p *pullThirdPartyImageAction) FingerprintName(state *specState) (string, string) {
+	return "", state.getThirdPartyImage(p.id).Name
+}
 
 func (p *pullThirdPartyImageAction) Title(state *specState) string {
-	return fmt.Sprintf("Pulling image %s", state.thirdPartyImages[p.id].Name)
+	return fmt.Sprintf("Pulling image %s", state.getThirdPartyImage(p.id).Name)
 }
 
 type buildCustomImageAction struct {
@@ -125,9 +154,9 @@ type buildCustomImageAction struct {
 }
 
 func (b *buildCustomImageAction) Setup(ctx context.Context, state *specState) error {
-	image := state.customImages[b.id]
+	image := state.getCustomImage(b.id)
 	if state.suite.opts.NoBuild {
-		By(fmt.Sprintf("SKIPPED: %s", b.Title(state)))
+		state.suite.By(fmt.Sprintf("SKIPPED: %s", b.Title(state)))
 		return nil
 	}
 	builder := image.Builder
@@ -137,10 +166,45 @@ func (b *buildCustomImageAction) Setup(ctx context.Context, state *specState) er
 	return builder.Build(ctx, image, state.suite.opts.CustomImageTag, state.suite.opts.ExtraCustomImageTags).Run()
 }
 
-func (b *buildCustomImageAction) Cleanup(ctx context.Context, state *specState) {}
+func (b *buildCustomImageAction) Cleanup(ctx context.Context, state *specState) error { return nil }
+
+// Fingerprint implements fingerprintedAction.
+// Extra tags are deliberately excluded, as the defaults are timestamps, and would always cause a re-build
+func (b *buildCustomImageAction) Fingerprint(ctx context.Context, state *specState, w io.Writer) error {
+	image := state.getCustomImage(b.id)
+	err := fingerprintFields(w, image.WithTag(state.suite.opts.CustomImageTag), image.Dockerfile, strings.Join(image.Flags, " "))
+	if err != nil {
+		return err
+	}
+	err = fingerprintStringMap(w, image.BuildArgs)
+	if err != nil {
+		return err
+	}
+	dir := image.ContextDir
+	if dir == "" {
+		dir = "."
+	}
+	err = fingerprintPath(w, dir, true)
+	if err != nil {
+		return err
+	}
+	if image.Dockerfile == "" {
+		return nil
+	}
+	// Dockerfiles are usually within the context directory, but not always
+	return fingerprintPath(w, image.Dockerfile, false)
+}
+
+func (b *buildCustomImageAction) FingerprintClusterID() string {
+	return ""
+}
+
+func (b *buildCustomImageAction) FingerprintName(state *specState) (string, string) {
+	return "", state.getCustomImage(b.id).WithTag(state.suite.opts.CustomImageTag)
+}
 
 func (b *buildCustomImageAction) Title(state *specState) string {
-	image := state.customImages[b.id]
+	image := state.getCustomImage(b.id)
 	return fmt.Sprintf("Building image %s", image.WithTag(state.suite.opts.CustomImageTag))
 }
 
@@ -153,16 +217,29 @@ type loadThirdPartyImageAction struct {
 
 func (l *loadThirdPartyImageAction) Setup(ctx context.Context, state *specState) error {
 	if state.suite.opts.NoLoadPulled {
-		By(fmt.Sprintf("SKIPPED: %s", l.Title(state)))
+		state.suite.By(fmt.Sprintf("SKIPPED: %s", l.Title(state)))
 		return nil
 	}
-	return state.getCluster(l.clusterID).LoadImages(ctx, state.suite.opts.Images, state.thirdPartyImageFormats[l.imageID], []string{state.thirdPartyImages[l.imageID].Name}, l.noCache).Run()
+	return state.getCluster(l.clusterID).LoadImages(ctx, state.suite.opts.Images, state.getThirdPartyImageFormat(l.imageID), []string{state.getThirdPartyImage(l.imageID).Name}, l.noCache).Run()
+}
+
+func (l *loadThirdPartyImageAction) Cleanup(ctx context.Context, state *specState) error { return nil }
+
+func (l *loadThirdPartyImageAction) Fingerprint(ctx context.Context, state *specState, w io.Writer) error {
+	image := state.getThirdPartyImage(l.imageID)
+	return fingerprintFields(w, image.Name, image.Retag, state.getCluster(l.clusterID).GetName())
+}
+
+func (l *loadThirdPartyImageAction) FingerprintClusterID() string {
+	return l.clusterID
 }
 
-func (l *loadThirdPartyImageAction) Cleanup(ctx context.Context, state *specState) {}
+func (l *loadThirdPartyImageAction) FingerprintName(state *specState) (string, string) {
+	return "", state.getThirdPartyImage(l.imageID).Name
+}
 
 func (l *loadThirdPartyImageAction) Title(state *specState) string {
-	return fmt.Sprintf("Loading image %s to cluster %s", state.thirdPartyImages[l.imageID].Name, state.clusters[l.clusterID].GetName())
+	return fmt.Sprintf("Loading image %s to cluster %s", state.getThirdPartyImage(l.imageID).Name, state.getCluster(l.clusterID).GetName())
 }
 
 type loadCustomImageAction struct {
@@ -174,20 +251,33 @@ type loadCustomImageAction struct {
 
 func (l *loadCustomImageAction) Setup(ctx context.Context, state *specState) error {
 	if state.suite.opts.NoLoadBuilt {
-		By(fmt.Sprintf("SKIPPED: %s", l.Title(state)))
+		state.suite.By(fmt.Sprintf("SKIPPED: %s", l.Title(state)))
 		return nil
 	}
-	allTags := []string{state.customImages[l.imageID].WithTag(state.suite.opts.CustomImageTag)}
+	allTags := []string{state.getCustomImage(l.imageID).WithTag(state.suite.opts.CustomImageTag)}
 	for _, extra := range state.suite.opts.ExtraCustomImageTags {
-		allTags = append(allTags, state.customImages[l.imageID].WithTag(extra))
+		allTags = append(allTags, state.getCustomImage(l.imageID).WithTag(extra))
 	}
-	return state.getCluster(l.clusterID).LoadImages(ctx, state.suite.opts.Images, state.customImageFormats[l.imageID], allTags, l.noCache).Run()
+	return state.getCluster(l.clusterID).LoadImages(ctx, state.suite.opts.Images, state.getCustomImageFormat(l.imageID), allTags, l.noCache).Run()
 }
 
-func (l *loadCustomImageAction) Cleanup(ctx context.Context, state *specState) {}
+func (l *loadCustomImageAction) Cleanup(ctx context.Context, state *specState) error { return nil }
+
+func (l *loadCustomImageAction) Fingerprint(ctx context.Context, state *specState, w io.Writer) error {
+	image := state.getCustomImage(l.imageID)
+	return fingerprintFields(w, image.WithTag(state.suite.opts.CustomImageTag), state.getCluster(l.clusterID).GetName())
+}
+
+func (l *loadCustomImageAction) FingerprintClusterID() string {
+	return l.clusterID
+}
+
+func (l *loadCustomImageAction) FingerprintName(state *specState) (string, string) {
+	return "", state.getCustomImage(l.imageID).WithTag(state.suite.opts.CustomImageTag)
+}
 
 func (l *loadCustomImageAction) Title(state *specState) string {
-	return fmt.Sprintf("Loading image %s to cluster %s", state.customImages[l.imageID].WithTag(state.suite.opts.CustomImageTag), state.clusters[l.clusterID].GetName())
+	return fmt.Sprintf("Loading image %s to cluster %s", state.getCustomImage(l.imageID).WithTag(state.suite.opts.CustomImageTag), state.getCluster(l.clusterID).GetName())
 }
 
 // ThirdPartyImage represents an externally hosted image to be pulled and loaded into the cluster
@@ -198,6 +288,8 @@ type ThirdPartyImage struct {
 	Retag string
 	// NoPull indicates the image should not be pulled, e.g. if its built by another local process outside of gingk8s
 	NoPull bool
+	// Conditions control if this image is pulled and loaded
+	Conditions
 }
 
 // CustomImage represents a custom image to be built from the local filesystem and loaded into the cluster
@@ -216,6 +308,8 @@ type CustomImage struct {
 	Flags []string
 	// Builder is the custom image builder, if present, otherwise, the default image builder will be used
 	Builder Images
+	// Conditions control if this image is built and loaded
+	Conditions
 }
 
 func (c *CustomImage) WithTag(tag string) string {
@@ -237,12 +331,22 @@ type ImageArchive struct {
 	NoPull bool
 	Path   string
 	Format ImageFormat
+	// Conditions control if this archive is pulled and loaded
+	Conditions
 }
 
 type ImageArchiveID struct {
 	id string
 }
 
+func (t ImageArchiveID) serializeID() serializedID {
+	return serializedID{Kind: "ImageArchive", ID: t.id}
+}
+
+func (t *ImageArchiveID) deserializeID(id serializedID) error {
+	return deserializeID("ImageArchive", &t.id, id)
+}
+
 func (t ImageArchiveID) AddResourceDependency(dep *ResourceDependencies) {
 	dep.ImageArchives = append(dep.ImageArchives, t)
 }
@@ -267,7 +371,7 @@ func (g Gingk8s) ImageArchives(archives ...*ImageArchive) ImageArchiveIDs {
 		newID := newID()
 		newIDs = append(newIDs, ImageArchiveID{id: newID})
 		g.imageArchives[newID] = archives[ix]
-		g.setup = append(g.setup, &specNode{state: g.specState, id: newID, specAction: &pullImageArchiveAction{id: newID}})
+		g.setup = append(g.setup, &specNode{state: g.specState, id: newID, specAction: &pullImageArchiveAction{id: newID}, conditions: &archives[ix].Conditions})
 	}
 	return newIDs
 }
@@ -281,28 +385,43 @@ type pullImageArchiveAction struct {
 }
 
 func (p *pullImageArchiveAction) Setup(ctx context.Context, state *specState) error {
-	if state.suite.opts.NoPull || state.imageArchives[p.id].Name == "" || state.imageArchives[p.id].NoPull {
-		By(fmt.Sprintf("SKIPPED: %s", p.Title(state)))
+	if state.suite.opts.NoPull || state.getImageArchive(p.id).Name == "" || state.getImageArchive(p.id).NoPull {
+		state.suite.By(fmt.Sprintf("SKIPPED: %s", p.Title(state)))
 		return nil
 	}
-	_, err := os.Stat(state.imageArchives[p.id].Path)
+	_, err := os.Stat(state.getImageArchive(p.id).Path)
 	if err == nil {
 		return nil
 	}
 	if !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
-	img, err := crane.Pull(state.imageArchives[p.id].Name)
+	img, err := crane.Pull(state.getImageArchive(p.id).Name)
 	if err != nil {
 		return err
 	}
-	return crane.Save(img, state.imageArchives[p.id].Name, state.imageArchives[p.id].Path)
+	return crane.Save(img, state.getImageArchive(p.id).Name, state.getImageArchive(p.id).Path)
+}
+
+func (p *pullImageArchiveAction) Cleanup(ctx context.Context, state *specState) error { return nil }
+
+func (p *pullImageArchiveAction) Fingerprint(ctx context.Context, state *specState, w io.Writer) error {
+	archive := state.getImageArchive(p.id)
+	return fingerprintFields(w, archive.Name, archive.Path, archive.NoPull)
 }
 
-func (p *pullImageArchiveAction) Cleanup(ctx context.Context, state *specState) {}
+func (p *pullImageArchiveAction) FingerprintClusterID() string {
+	return ""
+}
+
+// FingerprintName implements fingerprintedAction.
+// The same image may be pulled to multiple archives, so the path identifies the archive instead.
+func (p *pullImageArchiveAction) FingerprintName(state *specState) (string, string) {
+	return "", state.getImageArchive(p.id).Path
+}
 
 func (p *pullImageArchiveAction) Title(state *specState) string {
-	return fmt.Sprintf("Pulling image %s to archive %s", state.imageArchives[p.id].Name, state.imageArchives[p.id].Path)
+	return fmt.Sprintf("Pulling image %s to archive %s", state.getImageArchive(p.id).Name, state.getImageArchive(p.id).Path)
 }
 
 type loadImageArchiveAction struct {
@@ -314,16 +433,29 @@ type loadImageArchiveAction struct {
 
 func (l *loadImageArchiveAction) Setup(ctx context.Context, state *specState) error {
 	if state.suite.opts.NoLoadPulled {
-		By(fmt.Sprintf("SKIPPED: %s", l.Title(state)))
+		state.suite.By(fmt.Sprintf("SKIPPED: %s", l.Title(state)))
 		return nil
 	}
-	return state.getCluster(l.clusterID).LoadImageArchives(ctx, state.imageArchives[l.archiveID].Format, []string{state.imageArchives[l.archiveID].Path}).Run()
+	return state.getCluster(l.clusterID).LoadImageArchives(ctx, state.getImageArchive(l.archiveID).Format, []string{state.getImageArchive(l.archiveID).Path}).Run()
+}
+
+func (l *loadImageArchiveAction) Cleanup(ctx context.Context, state *specState) error { return nil }
+
+func (l *loadImageArchiveAction) Fingerprint(ctx context.Context, state *specState, w io.Writer) error {
+	archive := state.getImageArchive(l.archiveID)
+	return fingerprintFields(w, archive.Name, archive.Path, archive.Format, state.getCluster(l.clusterID).GetName())
 }
 
-func (l *loadImageArchiveAction) Cleanup(ctx context.Context, state *specState) {}
+func (l *loadImageArchiveAction) FingerprintClusterID() string {
+	return l.clusterID
+}
+
+func (l *loadImageArchiveAction) FingerprintName(state *specState) (string, string) {
+	return "", state.getImageArchive(l.archiveID).Path
+}
 
 func (l *loadImageArchiveAction) Title(state *specState) string {
-	return fmt.Sprintf("Loading image archive %s to cluster %s", state.imageArchives[l.archiveID].Name, state.clusters[l.clusterID].GetName())
+	return fmt.Sprintf("Loading image archive %s to cluster %s", state.getImageArchive(l.archiveID).Name, state.getCluster(l.clusterID).GetName())
 }
 
 // ImageFormat is what format an image is exported as
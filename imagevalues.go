@@ -0,0 +1,109 @@
+package gingk8s
+
+import (
+	"strings"
+)
+
+// ImageID is a CustomImageID, ThirdPartyImageID, or ImageArchiveID
+type ImageID interface {
+	ResourceDependency
+	// imageReference returns the reference the image is loaded into clusters as
+	imageReference(state *specState) string
+}
+
+func (t ThirdPartyImageID) imageReference(state *specState) string {
+	image := state.getThirdPartyImage(t.id)
+	if image.Retag != "" {
+		return image.Retag
+	}
+	return image.Name
+}
+
+func (c CustomImageID) imageReference(state *specState) string {
+	return state.getCustomImage(c.id).WithTag(state.suite.opts.CustomImageTag)
+}
+
+// imageReference implements ImageID. This is the Name of the archive, which must be set to refer to it.
+func (a ImageArchiveID) imageReference(state *specState) string {
+	return state.getImageArchive(a.id).Name
+}
+
+// ImageValues binds an image to the values of a release which refer to it, so that they don't need to be kept in sync
+// with the image or SuiteOpts.CustomImageTag by hand. Each field other than Image is the path of a value to set,
+// as with SetString, and is ignored if empty.
+type ImageValues struct {
+	// Image is the image to refer to. It is added as a dependency of the release.
+	Image ImageID
+	// Reference is set to the full reference of the image, e.g. registry/repository:tag
+	Reference string
+	// Repository is set to the reference of the image without its tag or digest, e.g. registry/repository
+	Repository string
+	// Tag is set to the tag of the image, e.g. SuiteOpts.CustomImageTag for custom images
+	Tag string
+	// Digest is set to the digest of the image, e.g. sha256:..., if its reference includes one
+	Digest string
+	// PullPolicy is set to IfNotPresent, as images loaded into the cluster may not exist in any registry
+	PullPolicy string
+}
+
+// StandardImageValues binds an image to the values that most charts use for their images, that is,
+// <prefix>.repository, <prefix>.tag, and <prefix>.pullPolicy, e.g. StandardImageValues(myImage, "image")
+func StandardImageValues(image ImageID, prefix string) ImageValues {
+	return ImageValues{
+		Image:      image,
+		Repository: prefix + ".repository",
+		Tag:        prefix + ".tag",
+		PullPolicy: prefix + ".pullPolicy",
+	}
+}
+
+// splitImageReference splits an image reference into its repository, tag, and digest, any of which may be empty
+func splitImageReference(ref string) (repository, tag, digest string) {
+	repository = ref
+	if ix := strings.Index(repository, "@"); ix != -1 {
+		repository, digest = repository[:ix], repository[ix+1:]
+	}
+	// A colon before the last slash separates a registry's hostname from its port, not a tag
+	if ix := strings.LastIndex(repository, ":"); ix != -1 && ix > strings.LastIndex(repository, "/") {
+		repository, tag = repository[:ix], repository[ix+1:]
+	}
+	return repository, tag, digest
+}
+
+// imageDependencies returns the images bound to the values of a release
+func (h *HelmRelease) imageDependencies() []ResourceDependency {
+	deps := make([]ResourceDependency, 0, len(h.ImageValues))
+	for _, values := range h.ImageValues {
+		deps = append(deps, values.Image)
+	}
+	return deps
+}
+
+// withImageValues returns a copy of a release with the values of its ImageValues added to SetString,
+// or the release itself if it has none
+func (h *HelmRelease) withImageValues(state *specState) *HelmRelease {
+	if len(h.ImageValues) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.SetString = make(StringObject, len(h.SetString)+len(h.ImageValues)*5)
+	for k, v := range h.SetString {
+		h2.SetString[k] = v
+	}
+	for _, values := range h.ImageValues {
+		ref := values.Image.imageReference(state)
+		repository, tag, digest := splitImageReference(ref)
+		for _, value := range []struct{ path, value string }{
+			{values.Reference, ref},
+			{values.Repository, repository},
+			{values.Tag, tag},
+			{values.Digest, digest},
+			{values.PullPolicy, "IfNotPresent"},
+		} {
+			if value.path != "" {
+				h2.SetString[value.path] = value.value
+			}
+		}
+	}
+	return &h2
+}
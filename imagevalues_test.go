@@ -0,0 +1,34 @@
+package gingk8s
+
+import (
+	"testing"
+)
+
+func TestSplitImageReference(t *testing.T) {
+	const sha = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	cases := []struct {
+		ref                     string
+		repository, tag, digest string
+	}{
+		{ref: "nginx", repository: "nginx"},
+		{ref: "nginx:1.25", repository: "nginx", tag: "1.25"},
+		{ref: "library/nginx:latest", repository: "library/nginx", tag: "latest"},
+		{ref: "docker.io/library/nginx:1.25", repository: "docker.io/library/nginx", tag: "1.25"},
+		{ref: "localhost:5000/app", repository: "localhost:5000/app"},
+		{ref: "localhost:5000/app:dev", repository: "localhost:5000/app", tag: "dev"},
+		{ref: "registry.example.com:443/team/app:v1.2.3", repository: "registry.example.com:443/team/app", tag: "v1.2.3"},
+		{ref: "nginx@" + sha, repository: "nginx", digest: sha},
+		{ref: "nginx:1.25@" + sha, repository: "nginx", tag: "1.25", digest: sha},
+		{ref: "localhost:5000/app@" + sha, repository: "localhost:5000/app", digest: sha},
+		{ref: "localhost:5000/app:dev@" + sha, repository: "localhost:5000/app", tag: "dev", digest: sha},
+		{ref: ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.ref, func(t *testing.T) {
+			repository, tag, digest := splitImageReference(tc.ref)
+			if repository != tc.repository || tag != tc.tag || digest != tc.digest {
+				t.Errorf("expected (%q, %q, %q), got (%q, %q, %q)", tc.repository, tc.tag, tc.digest, repository, tag, digest)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package gingk8s
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/meln5674/gosh"
+)
+
+const (
+	// InteractiveEnv is the environment variable which, if set, causes Gingk8s to pause before cleaning up a failed
+	// suite or spec, so that the environment can be debugged
+	InteractiveEnv = "GINGK8S_INTERACTIVE"
+	// InteractiveShellEnv is the environment variable with the shell to spawn in interactive mode.
+	// If not set, $SHELL is used, or /bin/sh if that is not set.
+	InteractiveShellEnv = "GINGK8S_INTERACTIVE_SHELL"
+)
+
+// activePortForwards tracks the KubectlPortForwarders which are currently running
+type activePortForwards struct {
+	lock     sync.Mutex
+	forwards map[*KubectlPortForwarder]string
+}
+
+func (a *activePortForwards) add(forward *KubectlPortForwarder, cluster Cluster) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.forwards == nil {
+		a.forwards = make(map[*KubectlPortForwarder]string)
+	}
+	a.forwards[forward] = cluster.GetName()
+}
+
+func (a *activePortForwards) remove(forward *KubectlPortForwarder) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.forwards, forward)
+}
+
+// describeEnvironment prints the clusters, releases, and port-forwards available to this spec
+func (g *Gingk8s) describeEnvironment(w io.Writer) {
+	clusters := g.allClusters()
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "CLUSTER\tKUBECONFIG\tCONTEXT")
+	for _, id := range sortedKeys(clusters) {
+		conn := clusters[id].GetConnection()
+		fmt.Fprintf(table, "%s\t%s\t%s\n", clusters[id].GetName(), conn.Kubeconfig, conn.Context)
+	}
+	table.Flush()
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(table, "RELEASE\tNAMESPACE\tCLUSTER")
+	for spec := g.specState; spec != nil; spec = spec.parent {
+		for _, node := range spec.setup {
+			var id, clusterID string
+			switch action := node.specAction.(type) {
+			case *releaseAction:
+				id, clusterID = action.id, action.clusterID
+			case *releaseUpgradeStepAction:
+				// Every step of an upgrade path is the same release
+				if action.stepNum != 1 {
+					continue
+				}
+				id, clusterID = action.id, action.clusterID
+			default:
+				continue
+			}
+			release := spec.releases[id]
+			fmt.Fprintf(table, "%s\t%s\t%s\n", release.Name, release.Namespace, spec.getCluster(clusterID).GetName())
+		}
+	}
+	table.Flush()
+	fmt.Fprintln(w)
+
+	g.suite.portForwards.lock.Lock()
+	defer g.suite.portForwards.lock.Unlock()
+	fmt.Fprintln(table, "PORT-FORWARD\tPORTS\tCLUSTER")
+	for forward, cluster := range g.suite.portForwards.forwards {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", forward.ref(), strings.Join(forward.Ports, ","), cluster)
+	}
+	table.Flush()
+	fmt.Fprintln(w)
+}
+
+// kubeconfigEnv returns the value for KUBECONFIG which includes every cluster
+func (g *Gingk8s) kubeconfigEnv() string {
+	clusters := g.allClusters()
+	paths := []string{}
+	for _, id := range sortedKeys(clusters) {
+		if path := clusters[id].GetConnection().Kubeconfig; path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return strings.Join(paths, string(os.PathListSeparator))
+}
+
+// interact pauses a failed suite or spec before it is cleaned up, so that the environment can be inspected,
+// optionally from a shell, and failed setup nodes re-run after fixing them, until the user chooses to continue
+// or the context is cancelled.
+func (g *Gingk8s) interact(ctx context.Context, rerun func(context.Context) error) {
+	out := io.Writer(os.Stdout)
+	in := io.Reader(os.Stdin)
+	if g.suite.interactiveIn != nil {
+		in, out = g.suite.interactiveIn, g.suite.interactiveOut
+	} else if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+		defer tty.Close()
+		in = tty
+		out = tty
+	}
+
+	if h, ok := g.suite.harness.(interface{ describeFailure(io.Writer) }); ok {
+		h.describeFailure(out)
+	}
+	g.describeEnvironment(out)
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		fmt.Fprintln(out, "Gingk8s is paused so you can interact with the cluster(s). Enter one of:")
+		fmt.Fprintln(out, "  s: Open a shell with KUBECONFIG set to every cluster")
+		fmt.Fprintln(out, "  r: Re-run setup nodes that failed or did not run")
+		fmt.Fprintln(out, "  p: Print the cluster(s), release(s), and port-forward(s) again")
+		fmt.Fprintln(out, "  q: Continue to clean up (or hit ^C)")
+		var line string
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return
+		case line, ok = <-lines:
+		}
+		if !ok {
+			// No input is available, e.g. in CI, so the only way to continue is to be interrupted
+			<-ctx.Done()
+			return
+		}
+		switch strings.TrimSpace(line) {
+		case "s":
+			shell := os.Getenv(InteractiveShellEnv)
+			if shell == "" {
+				shell = os.Getenv("SHELL")
+			}
+			if shell == "" {
+				shell = "/bin/sh"
+			}
+			err := gosh.Command(shell).
+				WithContext(ctx).
+				WithParentEnvAnd(map[string]string{"KUBECONFIG": g.kubeconfigEnv()}).
+				WithStreams(gosh.ReaderIn(in), gosh.WriterOut(out), gosh.WriterErr(out)).
+				Run()
+			if err != nil {
+				fmt.Fprintf(out, "Shell exited: %v\n", err)
+			}
+		case "r":
+			err := rerun(ctx)
+			if err != nil {
+				fmt.Fprintf(out, "Setup failed again: %v\n", err)
+			} else {
+				fmt.Fprintln(out, "Setup succeeded. The suite or spec is still considered failed.")
+			}
+		case "p":
+			g.describeEnvironment(out)
+		case "q":
+			return
+		}
+	}
+}
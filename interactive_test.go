@@ -0,0 +1,132 @@
+package gingk8s
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// interactive sets up g to run interactive mode with input instead of the terminal, and returns its output
+func interactive(t *testing.T, g Gingk8s, input string) *bytes.Buffer {
+	t.Setenv(InteractiveEnv, "1")
+	out := &bytes.Buffer{}
+	g.suite.interactiveIn = strings.NewReader(input)
+	g.suite.interactiveOut = out
+	return out
+}
+
+func TestInteractiveRerun(t *testing.T) {
+	h := newManualHarness(t)
+	g := New(h)
+	out := interactive(t, g, "p\nr\nr\nq\n")
+	r := &recorder{}
+	errFlaky := errors.New("flaky")
+	cluster := g.Cluster(&DummyCluster{
+		Name:       "test",
+		TempDir:    t.TempDir(),
+		Connection: KubernetesConnection{Kubeconfig: "/kubeconfig", Context: "test-context"},
+	})
+	first := g.ClusterAction(cluster, "first", r.action("first"))
+	// Releases are listed even if they are skipped, which avoids needing helm
+	g.Release(cluster, &HelmRelease{
+		Name:       "app",
+		Namespace:  "app-ns",
+		Chart:      &HelmChart{LocalChartInfo: LocalChartInfo{Path: "chart"}},
+		Conditions: Conditions{If: func(context.Context) bool { return false }},
+	})
+	attempts := 0
+	flaky := g.ClusterAction(cluster, "flaky", ClusterActionFuncs{
+		SetupFunc: func(Gingk8s, context.Context, Cluster) error {
+			attempts++
+			r.record("setup flaky")
+			if attempts < 3 {
+				return errFlaky
+			}
+			return nil
+		},
+		CleanupFunc: func(Gingk8s, context.Context, Cluster) error {
+			r.record("cleanup flaky")
+			return nil
+		},
+	}, first)
+	g.ClusterAction(cluster, "after", r.action("after"), flaky)
+
+	checkErr(t, g.TrySetup(context.Background()), errFlaky.Error())
+	h.Fail(errFlaky)
+	h.cleanup()
+
+	// Nodes which succeeded are not re-run, and those re-run are cleaned up
+	expected := "setup first,setup flaky,setup flaky,setup flaky,setup after,cleanup after,cleanup flaky,cleanup first"
+	if events := r.get(); events != expected {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+	for _, expected := range []string{
+		"test     /kubeconfig  test-context",
+		"app      app-ns     test",
+		"Setup failed again: ",
+		"Setup succeeded",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected output to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestInteractiveOnlyOnFailure(t *testing.T) {
+	h := newManualHarness(t)
+	g := New(h)
+	out := interactive(t, g, "q\n")
+	g.Cluster(testCluster(t))
+	if err := g.TrySetup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	h.cleanup()
+	if out.Len() != 0 {
+		t.Errorf("expected no interaction after a success, got:\n%s", out.String())
+	}
+}
+
+func TestInteractiveShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test shell is a shell script")
+	}
+	g := ForTest(t)
+	out := interactive(t, g, "s\nq\n")
+	shell := filepath.Join(t.TempDir(), "shell")
+	err := os.WriteFile(shell, []byte("#!/bin/sh\necho \"KUBECONFIG=$KUBECONFIG\"\n"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(InteractiveShellEnv, shell)
+	g.Cluster(&DummyCluster{Name: "a", Connection: KubernetesConnection{Kubeconfig: "/a"}})
+	g.Cluster(&DummyCluster{Name: "b", Connection: KubernetesConnection{Kubeconfig: "/b"}})
+
+	g.interact(context.Background(), func(context.Context) error { return nil })
+
+	// Clusters are ordered by ID, which is random
+	sep := string(os.PathListSeparator)
+	if !strings.Contains(out.String(), "KUBECONFIG=/a"+sep+"/b\n") && !strings.Contains(out.String(), "KUBECONFIG=/b"+sep+"/a\n") {
+		t.Errorf("expected output to contain a KUBECONFIG with both clusters, got:\n%s", out.String())
+	}
+}
+
+func TestInteractiveWithoutInput(t *testing.T) {
+	g := ForTest(t)
+	out := interactive(t, g, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	// Without input, e.g. in CI, interactive mode waits to be interrupted instead of cleaning up immediately
+	g.interact(ctx, func(context.Context) error { return nil })
+	if ctx.Err() == nil {
+		t.Error("expected interactive mode to wait until it was interrupted")
+	}
+	if !strings.Contains(out.String(), "Gingk8s is paused") {
+		t.Errorf("expected the prompt to be printed, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,171 @@
+package gingk8s
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/meln5674/godag"
+)
+
+var (
+	// DefaultInterruptGracePeriod is the default for SuiteOpts.InterruptGracePeriod
+	DefaultInterruptGracePeriod = 30 * time.Second
+)
+
+// inFlightNodes tracks which nodes are currently executing
+type inFlightNodes struct {
+	lock  sync.Mutex
+	nodes map[string]*specNode
+}
+
+func (i *inFlightNodes) titles() []string {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	titles := make([]string, 0, len(i.nodes))
+	for _, id := range sortedKeys(i.nodes) {
+		node := i.nodes[id]
+		if _, ok := node.specAction.(*specNoop); ok {
+			continue
+		}
+		titles = append(titles, fmt.Sprintf("%s (%s)", node.Title(node.state), id))
+	}
+	return titles
+}
+
+// runSetup executes the setup DAG. Nodes are executed with ctx, but the executor is not, so that if ctx is cancelled,
+// no new nodes are started, but those in-flight are given SuiteOpts.InterruptGracePeriod to stop
+// before returning, so that they are not still running while they are cleaned up.
+// If they do not stop in time, they are abandoned, and cleanup waits for them, see waitForAbandoned.
+func (g *Gingk8s) runSetup(ctx context.Context, ex *godag.Executor[string, *specNode], dag godag.DAG[string, *specNode], skipped godag.Set[string]) error {
+	inFlight := inFlightNodes{nodes: make(map[string]*specNode)}
+	ex.OnStart = func(id string, node *specNode) {
+		inFlight.lock.Lock()
+		defer inFlight.lock.Unlock()
+		inFlight.nodes[id] = node
+	}
+	ex.OnComplete = func(id string, node *specNode, err error) {
+		inFlight.lock.Lock()
+		defer inFlight.lock.Unlock()
+		delete(inFlight.nodes, id)
+	}
+
+	// The executor is never cancelled, as it returns immediately if it is, without waiting for in-flight nodes.
+	// Once ctx is cancelled, any nodes it starts fail immediately, so it exits once those in-flight stop.
+	result := make(chan error, 1)
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		result <- ex.Run(context.Background(), dag, godag.Options[string]{Skip: skipped})
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+	}
+
+	gracePeriod := g.suite.opts.InterruptGracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = DefaultInterruptGracePeriod
+	}
+	titles := inFlight.titles()
+	g.suite.By(fmt.Sprintf("INTERRUPTED: Waiting up to %s for %d in-flight Gingk8s node(s) to stop: %s", gracePeriod, len(titles), strings.Join(titles, ", ")))
+	select {
+	case err := <-result:
+		g.suite.By("INTERRUPTED: All in-flight Gingk8s nodes have stopped, cleaning up nodes which started")
+		if err == nil {
+			err = ctx.Err()
+		}
+		return fmt.Errorf("setup interrupted: %w", err)
+	case <-time.After(gracePeriod):
+		titles = inFlight.titles()
+		g.suite.By(fmt.Sprintf("INTERRUPTED: Grace period expired, abandoning %d in-flight Gingk8s node(s), they will be waited for before cleaning up: %s", len(titles), strings.Join(titles, ", ")))
+		g.abandoned = exited
+		return fmt.Errorf("setup interrupted, abandoned in-flight nodes %s: %w", strings.Join(titles, ", "), ctx.Err())
+	}
+}
+
+// waitForAbandoned waits for nodes abandoned by an interrupted setup to stop, so that they are not still creating resources,
+// or registering themselves to be cleaned up, while the cleanup runs. It stops waiting if ctx is cancelled.
+func (g *Gingk8s) waitForAbandoned(ctx context.Context) {
+	if g.abandoned == nil {
+		return
+	}
+	select {
+	case <-g.abandoned:
+		return
+	default:
+	}
+	g.suite.By("INTERRUPTED: Waiting for abandoned Gingk8s nodes to stop before cleaning up, interrupt again to abort")
+	select {
+	case <-g.abandoned:
+	case <-ctx.Done():
+		g.suite.By("INTERRUPTED: Cleaning up without waiting for abandoned Gingk8s nodes, resources may be left behind")
+	}
+}
+
+// notifySetupInterrupt returns a context which is cancelled on SIGINT or SIGTERM until stop is called.
+// Unlike signal.NotifyContext, stopping does not cancel the context, as nodes like KubectlPortForwarder
+// continue to use it in the background after setup has finished. Instead, it is cancelled once the setup is cleaned up.
+func (s *suiteState) notifySetupInterrupt(ctx context.Context) (context.Context, func()) {
+	if !s.opts.HandleSignals {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s.harness.DeferCleanup(func(context.Context) { cancel() })
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+		case <-signals:
+			s.By("INTERRUPTED: Stopping Gingk8s setup")
+			cancel()
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// notifyCleanupInterrupt returns a context which is cancelled on the second SIGINT or SIGTERM.
+// The first is only reported, so that an impatient ^C does not leave resources behind.
+func (s *suiteState) notifyCleanupInterrupt(ctx context.Context) (context.Context, func()) {
+	if !s.opts.HandleSignals {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		interrupted := false
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				if interrupted {
+					s.By("INTERRUPTED: Aborting cleanup, resources may be left behind")
+					cancel()
+					return
+				}
+				interrupted = true
+				s.By("INTERRUPTED: Gingk8s is cleaning up, interrupt again to abort")
+			}
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
@@ -0,0 +1,90 @@
+package gingk8s
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// interrupt sends SIGINT to the test process, which must be handling it
+func interrupt(t *testing.T) {
+	t.Helper()
+	proc, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = proc.Signal(os.Interrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignalHandlingOptIn(t *testing.T) {
+	s := newSuiteState(newManualHarness(t))
+	ctx := context.Background()
+	setupCtx, stop := s.notifySetupInterrupt(ctx)
+	stop()
+	cleanupCtx, stop := s.notifyCleanupInterrupt(ctx)
+	stop()
+	if setupCtx != ctx || cleanupCtx != ctx {
+		t.Error("expected signals not to be handled unless HandleSignals is set")
+	}
+}
+
+func TestSetupContextLifetime(t *testing.T) {
+	h := newManualHarness(t)
+	g := New(h)
+	g.Options(SuiteOpts{HandleSignals: true})
+	var background context.Context
+	cluster := g.Cluster(testCluster(t))
+	g.ClusterAction(cluster, "background", ClusterAction(func(_ Gingk8s, ctx context.Context, _ Cluster) error {
+		background = ctx
+		return nil
+	}))
+	err := g.TrySetup(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if background.Err() != nil {
+		t.Fatal("expected the setup context to outlive the setup, for background actions")
+	}
+	h.cleanup()
+	if background.Err() == nil {
+		t.Error("expected the setup context to be released by the cleanup")
+	}
+}
+
+func TestSetupInterrupt(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Interrupts cannot be sent to a process on windows")
+	}
+	h := newManualHarness(t)
+	g := New(h)
+	g.Options(SuiteOpts{HandleSignals: true, InterruptGracePeriod: 10 * time.Second})
+	r := &recorder{}
+	cluster := g.Cluster(testCluster(t))
+	started := g.ClusterAction(cluster, "started", r.action("started"))
+	interrupted := g.ClusterAction(cluster, "interrupted", ClusterActionFuncs{
+		SetupFunc: func(_ Gingk8s, ctx context.Context, _ Cluster) error {
+			r.record("setup interrupted")
+			interrupt(t)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		CleanupFunc: func(Gingk8s, context.Context, Cluster) error {
+			r.record("cleanup interrupted")
+			return nil
+		},
+	}, started)
+	g.ClusterAction(cluster, "never", r.action("never"), interrupted)
+
+	checkErr(t, g.TrySetup(context.Background()), "setup interrupted")
+	h.cleanup()
+
+	expected := "setup started,setup interrupted,cleanup interrupted,cleanup started"
+	if events := r.get(); events != expected {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+}
@@ -15,7 +15,6 @@ import (
 	"sigs.k8s.io/yaml"
 
 	"github.com/meln5674/gosh"
-	. "github.com/onsi/ginkgo/v2"
 )
 
 var (
@@ -41,7 +40,7 @@ func (k *KindCommand) kind(ctx context.Context, args []string) *gosh.Cmd {
 		cmd = append(cmd, DefaultKindCommand...)
 	}
 	cmd = append(cmd, args...)
-	return gosh.Command(cmd...).WithContext(ctx).WithStreams(GinkgoOutErr).WithLog(log)
+	return gosh.Command(cmd...).WithContext(ctx).WithStreams(outErrStreams(ctx)).WithLog(log)
 }
 
 // KindCluster represents a kubernetes cluster made with `kind create cluster`
@@ -68,6 +67,9 @@ type KindCluster struct {
 	// If absent, a standard rm -rf is used.
 	// Overriding is necessary if these directories may be mounted into the container, and thus, may be owned by root.
 	DeleteCommand []string
+
+	// Conditions control if this cluster is created
+	Conditions
 }
 
 var _ = Cluster(&KindCluster{})
@@ -101,12 +103,12 @@ func (k *KindCluster) Create(ctx context.Context, skipExisting bool) gosh.Comman
 	}
 	mkConfig := gosh.FromFunc(ctx, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
 		go func() {
-			defer GinkgoRecover()
 			var err error
 			defer func() {
 				done <- err
 				close(done)
 			}()
+			defer recoverError(&err)
 			if k.ConfigFileTemplatePath == "" {
 				log.Info("Kind config file template path is not set, assuming pre-made configuration path is ready", "path", configPath)
 				return
@@ -172,9 +174,9 @@ func (k *KindCluster) Create(ctx context.Context, skipExisting bool) gosh.Comman
 		k.kind(ctx, []string{"get", "clusters"}),
 		gosh.FromFunc(ctx, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
 			go func() {
-				defer GinkgoRecover()
 				var err error
 				defer func() { done <- err; close(done) }()
+				defer recoverError(&err)
 				lines := bufio.NewScanner(stdin)
 				for lines.Scan() {
 					if lines.Text() == k.Name {
@@ -214,6 +216,12 @@ func (k *KindCluster) Create(ctx context.Context, skipExisting bool) gosh.Comman
 	return gosh.And(mkdir, mkConfig, create)
 }
 
+// labelNodes labels the nodes of the cluster with OwnerLabels() so that it can be garbage collected.
+// This is done every time the cluster is set up, not only when it is created, so that a reused cluster is attributed to the current run.
+func (k *KindCluster) labelNodes(ctx context.Context, kubectl Kubectl) gosh.Commander {
+	return labelOwned(ctx, kubectl, k, "nodes", "--all")
+}
+
 // GetConnection implements cluster
 func (k *KindCluster) GetConnection() *KubernetesConnection {
 	return &KubernetesConnection{
@@ -311,7 +319,7 @@ func (k *KindCluster) Delete(ctx context.Context) gosh.Commander {
 	}
 	rmCmd = append(rmCmd, toDelete...)
 	if len(toDelete) != 0 {
-		return gosh.And(deleteCluster, gosh.Command(rmCmd...).WithStreams(GinkgoOutErr).WithLog(log))
+		return gosh.And(deleteCluster, gosh.Command(rmCmd...).WithStreams(outErrStreams(ctx)).WithLog(log))
 	} else {
 		return deleteCluster
 	}
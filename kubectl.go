@@ -15,8 +15,6 @@ import (
 	"k8s.io/apimachinery/pkg/util/yaml"
 
 	"github.com/meln5674/gosh"
-	. "github.com/onsi/ginkgo/v2"
-	. "github.com/onsi/gomega"
 )
 
 var (
@@ -28,7 +26,8 @@ var (
 )
 
 func (g Gingk8s) Kubectl(ctx context.Context, cluster Cluster, args ...string) *gosh.Cmd {
-	return g.suite.opts.Kubectl.Kubectl(ctx, cluster, args).WithStreams(GinkgoOutErr)
+	ctx = g.context(ctx)
+	return g.suite.opts.Kubectl.Kubectl(ctx, cluster, args).WithStreams(outErrStreams(ctx))
 }
 
 func (g Gingk8s) KubectlGetSecretValue(ctx context.Context, cluster Cluster, name, key string, value *string, args ...string) *gosh.Cmd {
@@ -46,14 +45,14 @@ func (g Gingk8s) KubectlGetSecretValue(ctx context.Context, cluster Cluster, nam
 				*value = string(bytes)
 				return err
 			}),
-			GinkgoErr,
+			errStream(g.context(ctx)),
 		)
 }
 
-func (g Gingk8s) KubectlReturnSecretValue(ctx context.Context, cluster Cluster, name, key string, args ...string) string {
+func (g Gingk8s) KubectlReturnSecretValue(ctx context.Context, cluster Cluster, name, key string, args ...string) (string, error) {
 	var out string
-	Expect(g.KubectlGetSecretValue(ctx, cluster, name, key, &out).Run()).To(Succeed())
-	return out
+	err := g.KubectlGetSecretValue(ctx, cluster, name, key, &out, args...).Run()
+	return out, err
 }
 
 func (g Gingk8s) KubectlGetSecretBase64(ctx context.Context, cluster Cluster, name, key string, value *string, args ...string) *gosh.Cmd {
@@ -71,7 +70,7 @@ func (g Gingk8s) KubectlGetSecretBase64(ctx context.Context, cluster Cluster, na
 				*value = string(bytes)
 				return err
 			}),
-			GinkgoErr,
+			errStream(g.context(ctx)),
 		)
 }
 
@@ -81,7 +80,7 @@ func (g Gingk8s) KubectlExec(ctx context.Context, cluster Cluster, name, cmd str
 	allArgs = append(allArgs, "--", cmd)
 	allArgs = append(allArgs, cmdArgs...)
 
-	return g.Kubectl(ctx, cluster, allArgs...).WithStreams(GinkgoOutErr)
+	return g.Kubectl(ctx, cluster, allArgs...)
 }
 
 func (g Gingk8s) KubectlGetServiceNodePorts(ctx context.Context, cluster Cluster, name string, args ...string) (map[string]int32, error) {
@@ -143,17 +142,22 @@ type KubectlPortForwarder struct {
 	stopped     chan struct{}
 }
 
+func (k *KubectlPortForwarder) ref() string {
+	ref := k.Kind
+	if ref != "" {
+		ref += "/"
+	}
+	return ref + k.Name
+}
+
 func (k *KubectlPortForwarder) Setup(g Gingk8s, ctx context.Context, cluster Cluster) error {
 	k.stop = make(chan struct{})
 	k.stopped = make(chan struct{})
 	ctx, k.cancel = context.WithCancel(ctx)
+	g.suite.portForwards.add(k, cluster)
 	go func() {
 		defer func() { close(k.stopped) }()
-		ref := k.Kind
-		if ref != "" {
-			ref += "/"
-		}
-		ref += k.Name
+		ref := k.ref()
 		args := []string{"port-forward", ref}
 		args = append(args, k.Ports...)
 		args = append(args, k.Flags...)
@@ -175,6 +179,7 @@ func (k *KubectlPortForwarder) Setup(g Gingk8s, ctx context.Context, cluster Clu
 }
 
 func (k *KubectlPortForwarder) Cleanup(g Gingk8s, ctx context.Context, cluster Cluster) error {
+	g.suite.portForwards.remove(k)
 	close(k.stop)
 	k.cancel()
 	<-k.stopped
@@ -194,7 +199,7 @@ type KubectlLogger struct {
 
 func (k *KubectlLogger) Setup(g Gingk8s, ctx context.Context, cluster Cluster) error {
 	if k.stopped != nil {
-		Fail("Logger setup called twice: " + k.Name)
+		return fmt.Errorf("Logger setup called twice: %s", k.Name)
 	}
 	k.stop = make(chan struct{})
 	k.stopped = make(chan struct{})
@@ -310,6 +315,16 @@ type KubectlCommand struct {
 	// Command is the command to execute for kubectl.
 	// If absent, $PATH is used
 	Command []string
+	// Kustomize is how to render the Kustomizations of manifests.
+	// If absent, DefaultKustomize is used
+	Kustomize *KustomizeCommand
+}
+
+func (k *KubectlCommand) kustomize() *KustomizeCommand {
+	if k.Kustomize != nil {
+		return k.Kustomize
+	}
+	return DefaultKustomize
 }
 
 func (k *KubectlCommand) Kubectl(ctx context.Context, cluster Cluster, args []string) *gosh.Cmd {
@@ -328,7 +343,7 @@ func (k *KubectlCommand) Kubectl(ctx context.Context, cluster Cluster, args []st
 	}
 	cmd = append(cmd, args...)
 
-	return gosh.Command(cmd...).WithContext(ctx).WithStreams(GinkgoOutErr).WithLog(log)
+	return gosh.Command(cmd...).WithContext(ctx).WithStreams(outErrStreams(ctx)).WithLog(log)
 }
 
 func (k *KubectlCommand) ResourceObjectsYAML(g Gingk8s, ctx context.Context, cluster Cluster, out io.Writer, objects []interface{}) error {
@@ -385,7 +400,6 @@ func (k *KubectlCommand) CreateOrUpdate(g Gingk8s, ctx context.Context, cluster
 	}
 	createdIx := 0
 	readYAMLs := func(stdout io.Reader) error {
-		GinkgoRecover()
 		if manifests.Created == nil {
 			io.ReadAll(stdout)
 			return nil
@@ -406,29 +420,44 @@ func (k *KubectlCommand) CreateOrUpdate(g Gingk8s, ctx context.Context, cluster
 	}
 	objectsToYAML := func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
 		go func() {
-			defer GinkgoRecover()
 			var err error
 			defer func() { done <- err; close(done) }()
+			defer recoverError(&err)
 			err = func() error {
 				return k.ResourceObjectsYAML(g, ctx, cluster, stdout, manifests.ResourceObjects)
 			}()
 		}()
 		return nil
 	}
-	if len(manifests.ResourceObjects) != 0 {
-		applies = append(applies, gosh.Pipeline(
-			gosh.FromFunc(ctx, objectsToYAML),
-			k.Kubectl(ctx, cluster, applyFileArgs("-", false)).WithStreams(gosh.FuncOut(readYAMLs)),
-		))
-	}
-	for _, resource := range manifests.Resources {
-		applies = append(applies, k.Kubectl(ctx, cluster, applyFileArgs("-", false)).WithStreams(gosh.StringIn(resource), gosh.FuncOut(readYAMLs)))
-	}
-	for _, path := range manifests.ResourcePaths {
-		applies = append(applies, k.Kubectl(ctx, cluster, applyFileArgs(path, false)).WithStreams(gosh.FuncOut(readYAMLs)))
-	}
-	for _, path := range manifests.ResourceRecursiveDirs {
-		applies = append(applies, k.Kubectl(ctx, cluster, applyFileArgs(path, true)).WithStreams(gosh.FuncOut(readYAMLs)))
+	if manifests.Ordered {
+		manifests.kustomized = nil
+		applies = append(applies, k.ordered(g, ctx, cluster, manifests, false, func(stdin []byte) gosh.Commander {
+			return k.Kubectl(ctx, cluster, applyFileArgs("-", false)).WithStreams(gosh.BytesIn(stdin), gosh.FuncOut(readYAMLs))
+		}))
+	} else {
+		if len(manifests.ResourceObjects) != 0 {
+			applies = append(applies, gosh.Pipeline(
+				gosh.FromFunc(ctx, objectsToYAML),
+				k.Kubectl(ctx, cluster, applyFileArgs("-", false)).WithStreams(gosh.FuncOut(readYAMLs)),
+			))
+		}
+		for _, resource := range manifests.Resources {
+			applies = append(applies, k.Kubectl(ctx, cluster, applyFileArgs("-", false)).WithStreams(gosh.StringIn(resource), gosh.FuncOut(readYAMLs)))
+		}
+		for _, path := range manifests.ResourcePaths {
+			applies = append(applies, k.Kubectl(ctx, cluster, applyFileArgs(path, false)).WithStreams(gosh.FuncOut(readYAMLs)))
+		}
+		for _, path := range manifests.ResourceRecursiveDirs {
+			applies = append(applies, k.Kubectl(ctx, cluster, applyFileArgs(path, true)).WithStreams(gosh.FuncOut(readYAMLs)))
+		}
+		manifests.kustomized = make([][]byte, len(manifests.Kustomizations))
+		for ix := range manifests.Kustomizations {
+			rendered := &manifests.kustomized[ix]
+			applies = append(applies, gosh.And(
+				k.kustomize().Build(g, ctx, &manifests.Kustomizations[ix], rendered),
+				k.Kubectl(ctx, cluster, applyFileArgs("-", false)).WithStreams(gosh.FuncIn(bytesSource(rendered)), gosh.FuncOut(readYAMLs)),
+			))
+		}
 	}
 
 	waits := []gosh.Commander{}
@@ -459,13 +488,18 @@ func (k *KubectlCommand) Delete(g Gingk8s, ctx context.Context, cluster Cluster,
 		}
 		return args
 	}
+	if manifests.Ordered {
+		return k.ordered(g, ctx, cluster, manifests, true, func(stdin []byte) gosh.Commander {
+			return k.Kubectl(ctx, cluster, applyFileArgs("-", false)).WithStreams(gosh.BytesIn(stdin))
+		})
+	}
 	if len(manifests.ResourceObjects) != 0 {
 		cmds = append(cmds, gosh.Pipeline(
 			gosh.FromFunc(ctx, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
 				go func() {
-					defer GinkgoRecover()
 					var err error
 					defer func() { done <- err; close(done) }()
+					defer recoverError(&err)
 					err = func() error {
 						return k.ResourceObjectsYAML(g, ctx, cluster, stdout, manifests.ResourceObjects)
 					}()
@@ -484,6 +518,26 @@ func (k *KubectlCommand) Delete(g Gingk8s, ctx context.Context, cluster Cluster,
 	for _, path := range manifests.ResourceRecursiveDirs {
 		cmds = append(cmds, k.Kubectl(ctx, cluster, applyFileArgs(path, true)))
 	}
+	for ix := range manifests.Kustomizations {
+		if ix < len(manifests.kustomized) && manifests.kustomized[ix] != nil {
+			cmds = append(cmds, k.Kubectl(ctx, cluster, applyFileArgs("-", false)).WithStreams(gosh.BytesIn(manifests.kustomized[ix])))
+			continue
+		}
+		// The kustomization was never created by this process, e.g. because it was unchanged, so render it again
+		var rendered []byte
+		cmds = append(cmds, gosh.And(
+			k.kustomize().Build(g, ctx, &manifests.Kustomizations[ix], &rendered),
+			k.Kubectl(ctx, cluster, applyFileArgs("-", false)).WithStreams(gosh.FuncIn(bytesSource(&rendered))),
+		))
+	}
 	//return gosh.FanOut(cmds...).WithLog(log)
 	return gosh.And(cmds...)
 }
+
+// bytesSource returns a gosh.PipeSource which writes bytes which are not known until it is run
+func bytesSource(b *[]byte) gosh.PipeSource {
+	return func(w io.Writer) error {
+		_, err := w.Write(*b)
+		return err
+	}
+}
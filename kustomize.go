@@ -0,0 +1,163 @@
+package gingk8s
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/meln5674/gosh"
+)
+
+var (
+	// DefaultKustomize is the default interface used to render kustomizations if none is specified.
+	// It defaults to using the "kustomize" command on the $PATH
+	DefaultKustomize = &KustomizeCommand{}
+)
+
+// Kustomization is a directory containing a kustomization.yaml, which is rendered with kustomize,
+// and then created, updated, and deleted like any other manifests
+type Kustomization struct {
+	// Dir is the path to the directory containing the kustomization.yaml
+	Dir string
+	// Patches are patches to apply on top of the kustomization, as in its patches field
+	Patches []KustomizePatch
+	// Images replace images used by the kustomization, as in its images field
+	Images []KustomizeImage
+}
+
+// KustomizePatch is an inline patch to apply to a kustomization
+type KustomizePatch struct {
+	// Patch is a strategic merge patch or JSON 6902 patch, as YAML
+	Patch string `json:"patch"`
+	// Target selects the objects to patch. Required for JSON 6902 patches.
+	Target *KustomizeTarget `json:"target,omitempty"`
+}
+
+// KustomizeTarget selects the objects a KustomizePatch applies to. Empty fields match any object.
+type KustomizeTarget struct {
+	Group              string `json:"group,omitempty"`
+	Version            string `json:"version,omitempty"`
+	Kind               string `json:"kind,omitempty"`
+	Name               string `json:"name,omitempty"`
+	Namespace          string `json:"namespace,omitempty"`
+	LabelSelector      string `json:"labelSelector,omitempty"`
+	AnnotationSelector string `json:"annotationSelector,omitempty"`
+}
+
+// KustomizeImage replaces an image used by a kustomization with a custom or third party image,
+// so that they don't need to be kept in sync with the image or SuiteOpts.CustomImageTag by hand
+type KustomizeImage struct {
+	// Name is the name of the image to replace, as it appears in the manifests, without its tag
+	Name string
+	// Image is the image to replace it with. It is added as a dependency of the manifests.
+	Image ImageID
+}
+
+// overlay returns the contents of a kustomization.yaml in overlayDir which applies the patches and images of a kustomization,
+// or nil if it has none
+func (k *Kustomization) overlay(state *specState, overlayDir string) ([]byte, error) {
+	if len(k.Patches) == 0 && len(k.Images) == 0 {
+		return nil, nil
+	}
+	dir, err := filepath.Abs(k.Dir)
+	if err != nil {
+		return nil, err
+	}
+	base, err := filepath.Rel(overlayDir, dir)
+	if err != nil {
+		return nil, err
+	}
+	type image struct {
+		Name    string `json:"name"`
+		NewName string `json:"newName,omitempty"`
+		NewTag  string `json:"newTag,omitempty"`
+		Digest  string `json:"digest,omitempty"`
+	}
+	images := make([]image, 0, len(k.Images))
+	for _, override := range k.Images {
+		repository, tag, digest := splitImageReference(override.Image.imageReference(state))
+		images = append(images, image{Name: override.Name, NewName: repository, NewTag: tag, Digest: digest})
+	}
+	overlay := map[string]interface{}{
+		"apiVersion": "kustomize.config.k8s.io/v1beta1",
+		"kind":       "Kustomization",
+		"resources":  []string{base},
+	}
+	if len(k.Patches) != 0 {
+		overlay["patches"] = k.Patches
+	}
+	if len(images) != 0 {
+		overlay["images"] = images
+	}
+	// JSON is valid YAML
+	return json.Marshal(overlay)
+}
+
+// imageDependencies returns the images used by the kustomizations of a set of manifests
+func (m *KubernetesManifests) imageDependencies() []ResourceDependency {
+	deps := []ResourceDependency{}
+	for _, kustomization := range m.Kustomizations {
+		for _, image := range kustomization.Images {
+			deps = append(deps, image.Image)
+		}
+	}
+	return deps
+}
+
+// KustomizeCommand is a reference to an installed kustomize binary
+type KustomizeCommand struct {
+	// Command is the command to execute for kustomize.
+	// If absent, $PATH is used
+	Command []string
+}
+
+func (k *KustomizeCommand) Kustomize(ctx context.Context, args []string) *gosh.Cmd {
+	cmd := []string{}
+	if len(k.Command) != 0 {
+		cmd = append(cmd, k.Command...)
+	} else {
+		cmd = append(cmd, DefaultKustomizeCommand...)
+	}
+	cmd = append(cmd, args...)
+	return gosh.Command(cmd...).WithContext(ctx).WithStreams(outErrStreams(ctx)).WithLog(log)
+}
+
+// Build renders a kustomization, including its patches and images, and stores the resulting manifests in out
+func (k *KustomizeCommand) Build(g Gingk8s, ctx context.Context, kustomization *Kustomization, out *[]byte) gosh.Commander {
+	return gosh.FromFunc(ctx, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
+		go func() {
+			var err error
+			defer func() { done <- err; close(done) }()
+			defer recoverError(&err)
+			err = func() error {
+				overlayDir, err := os.MkdirTemp("", "gingk8s-kustomize-")
+				if err != nil {
+					return err
+				}
+				defer os.RemoveAll(overlayDir)
+				overlay, err := kustomization.overlay(g.specState, overlayDir)
+				if err != nil {
+					return err
+				}
+				dir := kustomization.Dir
+				if overlay != nil {
+					err = os.WriteFile(filepath.Join(overlayDir, "kustomization.yaml"), overlay, 0600)
+					if err != nil {
+						return err
+					}
+					dir = overlayDir
+				}
+				return k.Kustomize(ctx, []string{"build", dir}).
+					WithStreams(gosh.FuncOut(func(stdout io.Reader) error {
+						var err error
+						*out, err = io.ReadAll(stdout)
+						return err
+					})).
+					Run()
+			}()
+		}()
+		return nil
+	})
+}
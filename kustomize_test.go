@@ -0,0 +1,184 @@
+package gingk8s
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestKustomizationOverlay(t *testing.T) {
+	const sha = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	g := ForTest(t)
+	g.Options(SuiteOpts{CustomImageTag: "test"})
+	custom := g.CustomImage(&CustomImage{Registry: "localhost:5000", Repository: "app"})
+	thirdParty := g.ThirdPartyImage(&ThirdPartyImage{Name: "nginx:1.25@" + sha})
+	retagged := g.ThirdPartyImage(&ThirdPartyImage{Name: "redis:7", Retag: "local/redis:7"})
+
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base")
+	overlayDir := filepath.Join(dir, "overlay")
+
+	overlay, err := (&Kustomization{Dir: base}).overlay(g.specState, overlayDir)
+	if err != nil || overlay != nil {
+		t.Errorf("expected no overlay for a kustomization without patches or images, got %s, %v", overlay, err)
+	}
+
+	kustomization := &Kustomization{
+		Dir: base,
+		Patches: []KustomizePatch{
+			{Patch: "- op: replace\n  path: /spec/replicas\n  value: 2\n", Target: &KustomizeTarget{Kind: "Deployment", Name: "app"}},
+			{Patch: "metadata:\n  labels: {a: b}\n"},
+		},
+		Images: []KustomizeImage{
+			{Name: "app", Image: custom},
+			{Name: "nginx", Image: thirdParty},
+			{Name: "redis", Image: retagged},
+		},
+	}
+	overlay, err = kustomization.overlay(g.specState, overlayDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	err = json.Unmarshal(overlay, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"apiVersion": "kustomize.config.k8s.io/v1beta1",
+		"kind":       "Kustomization",
+		// The base is relative, so that the overlay works wherever it is written
+		"resources": []interface{}{filepath.Join("..", "base")},
+		"patches": []interface{}{
+			map[string]interface{}{
+				"patch":  "- op: replace\n  path: /spec/replicas\n  value: 2\n",
+				"target": map[string]interface{}{"kind": "Deployment", "name": "app"},
+			},
+			map[string]interface{}{"patch": "metadata:\n  labels: {a: b}\n"},
+		},
+		"images": []interface{}{
+			map[string]interface{}{"name": "app", "newName": "localhost:5000/app", "newTag": "test"},
+			map[string]interface{}{"name": "nginx", "newName": "nginx", "newTag": "1.25", "digest": sha},
+			map[string]interface{}{"name": "redis", "newName": "local/redis", "newTag": "7"},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected overlay:\n%#v\ngot:\n%#v", expected, got)
+	}
+
+	manifests := &KubernetesManifests{Kustomizations: []Kustomization{*kustomization, {Dir: base}}}
+	deps := manifests.imageDependencies()
+	if !reflect.DeepEqual(deps, []ResourceDependency{custom, thirdParty, retagged}) {
+		t.Errorf("expected the images of the kustomizations to be dependencies, got %#v", deps)
+	}
+}
+
+// scriptKustomize returns a KustomizeCommand which prints a comment with the number of times it has been run,
+// followed by the kustomization.yaml of the directory it builds, and logs that directory
+func scriptKustomize(t *testing.T) (*KustomizeCommand, string) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	counter := filepath.Join(dir, "counter")
+	return &KustomizeCommand{Command: []string{"sh", "-c", `
+[ "$1" = build ] || exit 1
+echo "$2" >> "` + log + `"
+n=$(($(cat "` + counter + `" 2>/dev/null || echo 0) + 1))
+echo $n > "` + counter + `"
+echo "# render $n"
+cat "$2/kustomization.yaml"
+`, "kustomize"}}, log
+}
+
+func TestKustomizeBuild(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test kustomize is a shell script")
+	}
+	g := ForTest(t)
+	base := t.TempDir()
+	writeFile(t, filepath.Join(base, "kustomization.yaml"), "resources: [deployment.yaml]\n")
+	kustomize, log := scriptKustomize(t)
+
+	var out []byte
+	err := kustomize.Build(g, context.Background(), &Kustomization{Dir: base}, &out).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "# render 1\nresources: [deployment.yaml]\n" {
+		t.Errorf("expected the base to be rendered, got %q", out)
+	}
+
+	kustomization := &Kustomization{Dir: base, Patches: []KustomizePatch{{Patch: "metadata: {name: a}"}}}
+	err = kustomize.Build(g, context.Background(), kustomization, &out).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirs := readLog(t, log)
+	if len(dirs) != 2 || dirs[0] != base || dirs[1] == base {
+		t.Fatalf("expected the base, and then an overlay, to be built, got %v", dirs)
+	}
+	overlay, err := kustomization.overlay(g.specState, dirs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "# render 2\n"+string(overlay) {
+		t.Errorf("expected the overlay to be rendered, got %q", out)
+	}
+	if _, err := os.Stat(dirs[1]); !os.IsNotExist(err) {
+		t.Errorf("expected the overlay to be removed once it was built, got %v", err)
+	}
+
+	err = kustomize.Build(g, context.Background(), &Kustomization{Dir: filepath.Join(base, "missing")}, &out).Run()
+	if err == nil {
+		t.Error("expected building a missing kustomization to fail")
+	}
+}
+
+func TestKustomizationManifests(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test kubectl and kustomize are shell scripts")
+	}
+	g := ForTest(t)
+	base := t.TempDir()
+	writeFile(t, filepath.Join(base, "kustomization.yaml"), "resources: [deployment.yaml]\n")
+	kustomize, _ := scriptKustomize(t)
+	log := filepath.Join(t.TempDir(), "log")
+	// Only the first line of the manifests is logged, which is the comment with the number of the render
+	kubectl := &KubectlCommand{
+		Command:   []string{"sh", "-c", `echo "$* $(head -n 1)" >> "` + log + `"`, "kubectl"},
+		Kustomize: kustomize,
+	}
+	cluster := &DummyCluster{Name: "test"}
+	newManifests := func() *KubernetesManifests {
+		return &KubernetesManifests{Name: "m", Namespace: "ns", Kustomizations: []Kustomization{{Dir: base}}}
+	}
+
+	manifests := newManifests()
+	err := kubectl.CreateOrUpdate(g, context.Background(), cluster, manifests).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Manifests are deleted as they were rendered when they were created, even if rendering them again would differ
+	err = kubectl.Delete(g, context.Background(), cluster, manifests).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Manifests which were not created by this process are rendered again
+	err = kubectl.Delete(g, context.Background(), cluster, newManifests()).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"apply --server-side --filename - --output yaml -n ns # render 1",
+		"delete --filename - -n ns # render 1",
+		"delete --filename - -n ns # render 2",
+	}
+	if got := readLog(t, log); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected kubectl to be run as:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
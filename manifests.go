@@ -3,9 +3,7 @@ package gingk8s
 import (
 	"context"
 	"fmt"
-
-	. "github.com/onsi/ginkgo/v2"
-	. "github.com/onsi/gomega"
+	"io"
 
 	"github.com/meln5674/gosh"
 )
@@ -14,20 +12,41 @@ type ManifestsID struct {
 	id string
 }
 
+func (m ManifestsID) serializeID() serializedID {
+	return serializedID{Kind: "Manifests", ID: m.id}
+}
+
+func (m *ManifestsID) deserializeID(id serializedID) error {
+	return deserializeID("Manifests", &m.id, id)
+}
+
 func (m ManifestsID) AddResourceDependency(dep *ResourceDependencies) {
 	dep.Manifests = append(dep.Manifests, m)
 }
 
 func (g Gingk8s) Manifests(cluster ClusterID, manifests *KubernetesManifests, deps ...ResourceDependency) ManifestsID {
 	manifestID := newID()
+
+	var namespace *RandomNamespace
+	if manifests.Namespace == "" {
+		if ns := g.isolatedNamespace(cluster); ns != nil {
+			// Copy the manifests so that the same set can be registered from multiple specs
+			manifests2 := *manifests
+			manifests = &manifests2
+			namespace = ns.namespace
+			deps = append(deps, ns.id)
+		}
+	}
 	g.manifests[manifestID] = manifests
+	deps = append(deps, manifests.imageDependencies()...)
 
 	dependsOn := append([]string{cluster.id}, forResourceDependencies(deps...).allIDs(g.specState, cluster.id)...)
 	node := specNode{
 		state:      g.specState,
 		id:         manifestID,
 		dependsOn:  dependsOn,
-		specAction: &manifestsAction{id: manifestID, clusterID: cluster.id, g: g},
+		specAction: &manifestsAction{id: manifestID, clusterID: cluster.id, namespace: namespace, g: g},
+		conditions: &manifests.Conditions,
 	}
 
 	g.setup = append(g.setup, &node)
@@ -38,36 +57,111 @@ func (g Gingk8s) Manifests(cluster ClusterID, manifests *KubernetesManifests, de
 type manifestsAction struct {
 	id        string
 	clusterID string
+	namespace *RandomNamespace
 	g         Gingk8s
 }
 
 func (m *manifestsAction) Setup(ctx context.Context, state *specState) error {
+	if m.namespace != nil {
+		state.manifests[m.id].Namespace = m.namespace.Get()
+	}
 	if state.suite.opts.NoDeps {
-		By(fmt.Sprintf("SKIPPED: Creating Manifests %s", state.manifests[m.id].Name))
+		state.suite.By(fmt.Sprintf("SKIPPED: Creating Manifests %s", state.manifests[m.id].Name))
 		return nil
 	}
 	return state.suite.opts.Manifests.CreateOrUpdate(m.g, ctx, state.getCluster(m.clusterID), state.manifests[m.id]).Run()
 }
 
-func (m *manifestsAction) Cleanup(ctx context.Context, state *specState) {
-	if state.NoCleanup() || state.manifests[m.id].SkipDelete {
-		return
+func (m *manifestsAction) Cleanup(ctx context.Context, state *specState) error {
+	if state.manifests[m.id].SkipDelete {
+		return nil
 	}
-	Expect(state.suite.opts.Manifests.Delete(m.g, ctx, state.getCluster(m.clusterID), state.manifests[m.id]).Run()).To(Succeed())
+	return state.suite.opts.Manifests.Delete(m.g, ctx, state.getCluster(m.clusterID), state.manifests[m.id]).Run()
+}
+
+func (m *manifestsAction) Fingerprint(ctx context.Context, state *specState, w io.Writer) error {
+	manifests := state.manifests[m.id]
+	cluster := state.getCluster(m.clusterID)
+	namespace := manifests.Namespace
+	if m.namespace != nil {
+		namespace = m.namespace.Get()
+	}
+	err := fingerprintFields(w, manifests.Name, namespace, manifests.Replace, manifests.Create, manifests.Ordered, fmt.Sprintf("%v", manifests.Wait))
+	if err != nil {
+		return err
+	}
+	err = resourceObjectsYAML(state.suite.opts.Manifests).ResourceObjectsYAML(m.g, ctx, cluster, w, manifests.ResourceObjects)
+	if err != nil {
+		return err
+	}
+	for _, resource := range manifests.Resources {
+		err = fingerprintFields(w, resource)
+		if err != nil {
+			return err
+		}
+	}
+	for _, path := range manifests.ResourcePaths {
+		err = fingerprintPath(w, path, false)
+		if err != nil {
+			return err
+		}
+	}
+	for _, path := range manifests.ResourceRecursiveDirs {
+		err = fingerprintPath(w, path, true)
+		if err != nil {
+			return err
+		}
+	}
+	for _, kustomization := range manifests.Kustomizations {
+		err = fingerprintPath(w, kustomization.Dir, true)
+		if err != nil {
+			return err
+		}
+		overlay, err := kustomization.overlay(state, kustomization.Dir)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(overlay)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *manifestsAction) FingerprintClusterID() string {
+	return m.clusterID
+}
+
+func (m *manifestsAction) FingerprintName(state *specState) (string, string) {
+	return state.manifests[m.id].Namespace, state.manifests[m.id].Name
 }
 
 func (m *manifestsAction) Title(state *specState) string {
 	return fmt.Sprintf("Submit manifest set %s to cluster %s", state.manifests[m.id].Name, state.clusters[m.clusterID].GetName())
 }
 
+// resourceObjectsYAMLer knows how to serialize the ResourceObjects of manifests
+type resourceObjectsYAMLer interface {
+	ResourceObjectsYAML(g Gingk8s, ctx context.Context, cluster Cluster, out io.Writer, objects []interface{}) error
+}
+
+// resourceObjectsYAML returns the manifests implementation if it knows how to serialize ResourceObjects, or DefaultManifests if not
+func resourceObjectsYAML(manifests Manifests) resourceObjectsYAMLer {
+	if m, ok := manifests.(resourceObjectsYAMLer); ok {
+		return m
+	}
+	return DefaultManifests
+}
+
 var (
 	// DefaultManifests is the default interface used to manage manifests if none is specified.
 	// It defaults to using the "kubectl" command on the $PATH
 	DefaultManifests = &KubectlCommand{}
 )
 
-// KubernetesResources is a set of kubernetes manifests from literal strings, files, and directories.
-// Ordering of resources is not guaranteed, and may be performed concurrently
+// KubernetesResources is a set of kubernetes manifests from literal strings, files, directories, and kustomizations.
+// Unless Ordered is set, ordering of resources is not guaranteed, and may be performed concurrently
 type KubernetesManifests struct {
 	// Name is a human-readable name to give the manifest set in logs
 	Name string
@@ -82,11 +176,18 @@ type KubernetesManifests struct {
 	ResourcePaths []string
 	// ResourceRecursiveDirs are paths to directories recursively containing resource files
 	ResourceRecursiveDirs []string
+	// Kustomizations are kustomization directories to render with kustomize, see KubectlCommand.Kustomize.
+	// They are deleted using the same manifests they were rendered to when they were created.
+	Kustomizations []Kustomization
 	// Replace indicates these resources should be replaced, not applied
 	Replace bool
 	// Create indicates these resources should be created, not applied
 	Create bool
-	Wait   []WaitFor
+	// Ordered indicates these resources should be created one kind at a time, in the order of KindOrder, waiting for any
+	// CustomResourceDefinitions to become established before creating custom resources, and deleted in the reverse order.
+	// This allows a CRD and its custom resources to be in the same set. If Created is set, it is populated in that order.
+	Ordered bool
+	Wait    []WaitFor
 	// SkipDelete indicates not to remove this resource on cleanup.
 	SkipDelete bool
 	// SkipDeleteWait indicates that after deleting these resources, do not wait for them to be fully removed
@@ -97,6 +198,12 @@ type KubernetesManifests struct {
 	// If non-nil, it must be a pre-populated with the same length as the number of resources.
 	// yaml.Unmarshal is used
 	Created []interface{}
+
+	// Conditions control if these manifests are created
+	Conditions
+
+	// kustomized are the manifests that Kustomizations were rendered to, by index
+	kustomized [][]byte
 }
 
 // Manifests knows how to manage raw kubernetes manifests
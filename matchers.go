@@ -0,0 +1,187 @@
+package gingk8s
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// FindObject returns the object with a kind and name from a list of objects, such as returned by Template(),
+// or nil if there is none
+func FindObject(objects []unstructured.Unstructured, kind, name string) *unstructured.Unstructured {
+	for ix := range objects {
+		if objects[ix].GetKind() == kind && objects[ix].GetName() == name {
+			return &objects[ix]
+		}
+	}
+	return nil
+}
+
+// HaveObject succeeds if a list of objects, such as returned by Template() or in a HelmReleaseOutput,
+// contains an object with a kind and name, and that object satisfies all of matchers, e.g.
+//
+//	Expect(objects).To(HaveObject("Deployment", "my-app", HaveObjectField("spec.replicas", 3)))
+func HaveObject(kind, name string, matchers ...types.GomegaMatcher) types.GomegaMatcher {
+	return &haveObjectMatcher{kind: kind, name: name, matcher: gomega.SatisfyAll(matchers...)}
+}
+
+type haveObjectMatcher struct {
+	kind    string
+	name    string
+	matcher types.GomegaMatcher
+
+	found *unstructured.Unstructured
+}
+
+func toObjects(actual interface{}) ([]unstructured.Unstructured, error) {
+	switch objects := actual.(type) {
+	case []unstructured.Unstructured:
+		return objects, nil
+	case *HelmReleaseOutput:
+		return objects.Objects, nil
+	case HelmReleaseOutput:
+		return objects.Objects, nil
+	}
+	return nil, fmt.Errorf("HaveObject expects a []unstructured.Unstructured or HelmReleaseOutput, got:\n%s", format.Object(actual, 1))
+}
+
+func (h *haveObjectMatcher) Match(actual interface{}) (bool, error) {
+	objects, err := toObjects(actual)
+	if err != nil {
+		return false, err
+	}
+	h.found = FindObject(objects, h.kind, h.name)
+	if h.found == nil {
+		return false, nil
+	}
+	return h.matcher.Match(*h.found)
+}
+
+func (h *haveObjectMatcher) FailureMessage(actual interface{}) string {
+	if h.found == nil {
+		objects, _ := toObjects(actual)
+		names := make([]string, 0, len(objects))
+		for _, obj := range objects {
+			names = append(names, obj.GetKind()+"/"+obj.GetName())
+		}
+		return fmt.Sprintf("Expected to find %s/%s, but only found:\n%s", h.kind, h.name, format.IndentString(strings.Join(names, "\n"), 1))
+	}
+	return fmt.Sprintf("%s/%s did not match:\n%s", h.kind, h.name, h.matcher.FailureMessage(*h.found))
+}
+
+func (h *haveObjectMatcher) NegatedFailureMessage(actual interface{}) string {
+	if h.found == nil {
+		return fmt.Sprintf("Expected not to find %s/%s, but did", h.kind, h.name)
+	}
+	return fmt.Sprintf("%s/%s matched, but should not have:\n%s", h.kind, h.name, h.matcher.NegatedFailureMessage(*h.found))
+}
+
+// HaveObjectField succeeds if an unstructured object has a field at a dot-separated path, e.g. "spec.replicas",
+// where list elements are selected by index, e.g. "spec.template.spec.containers[0].image", and its value satisfies expected. If expected is not a matcher, the value must be equivalent to it (see BeEquivalentTo),
+// as numbers in unstructured objects are int64 or float64.
+func HaveObjectField(path string, expected interface{}) types.GomegaMatcher {
+	matcher, ok := expected.(types.GomegaMatcher)
+	if !ok {
+		matcher = gomega.BeEquivalentTo(expected)
+	}
+	return &haveObjectFieldMatcher{path: path, matcher: matcher}
+}
+
+type haveObjectFieldMatcher struct {
+	path    string
+	matcher types.GomegaMatcher
+
+	found bool
+	value interface{}
+}
+
+func (h *haveObjectFieldMatcher) Match(actual interface{}) (bool, error) {
+	var obj map[string]interface{}
+	switch actual := actual.(type) {
+	case unstructured.Unstructured:
+		obj = actual.Object
+	case *unstructured.Unstructured:
+		obj = actual.Object
+	case map[string]interface{}:
+		obj = actual
+	default:
+		return false, fmt.Errorf("HaveObjectField expects an unstructured.Unstructured or map[string]interface{}, got:\n%s", format.Object(actual, 1))
+	}
+	var err error
+	h.value, h.found, err = objectField(obj, h.path)
+	if err != nil {
+		return false, err
+	}
+	if !h.found {
+		return false, nil
+	}
+	return h.matcher.Match(h.value)
+}
+
+func (h *haveObjectFieldMatcher) FailureMessage(actual interface{}) string {
+	if !h.found {
+		return fmt.Sprintf("Expected object to have field %s:\n%s", h.path, format.Object(actual, 1))
+	}
+	return fmt.Sprintf("Field %s did not match:\n%s", h.path, h.matcher.FailureMessage(h.value))
+}
+
+func (h *haveObjectFieldMatcher) NegatedFailureMessage(actual interface{}) string {
+	if !h.found {
+		return fmt.Sprintf("Expected object not to have field %s", h.path)
+	}
+	return fmt.Sprintf("Field %s matched, but should not have:\n%s", h.path, h.matcher.NegatedFailureMessage(h.value))
+}
+
+// objectField returns the value at a dot-separated path in an unstructured object, where list elements are selected
+// by index, e.g. "spec.containers[0].image", and whether it was found. It is an error for the path to be malformed,
+// or to traverse a value which is not a map or list.
+func objectField(obj map[string]interface{}, path string) (interface{}, bool, error) {
+	var value interface{} = obj
+	traversed := ""
+	for _, segment := range strings.Split(path, ".") {
+		key := segment
+		indices := ""
+		if ix := strings.IndexByte(segment, '['); ix != -1 {
+			key, indices = segment[:ix], segment[ix:]
+		}
+		if key == "" {
+			return nil, false, fmt.Errorf("invalid field path %q: empty field name", path)
+		}
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false, fmt.Errorf("%s is a %T, not an object", traversed, value)
+		}
+		value, ok = m[key]
+		if !ok {
+			return nil, false, nil
+		}
+		traversed = strings.TrimPrefix(traversed+"."+key, ".")
+		for indices != "" {
+			end := strings.IndexByte(indices, ']')
+			if indices[0] != '[' || end == -1 {
+				return nil, false, fmt.Errorf("invalid field path %q: unterminated index", path)
+			}
+			index, err := strconv.Atoi(indices[1:end])
+			if err != nil || index < 0 {
+				return nil, false, fmt.Errorf("invalid field path %q: invalid index %q", path, indices[1:end])
+			}
+			list, ok := value.([]interface{})
+			if !ok {
+				return nil, false, fmt.Errorf("%s is a %T, not a list", traversed, value)
+			}
+			if index >= len(list) {
+				return nil, false, nil
+			}
+			value = list[index]
+			traversed += indices[:end+1]
+			indices = indices[end+1:]
+		}
+	}
+	return value, true, nil
+}
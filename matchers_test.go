@@ -0,0 +1,106 @@
+package gingk8s
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testObjects(t *testing.T) []unstructured.Unstructured {
+	t.Helper()
+	objects, err := parseObjects(strings.NewReader(`
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: config}
+data: {key: value}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: app}
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1.0
+        ports: [{containerPort: 8080}]
+      - name: sidecar
+        image: sidecar:2.0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objects
+}
+
+func TestHaveObject(t *testing.T) {
+	objects := testObjects(t)
+	cases := []struct {
+		name    string
+		actual  interface{}
+		matcher types.GomegaMatcher
+		matches bool
+		// err is a substring of the expected error, or empty if none is expected
+		err string
+	}{
+		{name: "present", actual: objects, matcher: HaveObject("ConfigMap", "config"), matches: true},
+		{name: "wrong kind", actual: objects, matcher: HaveObject("Secret", "config"), matches: false},
+		{name: "wrong name", actual: objects, matcher: HaveObject("ConfigMap", "app"), matches: false},
+		{name: "matchers succeed", actual: objects, matcher: HaveObject("Deployment", "app", HaveObjectField("spec.replicas", 3)), matches: true},
+		{name: "matchers fail", actual: objects, matcher: HaveObject("Deployment", "app", HaveObjectField("spec.replicas", 1)), matches: false},
+		{name: "release output", actual: &HelmReleaseOutput{Objects: objects}, matcher: HaveObject("ConfigMap", "config"), matches: true},
+		{name: "wrong type", actual: "config", matcher: HaveObject("ConfigMap", "config"), err: "HaveObject expects"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			matches, err := tc.matcher.Match(tc.actual)
+			checkErr(t, err, tc.err)
+			if matches != tc.matches {
+				t.Errorf("expected match=%v, got %v: %s", tc.matches, matches, tc.matcher.FailureMessage(tc.actual))
+			}
+		})
+	}
+}
+
+func TestHaveObjectField(t *testing.T) {
+	deployment := FindObject(testObjects(t), "Deployment", "app")
+	cases := []struct {
+		name     string
+		path     string
+		expected interface{}
+		matches  bool
+		// err is a substring of the expected error, or empty if none is expected
+		err string
+	}{
+		{name: "scalar", path: "spec.replicas", expected: 3, matches: true},
+		{name: "scalar mismatch", path: "spec.replicas", expected: 2, matches: false},
+		{name: "matcher", path: "spec.replicas", expected: gomega.BeNumerically(">", 2), matches: true},
+		{name: "object", path: "metadata", expected: map[string]interface{}{"name": "app"}, matches: true},
+		{name: "missing field", path: "spec.paused", expected: true, matches: false},
+		{name: "list index", path: "spec.template.spec.containers[0].image", expected: "app:1.0", matches: true},
+		{name: "second list index", path: "spec.template.spec.containers[1].name", expected: "sidecar", matches: true},
+		{name: "nested list index", path: "spec.template.spec.containers[0].ports[0].containerPort", expected: 8080, matches: true},
+		{name: "index out of range", path: "spec.template.spec.containers[2].image", expected: "app:1.0", matches: false},
+		{name: "index of non-list", path: "spec.replicas[0]", expected: 3, err: "spec.replicas is a int64, not a list"},
+		{name: "field of non-object", path: "spec.replicas.value", expected: 3, err: "spec.replicas is a int64, not an object"},
+		{name: "field of list", path: "spec.template.spec.containers.image", expected: "app:1.0", err: "not an object"},
+		{name: "unterminated index", path: "spec.template.spec.containers[0", expected: "app:1.0", err: "unterminated index"},
+		{name: "invalid index", path: "spec.template.spec.containers[x]", expected: "app:1.0", err: `invalid index "x"`},
+		{name: "empty field", path: "spec..replicas", expected: 3, err: "empty field name"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			matcher := HaveObjectField(tc.path, tc.expected)
+			matches, err := matcher.Match(deployment)
+			checkErr(t, err, tc.err)
+			if matches != tc.matches {
+				t.Errorf("expected match=%v, got %v: %s", tc.matches, matches, matcher.FailureMessage(deployment))
+			}
+		})
+	}
+}
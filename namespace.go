@@ -15,6 +15,8 @@ import (
 // RandomNamespace creates a new namespace with a randomized name
 type RandomNamespace struct {
 	namespace *string
+	// Prefix, if set, is prepended to the randomized name
+	Prefix string
 	// If running on a cluster without the controller-manager (e.g. envtest), this must be true,
 	// otherwise, the namespace will never terminate
 	NeedFinalize bool
@@ -35,14 +37,17 @@ func (r *RandomNamespace) Setup(g Gingk8s, ctx context.Context, cluster Cluster)
 	if err != nil {
 		return err
 	}
-	name := namespaceUUID.String()
+	name := r.Prefix + namespaceUUID.String()
 	r.namespace = &name
 
-	return g.Kubectl(ctx, cluster, "create", "namespace", name).Run()
+	return gosh.And(
+		g.Kubectl(ctx, cluster, "create", "namespace", name),
+		labelOwned(ctx, g.suite.opts.Kubectl, cluster, "namespace", name),
+	).Run()
 }
 func (r *RandomNamespace) Cleanup(g Gingk8s, ctx context.Context, cluster Cluster) error {
 	cmds := []gosh.Commander{
-		g.Kubectl(ctx, cluster, "delete", "namespace", *r.namespace, "--wait=false").WithStreams(GinkgoOutErr),
+		g.Kubectl(ctx, cluster, "delete", "namespace", *r.namespace, "--wait=false"),
 	}
 	if r.NeedFinalize {
 		cmds = append(cmds, gosh.And(
@@ -69,11 +74,11 @@ func (r *RandomNamespace) Cleanup(g Gingk8s, ctx context.Context, cluster Cluste
 					return nil
 				}),
 				g.Kubectl(ctx, cluster, "replace", "--raw", fmt.Sprintf("/api/v1/namespaces/%s/finalize", *r.namespace), "-f", "-"),
-			)).WithStreams(GinkgoOutErr),
+			)),
 		)
 	}
 	if !r.SkipDeleteWait {
-		cmds = append(cmds, g.Kubectl(ctx, cluster, "wait", "namespace", *r.namespace, "--for=delete").WithStreams(GinkgoOutErr))
+		cmds = append(cmds, g.Kubectl(ctx, cluster, "wait", "namespace", *r.namespace, "--for=delete"))
 	}
 	return gosh.And(cmds...).Run()
 }
@@ -0,0 +1,251 @@
+package gingk8s
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/meln5674/gosh"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// KindOrder is the order that the kinds of objects are created in by KubectlCommand for KubernetesManifests.Ordered,
+// so that objects are created after those they refer to. Objects of any other kind, such as custom resources, are created last,
+// once all CustomResourceDefinitions have become established.
+var KindOrder = []string{
+	"Namespace",
+	"CustomResourceDefinition",
+	"PriorityClass",
+	"StorageClass",
+	"ResourceQuota",
+	"LimitRange",
+	"NetworkPolicy",
+	"PodSecurityPolicy",
+	"ServiceAccount",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"Role",
+	"RoleBinding",
+	"Secret",
+	"ConfigMap",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"Service",
+	"PodDisruptionBudget",
+	"DaemonSet",
+	"Pod",
+	"ReplicationController",
+	"ReplicaSet",
+	"Deployment",
+	"HorizontalPodAutoscaler",
+	"StatefulSet",
+	"Job",
+	"CronJob",
+	"IngressClass",
+	"Ingress",
+	"APIService",
+}
+
+// kindPriority returns the index of a kind in KindOrder, or its length if it is not present
+func kindPriority(kind string) int {
+	for ix, ordered := range KindOrder {
+		if ordered == kind {
+			return ix
+		}
+	}
+	return len(KindOrder)
+}
+
+// orderObjects sorts objects by their kind in KindOrder, keeping the order of objects of the same kind, and groups them
+// by kind, in that order
+func orderObjects(objects []unstructured.Unstructured) [][]unstructured.Unstructured {
+	sort.SliceStable(objects, func(i, j int) bool {
+		return kindPriority(objects[i].GetKind()) < kindPriority(objects[j].GetKind())
+	})
+	groups := [][]unstructured.Unstructured{}
+	for ix := range objects {
+		if ix == 0 || kindPriority(objects[ix].GetKind()) != kindPriority(objects[ix-1].GetKind()) {
+			groups = append(groups, []unstructured.Unstructured{})
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], objects[ix])
+	}
+	return groups
+}
+
+// manifestObjects parses all of the objects in a set of manifests, rendering its kustomizations if they have not
+// already been rendered, and expanding lists
+func (k *KubectlCommand) manifestObjects(g Gingk8s, ctx context.Context, cluster Cluster, manifests *KubernetesManifests) ([]unstructured.Unstructured, error) {
+	objects := []unstructured.Unstructured{}
+	parse := func(r io.Reader) error {
+		parsed, err := parseObjects(r)
+		if err != nil {
+			return err
+		}
+		for _, obj := range parsed {
+			if !obj.IsList() {
+				objects = append(objects, obj)
+				continue
+			}
+			err = obj.EachListItem(func(item runtime.Object) error {
+				objects = append(objects, *item.(*unstructured.Unstructured))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	parseFile := func(path string) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return parse(f)
+	}
+	// The same extensions kubectl uses for directories
+	isManifest := func(path string) bool {
+		ext := filepath.Ext(path)
+		return ext == ".json" || ext == ".yaml" || ext == ".yml"
+	}
+
+	resourceObjects := bytes.Buffer{}
+	err := k.ResourceObjectsYAML(g, ctx, cluster, &resourceObjects, manifests.ResourceObjects)
+	if err != nil {
+		return nil, err
+	}
+	err = parse(&resourceObjects)
+	if err != nil {
+		return nil, err
+	}
+	for _, resource := range manifests.Resources {
+		err = parse(strings.NewReader(resource))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range manifests.ResourcePaths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			err = parseFile(path)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !isManifest(entry.Name()) {
+				continue
+			}
+			err = parseFile(filepath.Join(path, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, dir := range manifests.ResourceRecursiveDirs {
+		err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || !isManifest(path) {
+				return nil
+			}
+			return parseFile(path)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(manifests.kustomized) != len(manifests.Kustomizations) {
+		manifests.kustomized = make([][]byte, len(manifests.Kustomizations))
+	}
+	for ix := range manifests.Kustomizations {
+		if manifests.kustomized[ix] == nil {
+			err = k.kustomize().Build(g, ctx, &manifests.Kustomizations[ix], &manifests.kustomized[ix]).Run()
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = parse(bytes.NewReader(manifests.kustomized[ix]))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// objectsYAML serializes objects as a stream of YAML documents
+func objectsYAML(objects []unstructured.Unstructured) ([]byte, error) {
+	out := bytes.Buffer{}
+	for _, obj := range objects {
+		objYAML, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		out.WriteString("---\n")
+		out.Write(objYAML)
+	}
+	return out.Bytes(), nil
+}
+
+// ordered returns a command which parses a set of manifests, groups its objects by kind, and runs cmd for each group
+// with the objects as its stdin, in the order of KindOrder, or the reverse order if reverse is true.
+// When not in reverse, CustomResourceDefinitions are waited for to become established before the next group.
+func (k *KubectlCommand) ordered(g Gingk8s, ctx context.Context, cluster Cluster, manifests *KubernetesManifests, reverse bool, cmd func(stdin []byte) gosh.Commander) gosh.Commander {
+	return gosh.FromFunc(ctx, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
+		go func() {
+			var err error
+			defer func() { done <- err; close(done) }()
+			defer recoverError(&err)
+			err = func() error {
+				objects, err := k.manifestObjects(g, ctx, cluster, manifests)
+				if err != nil {
+					return err
+				}
+				groups := orderObjects(objects)
+				if reverse {
+					for i, j := 0, len(groups)-1; i < j; i, j = i+1, j-1 {
+						groups[i], groups[j] = groups[j], groups[i]
+					}
+				}
+				cmds := make([]gosh.Commander, 0, len(groups)*2)
+				for _, group := range groups {
+					groupYAML, err := objectsYAML(group)
+					if err != nil {
+						return err
+					}
+					cmds = append(cmds, cmd(groupYAML))
+					if reverse || group[0].GetKind() != "CustomResourceDefinition" {
+						continue
+					}
+					args := []string{"wait", "--for", "condition=established"}
+					for _, crd := range group {
+						args = append(args, "customresourcedefinition/"+crd.GetName())
+					}
+					cmds = append(cmds, k.Kubectl(ctx, cluster, args))
+				}
+				if len(cmds) == 0 {
+					return nil
+				}
+				return gosh.And(cmds...).Run()
+			}()
+		}()
+		return nil
+	})
+}
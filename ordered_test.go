@@ -0,0 +1,92 @@
+package gingk8s
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestKindPriority(t *testing.T) {
+	cases := []struct {
+		kind     string
+		priority int
+	}{
+		{kind: "Namespace", priority: 0},
+		{kind: "CustomResourceDefinition", priority: 1},
+		{kind: "APIService", priority: len(KindOrder) - 1},
+		{kind: "MyCustomResource", priority: len(KindOrder)},
+		{kind: "namespace", priority: len(KindOrder)},
+		{kind: "", priority: len(KindOrder)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.kind, func(t *testing.T) {
+			if priority := kindPriority(tc.kind); priority != tc.priority {
+				t.Errorf("expected priority %d, got %d", tc.priority, priority)
+			}
+		})
+	}
+	if kindPriority("ServiceAccount") >= kindPriority("Deployment") {
+		t.Error("expected ServiceAccounts to be created before Deployments")
+	}
+}
+
+func TestOrderObjects(t *testing.T) {
+	cases := []struct {
+		name string
+		// objects are kind/name pairs
+		objects []string
+		// groups are the expected groups, each a comma-separated list of kind/name pairs
+		groups []string
+	}{
+		{name: "empty"},
+		{
+			name:    "single",
+			objects: []string{"Deployment/a"},
+			groups:  []string{"Deployment/a"},
+		},
+		{
+			name:    "sorted by kind",
+			objects: []string{"Deployment/app", "Service/app", "Namespace/ns", "ConfigMap/config"},
+			groups:  []string{"Namespace/ns", "ConfigMap/config", "Service/app", "Deployment/app"},
+		},
+		{
+			name:    "stable within a kind",
+			objects: []string{"ConfigMap/c", "Secret/s", "ConfigMap/a", "ConfigMap/b"},
+			groups:  []string{"Secret/s", "ConfigMap/c,ConfigMap/a,ConfigMap/b"},
+		},
+		{
+			name:    "CRDs before custom resources",
+			objects: []string{"MyResource/r", "CustomResourceDefinition/myresources.example.com", "Namespace/ns"},
+			groups:  []string{"Namespace/ns", "CustomResourceDefinition/myresources.example.com", "MyResource/r"},
+		},
+		{
+			name:    "unknown kinds grouped together last",
+			objects: []string{"Foo/a", "Deployment/d", "Bar/b", "Foo/c"},
+			groups:  []string{"Deployment/d", "Foo/a,Bar/b,Foo/c"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			objects := make([]unstructured.Unstructured, 0, len(tc.objects))
+			for _, obj := range tc.objects {
+				kind, name, _ := strings.Cut(obj, "/")
+				u := unstructured.Unstructured{Object: map[string]interface{}{}}
+				u.SetKind(kind)
+				u.SetName(name)
+				objects = append(objects, u)
+			}
+			groups := []string{}
+			for _, group := range orderObjects(objects) {
+				names := make([]string, 0, len(group))
+				for _, obj := range group {
+					names = append(names, obj.GetKind()+"/"+obj.GetName())
+				}
+				groups = append(groups, strings.Join(names, ","))
+			}
+			if strings.Join(groups, " | ") != strings.Join(tc.groups, " | ") {
+				t.Errorf("expected groups %q, got %q", tc.groups, groups)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package gingk8s
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ProcessSuffix returns a suffix which is unique to the current ginkgo parallel process, e.g. "-p1".
+// See Gingk8s.ProcessSuffix for suites which do not use ginkgo.
+func ProcessSuffix() string {
+	return processSuffix(GinkgoHarness{}.ParallelProcess())
+}
+
+// ProcessNamespace returns a namespace name which is unique to the current ginkgo parallel process
+func ProcessNamespace(base string) string {
+	return base + ProcessSuffix()
+}
+
+// MaxReleaseNameLength is the longest name helm allows for a release
+const MaxReleaseNameLength = 53
+
+// ProcessReleaseName returns a helm release name which is unique to the current ginkgo parallel process.
+// Unlike ProcessNamespace, base is truncated if needed so that the name does not exceed MaxReleaseNameLength.
+func ProcessReleaseName(base string) string {
+	return processReleaseName(base, ProcessSuffix())
+}
+
+// ProcessTempDir returns a subdirectory of a directory which is unique to the current ginkgo parallel process
+func ProcessTempDir(base string) string {
+	return processTempDir(base, GinkgoHarness{}.ParallelProcess())
+}
+
+// ProcessSuffix returns a suffix which is unique to the parallel process of the Harness of this suite, e.g. "-p1".
+// If the Harness does not implement ParallelHarness, it is always "-p1".
+func (g Gingk8s) ProcessSuffix() string {
+	return processSuffix(g.suite.parallelProcess())
+}
+
+// ProcessNamespace returns a namespace name which is unique to the parallel process of the Harness of this suite
+func (g Gingk8s) ProcessNamespace(base string) string {
+	return base + g.ProcessSuffix()
+}
+
+// ProcessReleaseName returns a helm release name which is unique to the parallel process of the Harness of this suite.
+// Like the function of the same name, base is truncated if needed so that the name does not exceed MaxReleaseNameLength.
+func (g Gingk8s) ProcessReleaseName(base string) string {
+	return processReleaseName(base, g.ProcessSuffix())
+}
+
+// ProcessTempDir returns a subdirectory of a directory which is unique to the parallel process of the Harness of this suite
+func (g Gingk8s) ProcessTempDir(base string) string {
+	return processTempDir(base, g.suite.parallelProcess())
+}
+
+// parallelProcess returns the index of the parallel process this suite is running in, starting at 1
+func (s *suiteState) parallelProcess() int {
+	if h, ok := s.harness.(ParallelHarness); ok {
+		return h.ParallelProcess()
+	}
+	return 1
+}
+
+func processSuffix(process int) string {
+	return fmt.Sprintf("-p%d", process)
+}
+
+func processReleaseName(base, suffix string) string {
+	if len(base)+len(suffix) > MaxReleaseNameLength {
+		base = strings.TrimRight(base[:MaxReleaseNameLength-len(suffix)], "-.")
+	}
+	return base + suffix
+}
+
+func processTempDir(base string, process int) string {
+	return filepath.Join(base, fmt.Sprintf("process-%d", process))
+}
+
+// specNamespace is a namespace created for a spec when SuiteOpts.IsolateSpecNamespaces is set
+type specNamespace struct {
+	id        ClusterActionID
+	namespace *RandomNamespace
+}
+
+// isolatedNamespace returns the namespace that a release or manifest set without a namespace should use in
+// a cluster, registering it if this is the first such resource, or nil if namespaces are not being isolated
+func (g Gingk8s) isolatedNamespace(cluster ClusterID) *specNamespace {
+	if !g.isolateNamespaces {
+		return nil
+	}
+	ns, ok := g.namespaces[cluster.id]
+	if ok {
+		return ns
+	}
+	ns = &specNamespace{
+		namespace: &RandomNamespace{Prefix: fmt.Sprintf("gingk8s%s-", g.ProcessSuffix())},
+	}
+	ns.id = g.ClusterAction(cluster, "Create spec namespace", ns.namespace)
+	g.namespaces[cluster.id] = ns
+	return ns
+}
+
+// SpecNamespace returns the namespace which was created for this spec in a cluster due to SuiteOpts.IsolateSpecNamespaces.
+// It must only be called after Setup(), and only if at least one release or manifest set was registered against that cluster
+// without a namespace.
+func (g Gingk8s) SpecNamespace(cluster ClusterID) string {
+	ns, ok := g.namespaces[cluster.id]
+	if !ok {
+		panic("SpecNamespace() called for a cluster without an isolated namespace. Set SuiteOpts.IsolateSpecNamespaces and register a release or manifests without a namespace from ForSpec()")
+	}
+	return ns.namespace.Get()
+}
@@ -0,0 +1,160 @@
+package gingk8s
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcessNames(t *testing.T) {
+	// Outside of ginkgo, or when not running in parallel, the process is always 1
+	if suffix := ProcessSuffix(); suffix != "-p1" {
+		t.Errorf("expected suffix -p1, got %s", suffix)
+	}
+	if ns := ProcessNamespace("test"); ns != "test-p1" {
+		t.Errorf("expected namespace test-p1, got %s", ns)
+	}
+	if dir := ProcessTempDir("/tmp/gingk8s"); dir != filepath.Join("/tmp/gingk8s", "process-1") {
+		t.Errorf("expected temp dir /tmp/gingk8s/process-1, got %s", dir)
+	}
+}
+
+func TestProcessReleaseName(t *testing.T) {
+	cases := []struct {
+		name string
+		base string
+		out  string
+	}{
+		{name: "short", base: "app", out: "app-p1"},
+		{name: "at limit", base: strings.Repeat("a", 50), out: strings.Repeat("a", 50) + "-p1"},
+		{name: "over limit", base: strings.Repeat("a", 60), out: strings.Repeat("a", 50) + "-p1"},
+		{name: "truncated at separator", base: strings.Repeat("a", 49) + "-bbbbb", out: strings.Repeat("a", 49) + "-p1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := ProcessReleaseName(tc.base)
+			if out != tc.out {
+				t.Errorf("expected %s, got %s", tc.out, out)
+			}
+			if len(out) > MaxReleaseNameLength {
+				t.Errorf("%s is longer than %d characters", out, MaxReleaseNameLength)
+			}
+		})
+	}
+}
+
+func TestIsolatedNamespace(t *testing.T) {
+	g := ForTest(t)
+	cluster := g.Cluster(&DummyCluster{Name: "main"})
+	other := g.Cluster(&DummyCluster{Name: "other"})
+
+	if ns := g.isolatedNamespace(cluster); ns != nil {
+		t.Errorf("expected no namespace without IsolateSpecNamespaces, got %#v", ns)
+	}
+	if ns := g.ForSpec().isolatedNamespace(cluster); ns != nil {
+		t.Errorf("expected no namespace for a spec without IsolateSpecNamespaces, got %#v", ns)
+	}
+
+	g.Options(SuiteOpts{IsolateSpecNamespaces: true})
+	if ns := g.isolatedNamespace(cluster); ns != nil {
+		t.Errorf("expected no namespace for the suite, got %#v", ns)
+	}
+
+	spec := g.ForSpec()
+	ns := spec.isolatedNamespace(cluster)
+	if ns == nil {
+		t.Fatal("expected a namespace for the spec")
+	}
+	if ns.namespace.Prefix != "gingk8s-p1-" {
+		t.Errorf("expected prefix gingk8s-p1-, got %s", ns.namespace.Prefix)
+	}
+	if _, ok := spec.clusterActions[ns.id.id]; !ok {
+		t.Error("expected the namespace to be registered as a cluster action of the spec")
+	}
+	if ns2 := spec.isolatedNamespace(cluster); ns2 != ns {
+		t.Error("expected the same namespace for the same cluster")
+	}
+	if ns2 := spec.isolatedNamespace(other); ns2 == nil || ns2 == ns {
+		t.Error("expected a different namespace for a different cluster")
+	}
+	if ns2 := g.ForSpec().isolatedNamespace(cluster); ns2 == nil || ns2 == ns {
+		t.Error("expected a different namespace for a different spec")
+	}
+
+	spec.Release(cluster, &HelmRelease{Name: "app"})
+	for _, release := range spec.releases {
+		if release.Namespace != "" {
+			t.Errorf("expected the registered release to be left without a namespace until setup, got %s", release.Namespace)
+		}
+	}
+}
+
+func TestSpecNamespace(t *testing.T) {
+	g := ForTest(t)
+	g.Options(SuiteOpts{IsolateSpecNamespaces: true})
+	cluster := g.Cluster(&DummyCluster{Name: "main"})
+	spec := g.ForSpec()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected SpecNamespace() to panic for a cluster without an isolated namespace")
+			}
+		}()
+		spec.SpecNamespace(cluster)
+	}()
+
+	ns := spec.isolatedNamespace(cluster)
+	name := "gingk8s-p1-abcde"
+	// Simulate Setup() having created the namespace
+	ns.namespace.namespace = &name
+	if got := spec.SpecNamespace(cluster); got != name {
+		t.Errorf("expected %s, got %s", name, got)
+	}
+}
+
+// parallelHarness is a TestingHarness which reports that it is running in a given parallel process
+type parallelHarness struct {
+	TestingHarness
+	process int
+}
+
+func (h parallelHarness) ParallelProcess() int {
+	return h.process
+}
+
+func TestHarnessProcessNames(t *testing.T) {
+	cases := []struct {
+		name    string
+		harness Harness
+		suffix  string
+	}{
+		{name: "not parallel", harness: TestingHarness{T: t}, suffix: "-p1"},
+		{name: "parallel", harness: parallelHarness{TestingHarness: TestingHarness{T: t}, process: 3}, suffix: "-p3"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := New(tc.harness)
+			if suffix := g.ProcessSuffix(); suffix != tc.suffix {
+				t.Errorf("expected suffix %s, got %s", tc.suffix, suffix)
+			}
+			if ns := g.ProcessNamespace("test"); ns != "test"+tc.suffix {
+				t.Errorf("expected namespace test%s, got %s", tc.suffix, ns)
+			}
+			if name := g.ProcessReleaseName(strings.Repeat("a", 60)); name != strings.Repeat("a", 50)+tc.suffix {
+				t.Errorf("expected a truncated release name, got %s", name)
+			}
+			process := strings.TrimPrefix(tc.suffix, "-p")
+			if dir := g.ProcessTempDir("/tmp/gingk8s"); dir != filepath.Join("/tmp/gingk8s", "process-"+process) {
+				t.Errorf("expected temp dir /tmp/gingk8s/process-%s, got %s", process, dir)
+			}
+
+			g.Options(SuiteOpts{IsolateSpecNamespaces: true})
+			cluster := g.Cluster(&DummyCluster{Name: "main"})
+			ns := g.ForSpec().isolatedNamespace(cluster)
+			if prefix := "gingk8s" + tc.suffix + "-"; ns.namespace.Prefix != prefix {
+				t.Errorf("expected prefix %s, got %s", prefix, ns.namespace.Prefix)
+			}
+		})
+	}
+}
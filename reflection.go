@@ -76,6 +76,15 @@ func rarrayCopy(val reflect.Value) reflect.Value {
 	return val2
 }
 
+// clusterArg returns the cluster argument for a value func, which is its last argument.
+// When rendering templates, there is no cluster, so the func is passed a nil Cluster.
+func clusterArg(typ reflect.Type, cluster Cluster) reflect.Value {
+	if cluster == nil {
+		return reflect.Zero(typ.In(typ.NumIn() - 1))
+	}
+	return reflect.ValueOf(cluster)
+}
+
 func resolveRFunc(g Gingk8s, ctx context.Context, cluster Cluster, val reflect.Value) (interface{}, error) {
 	typ := val.Type()
 	tooManyArgs := typ.NumIn() > 3
@@ -107,7 +116,7 @@ func resolveRFunc(g Gingk8s, ctx context.Context, cluster Cluster, val reflect.V
 		in = append(in, reflect.ValueOf(ctx))
 	}
 	if typ.NumIn() > 1 {
-		in = append(in, reflect.ValueOf(cluster))
+		in = append(in, clusterArg(typ, cluster))
 	}
 	if typ.NumIn() > 2 {
 		in = append([]reflect.Value{reflect.ValueOf(g)}, in...)
@@ -154,7 +163,7 @@ func resolveRNestedFunc(g Gingk8s, ctx context.Context, cluster Cluster, val ref
 		in = append(in, reflect.ValueOf(ctx))
 	}
 	if typ.NumIn() > 1 {
-		in = append(in, reflect.ValueOf(cluster))
+		in = append(in, clusterArg(typ, cluster))
 	}
 	if typ.NumIn() > 2 {
 		in = append([]reflect.Value{reflect.ValueOf(g)}, in...)
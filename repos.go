@@ -0,0 +1,164 @@
+package gingk8s
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// helmRepos are the helm repos used by the suite, so that each is only added once
+type helmRepos struct {
+	lock sync.Mutex
+	// repos are the repos that have been added, or are being added, by name
+	repos map[string]*addedRepo
+}
+
+// addedRepo is a repo that has been added, or is being added, by the suite
+type addedRepo struct {
+	repo *HelmRepo
+	// user describes what first used the repo, for use in errors
+	user string
+	// done is closed once the repo has been added, or failed to be, after which err is set
+	done chan struct{}
+	err  error
+}
+
+// HelmRepo registers a helm repo to be added during Setup(). Repos for the charts of releases are registered automatically,
+// so this is only needed for repos used in other ways, e.g. by a chart's dependencies.
+// Repos are shared by the whole suite, so a repo used by multiple specs is only added once,
+// and any repos with the same name must have the same URL, flags, and credentials.
+func (g Gingk8s) HelmRepo(repo *HelmRepo) {
+	g.repos = append(g.repos, repo)
+}
+
+// validateRepo returns an error if a repo cannot be added
+func validateRepo(repo *HelmRepo) error {
+	if repo.Name == "" {
+		return fmt.Errorf("Helm repo with URL %s has no name", repo.URL)
+	}
+	if repo.URL == "" {
+		return fmt.Errorf("Helm repo %s has no URL", repo.Name)
+	}
+	return nil
+}
+
+// repoConflict returns an error if two repos with the same name differ
+func repoConflict(existing, repo *HelmRepo) error {
+	if existing.URL != repo.URL {
+		return fmt.Errorf("URL %s is not %s", repo.URL, existing.URL)
+	}
+	if len(existing.Flags) != 0 || len(repo.Flags) != 0 {
+		if !reflect.DeepEqual(existing.Flags, repo.Flags) {
+			return fmt.Errorf("flags %v are not %v", repo.Flags, existing.Flags)
+		}
+	}
+	if existing.UsernameFile != repo.UsernameFile || existing.PasswordFile != repo.PasswordFile {
+		return fmt.Errorf("credential files (%s, %s) are not (%s, %s)", repo.UsernameFile, repo.PasswordFile, existing.UsernameFile, existing.PasswordFile)
+	}
+	return nil
+}
+
+// repoUse is a repo used by a spec, and what uses it, for use in errors
+type repoUse struct {
+	repo *HelmRepo
+	user string
+}
+
+// releaseRepoUse returns the use of the repo of the chart of a release, or nil if it does not use a repo
+func releaseRepoUse(release *HelmRelease) (*repoUse, error) {
+	if release.Chart.IsLocal() || release.Chart.IsOCI() {
+		return nil, nil
+	}
+	if release.Chart.Repo == nil {
+		return nil, fmt.Errorf("Chart of release %s has no repo", release.Name)
+	}
+	return &repoUse{repo: release.Chart.Repo, user: fmt.Sprintf("release %s", release.Name)}, nil
+}
+
+// addRepos adds the repos registered by this spec and used by its releases which have not already been added by the suite,
+// and waits for those being added by other specs. If a repo conflicts with one with the same name, no repos are added.
+func (g *Gingk8s) addRepos(ctx context.Context) error {
+	uses := make([]repoUse, 0, len(g.repos)+len(g.releases))
+	for _, repo := range g.repos {
+		if repo == nil {
+			return fmt.Errorf("HelmRepo() was passed a nil repo")
+		}
+		uses = append(uses, repoUse{repo: repo, user: "HelmRepo()"})
+	}
+	for _, id := range sortedKeys(g.releases) {
+		use, err := releaseRepoUse(g.releases[id])
+		if err != nil {
+			return err
+		}
+		if use != nil {
+			uses = append(uses, *use)
+		}
+	}
+	return g.suite.addRepos(ctx, g.suite.opts.Helm, uses)
+}
+
+// addRepos adds the repos which have not already been added by the suite using helm, and waits for those being added by other specs.
+// If a repo conflicts with one with the same name, no repos are added.
+func (s *suiteState) addRepos(ctx context.Context, helm Helm, uses []repoUse) error {
+	repos := &s.repos
+	repos.lock.Lock()
+	if repos.repos == nil {
+		repos.repos = make(map[string]*addedRepo)
+	}
+	toAdd := make(map[string]*addedRepo)
+	toWait := make(map[string]*addedRepo)
+	for _, use := range uses {
+		existing, ok := repos.repos[use.repo.Name]
+		if !ok {
+			existing, ok = toAdd[use.repo.Name]
+		}
+		var err error
+		if ok {
+			err = repoConflict(existing.repo, use.repo)
+			if err != nil {
+				err = fmt.Errorf("Helm repo %s used by %s conflicts with the one used by %s: %w", use.repo.Name, use.user, existing.user, err)
+			}
+			toWait[use.repo.Name] = existing
+		} else {
+			err = validateRepo(use.repo)
+			toAdd[use.repo.Name] = &addedRepo{repo: use.repo, user: use.user, done: make(chan struct{})}
+			toWait[use.repo.Name] = toAdd[use.repo.Name]
+		}
+		if err != nil {
+			repos.lock.Unlock()
+			return err
+		}
+	}
+	for name, added := range toAdd {
+		repos.repos[name] = added
+	}
+	repos.lock.Unlock()
+
+	for _, added := range toAdd {
+		go func(added *addedRepo) {
+			defer close(added.done)
+			added.err = helm.AddRepo(ctx, added.repo).Run()
+			if added.err != nil {
+				// Allow the repo to be added again by a later spec, or a re-run
+				repos.lock.Lock()
+				defer repos.lock.Unlock()
+				delete(repos.repos, added.repo.Name)
+			}
+		}(added)
+	}
+
+	errs := []error{}
+	for _, name := range sortedKeys(toWait) {
+		added := toWait[name]
+		select {
+		case <-added.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if added.err != nil {
+			errs = append(errs, fmt.Errorf("Helm repo %s: %w", name, added.err))
+		}
+	}
+	return joinErrors(errs)
+}
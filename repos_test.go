@@ -0,0 +1,227 @@
+package gingk8s
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meln5674/gosh"
+)
+
+// blockingHelm is a recordingHelm whose repos are not added until the result is sent to finish
+type blockingHelm struct {
+	recordingHelm
+	started chan string
+	finish  chan error
+}
+
+func newBlockingHelm() blockingHelm {
+	return blockingHelm{recordingHelm: recordingHelm{r: &recorder{}}, started: make(chan string, 10), finish: make(chan error)}
+}
+
+func (h blockingHelm) AddRepo(ctx context.Context, repo *HelmRepo) gosh.Commander {
+	return gosh.FromFunc(ctx, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
+		h.r.record("add repo " + repo.Name)
+		h.started <- repo.Name
+		go func() {
+			done <- <-h.finish
+			close(done)
+		}()
+		return nil
+	})
+}
+
+// addReposAsync calls addRepos in the background, and returns the channel its result is sent to
+func addReposAsync(g Gingk8s) chan error {
+	result := make(chan error, 1)
+	go func() { result <- g.addRepos(context.Background()) }()
+	return result
+}
+
+// expectBlocked fails the test if addRepos has returned
+func expectBlocked(t *testing.T, result chan error) {
+	t.Helper()
+	select {
+	case err := <-result:
+		t.Fatalf("expected adding repos to wait for the repo to be added, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAddReposOncePerSuite(t *testing.T) {
+	helm := newBlockingHelm()
+	g := ForTest(t)
+	g.Options(SuiteOpts{Helm: helm})
+	repo := &HelmRepo{Name: "repo", URL: "https://example.com/charts"}
+	cluster := g.Cluster(testCluster(t))
+	g.HelmRepo(repo)
+	g.Release(cluster, &HelmRelease{Name: "a", Chart: remoteChart(repo, "a", "")})
+	// Repos are compared by name and contents, not identity
+	g.Release(cluster, &HelmRelease{Name: "b", Chart: remoteChart(&HelmRepo{Name: "repo", URL: repo.URL}, "b", "")})
+	spec := g.ForSpec()
+	spec.Release(cluster, &HelmRelease{Name: "c", Chart: remoteChart(repo, "c", "")})
+	spec.Release(cluster, &HelmRelease{Name: "local", Chart: localChart("chart")})
+	spec.Release(cluster, &HelmRelease{Name: "oci", Chart: ociChart("example.com", "charts/oci", "1.0.0")})
+
+	suiteResult := addReposAsync(g)
+	<-helm.started
+	// A spec using a repo which is still being added by the suite waits for it, instead of using it before it exists
+	specResult := addReposAsync(spec)
+	expectBlocked(t, suiteResult)
+	expectBlocked(t, specResult)
+	helm.finish <- nil
+	for _, result := range []chan error{suiteResult, specResult} {
+		if err := <-result; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Once added, it is not added again
+	if err := spec.addRepos(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if events := helm.r.get(); events != "add repo repo" {
+		t.Errorf("expected the repo to be added once, got %q", events)
+	}
+}
+
+func TestAddReposFailure(t *testing.T) {
+	helm := newBlockingHelm()
+	g := ForTest(t)
+	g.Options(SuiteOpts{Helm: helm})
+	g.HelmRepo(&HelmRepo{Name: "repo", URL: "https://example.com/charts"})
+	spec := g.ForSpec()
+	spec.HelmRepo(&HelmRepo{Name: "repo", URL: "https://example.com/charts"})
+
+	errAdd := errors.New("add")
+	suiteResult := addReposAsync(g)
+	<-helm.started
+	specResult := addReposAsync(spec)
+	expectBlocked(t, specResult)
+	helm.finish <- errAdd
+	// Every spec waiting for the repo fails with it
+	for _, result := range []chan error{suiteResult, specResult} {
+		if err := <-result; !errors.Is(err, errAdd) || !strings.Contains(err.Error(), "Helm repo repo") {
+			t.Errorf("expected the error adding the repo, got %v", err)
+		}
+	}
+
+	// A failed repo can be added again
+	result := addReposAsync(spec)
+	<-helm.started
+	helm.finish <- nil
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	if events := helm.r.get(); events != "add repo repo,add repo repo" {
+		t.Errorf("expected the repo to be added again, got %q", events)
+	}
+}
+
+func TestAddReposInvalid(t *testing.T) {
+	repo := &HelmRepo{Name: "repo", URL: "https://example.com/charts", Flags: []string{"--insecure-skip-tls-verify"}}
+	cases := []struct {
+		name string
+		// existing are repos which have already been added by the suite
+		existing []*HelmRepo
+		repos    []*HelmRepo
+		releases []*HelmRelease
+		err      string
+	}{
+		{name: "nil", repos: []*HelmRepo{nil}, err: "HelmRepo() was passed a nil repo"},
+		{name: "no repo", releases: []*HelmRelease{{Name: "app", Chart: remoteChart(nil, "app", "")}}, err: "Chart of release app has no repo"},
+		{name: "no name", repos: []*HelmRepo{{URL: "https://example.com/charts"}}, err: "Helm repo with URL https://example.com/charts has no name"},
+		{name: "no URL", repos: []*HelmRepo{{Name: "repo"}}, err: "Helm repo repo has no URL"},
+		{
+			name:  "different URL",
+			repos: []*HelmRepo{repo, {Name: "repo", URL: "https://example.com/other", Flags: repo.Flags}},
+			err:   "Helm repo repo used by HelmRepo() conflicts with the one used by HelmRepo(): URL https://example.com/other is not https://example.com/charts",
+		},
+		{
+			name:     "different flags",
+			repos:    []*HelmRepo{repo},
+			releases: []*HelmRelease{{Name: "app", Chart: remoteChart(&HelmRepo{Name: "repo", URL: repo.URL}, "app", "")}},
+			err:      "Helm repo repo used by release app conflicts with the one used by HelmRepo(): flags [] are not [--insecure-skip-tls-verify]",
+		},
+		{
+			name:     "different credentials from another spec",
+			existing: []*HelmRepo{repo},
+			repos:    []*HelmRepo{{Name: "repo", URL: repo.URL, Flags: repo.Flags, PasswordFile: "password"}},
+			err:      "credential files (, password) are not (, )",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &recorder{}
+			g := ForTest(t)
+			g.Options(SuiteOpts{Helm: recordingHelm{r: r}})
+			for _, repo := range tc.existing {
+				g.HelmRepo(repo)
+			}
+			if err := g.addRepos(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			added := r.get()
+
+			spec := g.ForSpec()
+			for _, repo := range tc.repos {
+				spec.HelmRepo(repo)
+			}
+			cluster := spec.Cluster(testCluster(t))
+			for _, release := range tc.releases {
+				spec.Release(cluster, release)
+			}
+			checkErr(t, spec.addRepos(context.Background()), tc.err)
+			if events := r.get(); events != added {
+				t.Errorf("expected no repos to be added, got %q", events)
+			}
+		})
+	}
+}
+
+func TestAddRepoCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The test helm is a shell script")
+	}
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	h := helmScript(t, `
+echo "$*" >> "`+log+`"
+[ "$1 $2" = "repo add" ] && echo "stdin: $(cat)" >> "`+log+`"
+exit 0
+`)
+	writeFile(t, filepath.Join(dir, "username"), "user\n")
+	writeFile(t, filepath.Join(dir, "password"), "secret")
+	repo := &HelmRepo{
+		Name:         "repo",
+		URL:          "https://example.com/charts",
+		Flags:        []string{"--pass-credentials"},
+		UsernameFile: filepath.Join(dir, "username"),
+		PasswordFile: filepath.Join(dir, "password"),
+		Update:       true,
+	}
+	err := h.AddRepo(context.Background(), repo).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The password is passed through stdin so that it is not logged
+	expected := []string{
+		"repo add repo https://example.com/charts --pass-credentials --username user --password-stdin",
+		"stdin: secret",
+		"repo update repo",
+	}
+	if got := readLog(t, log); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected helm to be run as:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	repo.UsernameFile = filepath.Join(dir, "missing")
+	err = h.AddRepo(context.Background(), repo).Run()
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing username file to fail, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package gingk8s
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSerializeRoundTrip(t *testing.T) {
+	g := ForTest(t)
+	opts := SuiteOpts{
+		NoSuiteCleanup:        true,
+		SkipSelector:          "component=monitoring",
+		Incremental:           true,
+		SetupRetries:          2,
+		SetupRetryPeriod:      time.Second,
+		CustomImageTag:        "test",
+		ExtraCustomImageTags:  []string{"extra"},
+		IsolateSpecNamespaces: true,
+		KLogFlags:             []string{"-v=5"},
+		Helm:                  &HelmCommand{},
+	}
+	g.Options(opts)
+
+	image := g.ThirdPartyImage(&ThirdPartyImage{Name: "nginx:1.25"})
+	cluster := g.Cluster(&DummyCluster{Name: "main", TempDir: "/tmp/main"}, image)
+	manifests := g.Manifests(cluster, &KubernetesManifests{Name: "config", Namespace: "ns"})
+	release := g.Release(cluster, &HelmRelease{Name: "app", Namespace: "ns"}, &ResourceDependencies{
+		ThirdPartyImages: []ThirdPartyImageID{image},
+		Manifests:        []ManifestsID{manifests},
+	})
+	spec := g.ForSpec()
+	specRelease := spec.Release(cluster, &HelmRelease{Name: "spec-app", Namespace: "spec-ns"}, release)
+
+	out, err := spec.TrySerialize(cluster, image, manifests, release, specRelease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var g2 Gingk8s
+	var cluster2 ClusterID
+	var image2 ThirdPartyImageID
+	var manifests2 ManifestsID
+	var release2, specRelease2 ReleaseID
+	err = g2.TryDeserialize(out, TestingHarness{T: t}, &cluster2, &image2, &manifests2, &release2, &specRelease2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cluster2 != cluster || image2 != image || manifests2 != manifests || release2 != release || specRelease2 != specRelease {
+		t.Fatal("IDs were not restored")
+	}
+	expectedOpts := opts
+	expectedOpts.Helm = nil
+	if !reflect.DeepEqual(g2.GetOptions(), expectedOpts) {
+		t.Errorf("expected options %#v, got %#v", expectedOpts, g2.GetOptions())
+	}
+	if g2.parent == nil || g2.parent.parent != nil {
+		t.Fatal("expected the spec and its suite to be restored")
+	}
+
+	restoredCluster, ok := g2.getCluster(cluster2.id).(*DummyCluster)
+	if !ok {
+		t.Fatalf("expected a *DummyCluster, got %T", g2.getCluster(cluster2.id))
+	}
+	if restoredCluster.Name != "main" || restoredCluster.TempDir != "/tmp/main" {
+		t.Errorf("cluster was not restored: %#v", restoredCluster)
+	}
+	if g2.getThirdPartyImage(image2.id).Name != "nginx:1.25" {
+		t.Errorf("image was not restored: %#v", g2.getThirdPartyImage(image2.id))
+	}
+	if m := g2.parent.manifests[manifests2.id]; m == nil || m.Name != "config" || m.Namespace != "ns" {
+		t.Errorf("manifests were not restored: %#v", m)
+	}
+	for id, name := range map[string]string{release2.id: "app", specRelease2.id: "spec-app"} {
+		if r := g2.getRelease(id); r == nil || r.Name != name {
+			t.Errorf("release %s was not restored: %#v", name, r)
+		}
+	}
+	if g2.parent.getRelease(specRelease2.id) != nil {
+		t.Error("spec release was restored into the suite")
+	}
+
+	// Restored resources must still be usable as dependencies
+	g2.ForSpec().Release(cluster2, &HelmRelease{Name: "dependent"}, &ResourceDependencies{
+		ThirdPartyImages: []ThirdPartyImageID{image2},
+		Manifests:        []ManifestsID{manifests2},
+		Releases:         []ReleaseID{release2, specRelease2},
+	})
+
+	checkErr(t, g2.TryDeserialize(out, TestingHarness{T: t}, &cluster2), "same number of IDs")
+	checkErr(t, g2.TryDeserialize(out, TestingHarness{T: t}, &cluster2, &cluster2, &manifests2, &release2, &specRelease2), "not a Cluster")
+	checkErr(t, g2.TryDeserialize([]byte("{"), TestingHarness{T: t}), "unexpected end of JSON input")
+}
@@ -3,25 +3,26 @@ package gingk8s
 import (
 	"context"
 	"fmt"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/meln5674/godag"
-
-	. "github.com/onsi/ginkgo/v2"
 )
 
 var cleanLock = sync.Mutex{}
 
 type specAction interface {
 	Setup(context.Context, *specState) error
-	Cleanup(context.Context, *specState)
+	Cleanup(context.Context, *specState) error
 	Title(*specState) string
 }
 
 type specNoop struct{}
 
-func (s *specNoop) Setup(context.Context, *specState) error { return nil }
-func (s *specNoop) Cleanup(context.Context, *specState)     {}
+func (s *specNoop) Setup(context.Context, *specState) error   { return nil }
+func (s *specNoop) Cleanup(context.Context, *specState) error { return nil }
 func (s *specNoop) Title(*specState) string {
 	return "No-op"
 }
@@ -29,29 +30,103 @@ func (s *specNoop) Title(*specState) string {
 type specNode struct {
 	ctx context.Context
 	specAction
-	state     *specState
-	id        string
-	dependsOn []string
+	state      *specState
+	id         string
+	dependsOn  []string
+	conditions *Conditions
+	// skipped is true if the node was skipped during the last setup, so it must not be cleaned up
+	skipped bool
+
+	fingerprint string
 }
 
 var _ = godag.Node[string, *specNode](&specNode{})
 
 func (s *specNode) DoDAGTask() ([]*specNode, error) {
-	defer GinkgoRecover()
+	if s.ctx.Err() != nil {
+		// Setup was interrupted, don't start anything new, or register anything to be cleaned up
+		return nil, s.ctx.Err()
+	}
+	if !s.conditions.enabled(s.ctx) {
+		s.state.suite.By(fmt.Sprintf("SKIPPED: Gingk8s Node: %s (%s)", s.Title(s.state), s.id))
+		s.emit(s.event(NodeSkipped))
+		s.skipped = true
+		return nil, nil
+	}
+	s.skipped = false
+	if s.state.suite.opts.Incremental {
+		fingerprint, err := s.computeFingerprint(s.ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.fingerprint = fingerprint
+		unchanged, err := s.unchanged()
+		if err != nil {
+			return nil, err
+		}
+		if unchanged {
+			s.state.suite.By(fmt.Sprintf("UNCHANGED: Gingk8s Node: %s (%s)", s.Title(s.state), s.id))
+			s.emit(s.event(NodeUnchanged))
+			cleanLock.Lock()
+			defer cleanLock.Unlock()
+			s.state.cleanup = append(s.state.cleanup, s)
+			return nil, nil
+		}
+	}
 	if _, ok := s.specAction.(*specNoop); !ok {
-		defer ByStartStop(fmt.Sprintf("Gingk8s Node: %s (%s)", s.Title(s.state), s.id))()
+		defer s.state.suite.byStartStop(fmt.Sprintf("Gingk8s Node: %s (%s)", s.Title(s.state), s.id))()
 	}
-	err := s.Setup(s.ctx, s.state)
+	// A node which fails or is interrupted part-way through may still have created something, like a kind cluster,
+	// so it is cleaned up as soon as it starts
+	func() {
+		cleanLock.Lock()
+		defer cleanLock.Unlock()
+		s.state.cleanup = append(s.state.cleanup, s)
+	}()
+	err := s.setupWithRetries()
 	if err != nil {
 		return nil, err
 	}
-	cleanLock.Lock()
-	defer cleanLock.Unlock()
-	s.state.cleanup = append(s.state.cleanup, s)
-	// DeferCleanup(func(ctx context.Context) { s.Cleanup(ctx, s.state) })
+	if s.state.suite.opts.Incremental {
+		err = s.saveFingerprint()
+		if err != nil {
+			return nil, err
+		}
+	}
 	return nil, nil
 }
 
+// setupWithRetries executes the setup of this node, retrying it up to SuiteOpts.SetupRetries times
+func (s *specNode) setupWithRetries() error {
+	for attempt := 1; ; attempt++ {
+		started := s.event(NodeStarted)
+		started.Attempt = attempt
+		s.emit(started)
+		err := s.Setup(s.ctx, s.state)
+		finished := s.event(NodeSucceeded)
+		finished.Attempt = attempt
+		finished.Duration = finished.Time.Sub(started.Time)
+		finished.Err = err
+		if err == nil {
+			s.emit(finished)
+			return nil
+		}
+		if attempt > s.state.suite.opts.SetupRetries || s.ctx.Err() != nil {
+			finished.Type = NodeFailed
+			s.emit(finished)
+			return err
+		}
+		finished.Type = NodeRetried
+		s.emit(finished)
+		s.state.suite.By(fmt.Sprintf("RETRYING: Gingk8s Node: %s (%s): %v", s.Title(s.state), s.id, err))
+		select {
+		case <-s.ctx.Done():
+			return err
+		case <-time.After(s.state.suite.opts.SetupRetryPeriod):
+		}
+	}
+}
+
 func (s *specNode) GetID() string {
 	return s.id
 }
@@ -66,15 +141,65 @@ func (s *specNode) GetDependencies() godag.Set[string] {
 
 type cleanupSpecNode struct {
 	*specNode
-	ctx context.Context
+	ctx    context.Context
+	errors *cleanupErrors
+}
+
+// cleanupErrors collects the errors from cleaning up nodes.
+// Cleanup nodes do not report errors to the executor, so that a failure to clean up one resource does not prevent
+// the resources it depends on, like its cluster, from being cleaned up.
+type cleanupErrors struct {
+	lock   sync.Mutex
+	errors []error
+}
+
+func (c *cleanupErrors) add(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.errors = append(c.errors, err)
 }
 
 func (s cleanupSpecNode) DoDAGTask() ([]cleanupSpecNode, error) {
-	defer GinkgoRecover()
+	defer func() {
+		if r := recover(); r != nil {
+			err := &godag.DAGPanic{Recovered: r, Stack: debug.Stack()}
+			failed := s.event(CleanupFailed)
+			failed.Err = err
+			s.emit(failed)
+			s.errors.add(fmt.Errorf("%s (%s): %w", s.Title(s.state), s.id, err))
+		}
+	}()
+	if s.skipped {
+		// Skipped nodes were never set up, so there is nothing to undo
+		return nil, nil
+	}
 	if _, ok := s.specAction.(*specNoop); !ok {
-		defer ByStartStop(fmt.Sprintf("Gingk8s Node (Undo): %s (%s)", s.Title(s.state), s.id))()
+		defer s.state.suite.byStartStop(fmt.Sprintf("Gingk8s Node (Undo): %s (%s)", s.Title(s.state), s.id))()
+	}
+	if s.keep() {
+		if _, ok := s.specAction.(*specNoop); !ok {
+			s.state.suite.By(fmt.Sprintf("KEPT: Gingk8s Node: %s (%s)", s.Title(s.state), s.id))
+			err := markRunKept()
+			if err != nil {
+				log.Error(err, "Failed to mark run as having kept resources, they may be garbage collected")
+			}
+		}
+		s.emit(s.event(CleanupKept))
+		return nil, nil
+	}
+	started := s.event(CleanupStarted)
+	s.emit(started)
+	err := s.specNode.Cleanup(s.ctx, s.state)
+	finished := s.event(CleanupSucceeded)
+	finished.Duration = finished.Time.Sub(started.Time)
+	if err != nil {
+		finished.Type = CleanupFailed
+		finished.Err = err
+	}
+	s.emit(finished)
+	if err != nil {
+		s.errors.add(fmt.Errorf("%s (%s): %w", s.Title(s.state), s.id, err))
 	}
-	s.specNode.Cleanup(s.ctx, s.state)
 	return nil, nil
 }
 
@@ -96,12 +221,24 @@ type specState struct {
 	releases       map[string]*HelmRelease
 	clusterActions map[string]ClusterAction
 
+	// repos are the helm repos registered explicitly, see Gingk8s.HelmRepo
+	repos []*HelmRepo
+
+	isolateNamespaces bool
+	namespaces        map[string]*specNamespace
+
 	parent *specState
 	suite  *suiteState
 
 	setup []*specNode
 
+	// cleanup are the nodes which have started, and must therefore be cleaned up
 	cleanup []*specNode
+
+	// abandoned is closed once the nodes abandoned by an interrupted setup have stopped, or nil if none were
+	abandoned chan struct{}
+
+	markedFailed atomic.Bool
 }
 
 func (s *specState) NoCleanup() bool {
@@ -121,12 +258,99 @@ func (s *specState) getCluster(id string) Cluster {
 	return c
 }
 
+// getRelease returns a release registered by this spec or any of its parents
+func (s *specState) getRelease(id string) *HelmRelease {
+	release, ok := s.releases[id]
+	if !ok && s.parent != nil {
+		return s.parent.getRelease(id)
+	}
+	return release
+}
+
+// getThirdPartyImage returns a third-party image registered by this spec or any of its parents
+func (s *specState) getThirdPartyImage(id string) *ThirdPartyImage {
+	image, ok := s.thirdPartyImages[id]
+	if !ok && s.parent != nil {
+		return s.parent.getThirdPartyImage(id)
+	}
+	return image
+}
+
+func (s *specState) getThirdPartyImageFormat(id string) ImageFormat {
+	format, ok := s.thirdPartyImageFormats[id]
+	if !ok && s.parent != nil {
+		return s.parent.getThirdPartyImageFormat(id)
+	}
+	return format
+}
+
+// getCustomImage returns a custom image registered by this spec or any of its parents
+func (s *specState) getCustomImage(id string) *CustomImage {
+	image, ok := s.customImages[id]
+	if !ok && s.parent != nil {
+		return s.parent.getCustomImage(id)
+	}
+	return image
+}
+
+func (s *specState) getCustomImageFormat(id string) ImageFormat {
+	format, ok := s.customImageFormats[id]
+	if !ok && s.parent != nil {
+		return s.parent.getCustomImageFormat(id)
+	}
+	return format
+}
+
+// getImageArchive returns an image archive registered by this spec or any of its parents
+func (s *specState) getImageArchive(id string) *ImageArchive {
+	archive, ok := s.imageArchives[id]
+	if !ok && s.parent != nil {
+		return s.parent.getImageArchive(id)
+	}
+	return archive
+}
+
+// ownsImage returns true if a third-party or custom image was registered by this spec, and not one of its parents.
+// Images registered by a parent may still need to be loaded into the clusters of other specs, and so must not be
+// removed from the cache after loading them.
+func (s *specState) ownsImage(id string) bool {
+	_, thirdParty := s.thirdPartyImages[id]
+	_, custom := s.customImages[id]
+	return thirdParty || custom
+}
+
+func (s *specState) getThirdPartyImageConditions(id string) *Conditions {
+	image := s.getThirdPartyImage(id)
+	if image == nil {
+		return nil
+	}
+	return &image.Conditions
+}
+
+func (s *specState) getCustomImageConditions(id string) *Conditions {
+	image := s.getCustomImage(id)
+	if image == nil {
+		return nil
+	}
+	return &image.Conditions
+}
+
+func (s *specState) getImageArchiveConditions(id string) *Conditions {
+	archive := s.getImageArchive(id)
+	if archive == nil {
+		return nil
+	}
+	return &archive.Conditions
+}
+
 func (s *specState) child() *specState {
 	s2 := newSpecState(s.suite, s)
 	for id, cluster := range s.clusters {
 		cluster2 := noopCluster{Cluster: cluster}
 		s2.clusters[id] = cluster2
-		s2.setup = append(s2.setup, &specNode{state: &s2, id: id, specAction: &createClusterAction{id: id}})
+		// The parent's clusters already exist, these only satisfy dependencies on them.
+		// Clusters registered by the child itself are created and deleted as normal.
+		s2.setup = append(s2.setup, &specNode{state: &s2, id: id, specAction: &specNoop{}})
 	}
 	return &s2
 }
@@ -151,6 +375,8 @@ func newSpecState(suite *suiteState, parent *specState) specState {
 		releases:       make(map[string]*HelmRelease),
 		clusterActions: make(map[string]ClusterAction),
 
+		namespaces: make(map[string]*specNamespace),
+
 		suite: suite,
 
 		parent: parent,
@@ -158,26 +384,133 @@ func newSpecState(suite *suiteState, parent *specState) specState {
 }
 
 type serializableSpec struct {
-	Clusters map[string]*DummyCluster
+	Clusters map[string]serializedCluster
+
+	ThirdPartyImages       map[string]*ThirdPartyImage
+	ThirdPartyImageFormats map[string]ImageFormat
+	ClusterThirdPartyLoads map[string]map[string]string
+
+	CustomImages       map[string]*CustomImage
+	CustomImageFormats map[string]ImageFormat
+	ClusterCustomLoads map[string]map[string]string
+
+	ImageArchives            map[string]*ImageArchive
+	ClusterImageArchiveLoads map[string]map[string]string
+
+	Manifests      map[string]serializedManifests
+	Releases       map[string]serializedRelease
+	ClusterActions []string
+}
+
+// serializedRelease is the subset of a HelmRelease needed to use it as a dependency and refer to it in logs
+type serializedRelease struct {
+	Name      string
+	Namespace string
+}
+
+// serializedManifests is the subset of KubernetesManifests needed to use it as a dependency and refer to it in logs
+type serializedManifests struct {
+	Name      string
+	Namespace string
 }
 
-func (s *specState) serialize() serializableSpec {
+func (s *specState) serialize() (serializableSpec, error) {
 	serializable := serializableSpec{
-		Clusters: make(map[string]*DummyCluster, len(s.clusters)),
+		Clusters: make(map[string]serializedCluster, len(s.clusters)),
+
+		ThirdPartyImages:       s.thirdPartyImages,
+		ThirdPartyImageFormats: s.thirdPartyImageFormats,
+		ClusterThirdPartyLoads: s.clusterThirdPartyLoads,
+
+		CustomImages:       make(map[string]*CustomImage, len(s.customImages)),
+		CustomImageFormats: s.customImageFormats,
+		ClusterCustomLoads: s.clusterCustomLoads,
+
+		ImageArchives:            s.imageArchives,
+		ClusterImageArchiveLoads: s.clusterImageArchiveLoads,
+
+		Manifests:      make(map[string]serializedManifests, len(s.manifests)),
+		Releases:       make(map[string]serializedRelease, len(s.releases)),
+		ClusterActions: make([]string, 0, len(s.clusterActions)),
 	}
 	for k, v := range s.clusters {
-		serializable.Clusters[k] = &DummyCluster{Connection: *v.GetConnection(), TempDir: v.GetTempDir(), Name: v.GetName()}
+		cluster, err := serializeCluster(v)
+		if err != nil {
+			return serializableSpec{}, err
+		}
+		serializable.Clusters[k] = cluster
+	}
+	for k, v := range s.customImages {
+		// Builders are arbitrary interfaces, and cannot be restored, but are also not needed,
+		// as the image will have already been built
+		image := *v
+		image.Builder = nil
+		serializable.CustomImages[k] = &image
 	}
-	return serializable
+	for k, v := range s.manifests {
+		serializable.Manifests[k] = serializedManifests{Name: v.Name, Namespace: v.Namespace}
+	}
+	for k, v := range s.releases {
+		serializable.Releases[k] = serializedRelease{Name: v.Name, Namespace: v.Namespace}
+	}
+	for k := range s.clusterActions {
+		serializable.ClusterActions = append(serializable.ClusterActions, k)
+	}
+	return serializable, nil
 }
 
-func (s *specState) deserialize(parent *specState, serializable serializableSpec) {
-	s.clusters = make(map[string]Cluster, len(serializable.Clusters))
+func (s *specState) deserialize(parent *specState, serializable serializableSpec) error {
 	s.parent = parent
 	if parent != nil {
 		s.suite = s.parent.suite
 	}
 	for k, v := range serializable.Clusters {
-		s.clusters[k] = v
+		cluster, err := v.deserialize()
+		if err != nil {
+			return err
+		}
+		s.clusters[k] = cluster
+		s.clusterThirdPartyLoads[k] = make(map[string]string)
+		s.clusterCustomLoads[k] = make(map[string]string)
+		s.clusterImageArchiveLoads[k] = make(map[string]string)
+	}
+	for k, v := range serializable.ThirdPartyImages {
+		s.thirdPartyImages[k] = v
+	}
+	for k, v := range serializable.ThirdPartyImageFormats {
+		s.thirdPartyImageFormats[k] = v
 	}
+	for k, v := range serializable.ClusterThirdPartyLoads {
+		s.clusterThirdPartyLoads[k] = v
+	}
+	for k, v := range serializable.CustomImages {
+		s.customImages[k] = v
+	}
+	for k, v := range serializable.CustomImageFormats {
+		s.customImageFormats[k] = v
+	}
+	for k, v := range serializable.ClusterCustomLoads {
+		s.clusterCustomLoads[k] = v
+	}
+	for k, v := range serializable.ImageArchives {
+		s.imageArchives[k] = v
+	}
+	for k, v := range serializable.ClusterImageArchiveLoads {
+		s.clusterImageArchiveLoads[k] = v
+	}
+	for k, v := range serializable.Manifests {
+		s.manifests[k] = &KubernetesManifests{Name: v.Name, Namespace: v.Namespace}
+	}
+	for k, v := range serializable.Releases {
+		s.releases[k] = &HelmRelease{Name: v.Name, Namespace: v.Namespace}
+	}
+	for _, k := range serializable.ClusterActions {
+		s.clusterActions[k] = deserializedClusterAction
+	}
+	return nil
+}
+
+// deserializedClusterAction stands in for actions that were executed on another process, which cannot be restored
+func deserializedClusterAction(Gingk8s, context.Context, Cluster) error {
+	return fmt.Errorf("Cluster actions restored with Deserialize() cannot be executed")
 }
@@ -0,0 +1,141 @@
+package gingk8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/meln5674/gosh"
+)
+
+// recordCommander returns a command which records event when it is run
+func recordCommander(ctx context.Context, r *recorder, event string) gosh.Commander {
+	return gosh.FromFunc(ctx, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
+		r.record(event)
+		close(done)
+		return nil
+	})
+}
+
+// recordingImages is an Images which records what it is asked to do instead of doing it
+type recordingImages struct {
+	r *recorder
+}
+
+func (i recordingImages) Pull(ctx context.Context, image *ThirdPartyImage) gosh.Commander {
+	return recordCommander(ctx, i.r, "pull "+image.Name)
+}
+
+func (i recordingImages) Build(ctx context.Context, image *CustomImage, tag string, extraTags []string) gosh.Commander {
+	return recordCommander(ctx, i.r, "build "+image.WithTag(tag))
+}
+
+func (i recordingImages) Save(ctx context.Context, images []string, dest string) (gosh.Commander, ImageFormat) {
+	return recordCommander(ctx, i.r, "save "+strings.Join(images, " ")), DockerImageFormat
+}
+
+func (i recordingImages) Remove(ctx context.Context, images []string) gosh.Commander {
+	return recordCommander(ctx, i.r, "remove "+strings.Join(images, " "))
+}
+
+// recordingCluster is a cluster which records its creation, deletion, and the images loaded into it
+type recordingCluster struct {
+	DummyCluster
+	r *recorder
+}
+
+func (c *recordingCluster) Create(ctx context.Context, skipExisting bool) gosh.Commander {
+	return recordCommander(ctx, c.r, "create "+c.Name)
+}
+
+func (c *recordingCluster) LoadImages(ctx context.Context, from Images, format ImageFormat, images []string, noCache bool) gosh.Commander {
+	return recordCommander(ctx, c.r, fmt.Sprintf("load %s into %s noCache=%v", images[0], c.Name, noCache))
+}
+
+func (c *recordingCluster) Delete(ctx context.Context) gosh.Commander {
+	return recordCommander(ctx, c.r, "delete "+c.Name)
+}
+
+func TestSpecClusters(t *testing.T) {
+	r := &recorder{}
+	h := newManualHarness(t)
+	g := New(h)
+	g.Options(SuiteOpts{
+		Images:               recordingImages{r: r},
+		NoCacheImages:        true,
+		CustomImageTag:       "test",
+		ExtraCustomImageTags: []string{},
+	})
+	newCluster := func(name string) *recordingCluster {
+		return &recordingCluster{DummyCluster: DummyCluster{Name: name, TempDir: t.TempDir()}, r: r}
+	}
+
+	nginx := g.ThirdPartyImage(&ThirdPartyImage{Name: "nginx"})
+	app := g.CustomImage(&CustomImage{Repository: "app"})
+	suiteCluster := g.Cluster(newCluster("suite"), nginx)
+	if err := g.TrySetup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"spec1", "spec2"} {
+		spec := g.ForSpec()
+		cluster := spec.Cluster(newCluster(name), nginx, app)
+		// Spec clusters are usable in the same way as suite clusters
+		spec.ClusterAction(cluster, "action", r.action("action in "+name))
+		spec.ClusterAction(suiteCluster, "action", r.action("action in suite from "+name))
+		if err := spec.TrySetup(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.cleanup()
+
+	counts := map[string]int{}
+	order := map[string]int{}
+	for ix, event := range r.events {
+		counts[event]++
+		order[event] = ix
+	}
+	// Suite images are pulled and built once, and only removed from the cache by the suite's own clusters,
+	// as the clusters of later specs may still need them
+	expected := map[string]int{
+		"pull nginx":                             1,
+		"build app:test":                         1,
+		"create suite":                           1,
+		"load nginx into suite noCache=true":     1,
+		"create spec1":                           1,
+		"load nginx into spec1 noCache=false":    1,
+		"load app:test into spec1 noCache=false": 1,
+		"setup action in spec1":                  1,
+		"setup action in suite from spec1":       1,
+		"cleanup action in spec1":                1,
+		"cleanup action in suite from spec1":     1,
+		"delete spec1":                           1,
+		"create spec2":                           1,
+		"load nginx into spec2 noCache=false":    1,
+		"load app:test into spec2 noCache=false": 1,
+		"setup action in spec2":                  1,
+		"setup action in suite from spec2":       1,
+		"cleanup action in spec2":                1,
+		"cleanup action in suite from spec2":     1,
+		"delete spec2":                           1,
+		"delete suite":                           1,
+	}
+	for event, count := range expected {
+		if counts[event] != count {
+			t.Errorf("expected %q %d time(s), got %d", event, count, counts[event])
+		}
+	}
+	if len(r.events) != len(expected) {
+		t.Errorf("expected only %d events, got %s", len(expected), strings.Join(r.events, ","))
+	}
+	for _, name := range []string{"spec1", "spec2"} {
+		if order["cleanup action in "+name] > order["delete "+name] {
+			t.Errorf("expected the actions in %s to be cleaned up before it is deleted", name)
+		}
+		if order["delete "+name] > order["delete suite"] {
+			t.Errorf("expected %s to be deleted before the suite cluster", name)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package gingk8s
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/meln5674/gosh"
+)
+
+// PlannedNode is a step that Setup() would execute
+type PlannedNode struct {
+	// ID is the unique ID of the node
+	ID string
+	// Title is the human-readable description of the node
+	Title string
+	// DependsOn are the IDs of the nodes which must complete first
+	DependsOn []string
+	// Skipped is true if the node would be skipped due to SuiteOpts.SkipSelector or SuiteOpts.FocusSelector
+	Skipped bool
+}
+
+// Plan returns the steps that Setup() would execute, in an order that they could be executed in sequentially.
+// Nodes that belong to a parent spec are not included.
+func (g *Gingk8s) Plan() ([]PlannedNode, error) {
+	g.setDefaults()
+	dag, skipped, err := g.buildDAG(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := make(map[string]int, len(dag.Nodes))
+	dependents := make(map[string][]string, len(dag.Nodes))
+	for id, node := range dag.Nodes {
+		remaining[id] = len(node.dependsOn)
+		for _, dep := range node.dependsOn {
+			dependents[dep] = append(dependents[dep], id)
+		}
+	}
+	plan := make([]PlannedNode, 0, len(dag.Nodes))
+	ready := []string{}
+	for id, count := range remaining {
+		if count == 0 {
+			ready = append(ready, id)
+		}
+	}
+	for len(ready) != 0 {
+		// Sort by title so that the same spec always produces the same plan
+		sort.Slice(ready, func(i, j int) bool {
+			return dag.Nodes[ready[i]].Title(g.specState) < dag.Nodes[ready[j]].Title(g.specState)
+		})
+		next := []string{}
+		for _, id := range ready {
+			node := dag.Nodes[id]
+			if _, ok := node.specAction.(*specNoop); !ok {
+				plan = append(plan, PlannedNode{
+					ID:        id,
+					Title:     node.Title(g.specState),
+					DependsOn: node.dependsOn,
+					Skipped:   skipped.Contains(id),
+				})
+			}
+			for _, dependent := range dependents[id] {
+				remaining[dependent]--
+				if remaining[dependent] == 0 {
+					next = append(next, dependent)
+				}
+			}
+		}
+		ready = next
+	}
+	return plan, nil
+}
+
+// ClusterStatus is the status of a registered cluster
+type ClusterStatus struct {
+	// Name is the name of the cluster
+	Name string
+	// Connection is how to connect to the cluster
+	Connection KubernetesConnection
+	// Ready is true if the cluster's API server reported itself as ready
+	Ready bool
+	// Message is the output of the readiness check
+	Message string
+}
+
+// ClusterStatuses checks if each cluster registered for this spec and its parents is ready
+func (g *Gingk8s) ClusterStatuses(ctx context.Context) []ClusterStatus {
+	g.setDefaults()
+	clusters := g.allClusters()
+	statuses := make([]ClusterStatus, 0, len(clusters))
+	for _, cluster := range clusters {
+		var out strings.Builder
+		err := g.suite.opts.Kubectl.Kubectl(ctx, cluster, []string{"get", "--raw", "/readyz"}).
+			WithStreams(gosh.WriterOut(&out), gosh.WriterErr(&out)).
+			Run()
+		message := strings.TrimSpace(out.String())
+		if err != nil && message == "" {
+			message = err.Error()
+		}
+		statuses = append(statuses, ClusterStatus{
+			Name:       cluster.GetName(),
+			Connection: *cluster.GetConnection(),
+			Ready:      err == nil,
+			Message:    message,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
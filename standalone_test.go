@@ -0,0 +1,106 @@
+package gingk8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/meln5674/gosh"
+)
+
+func TestPlan(t *testing.T) {
+	r := &recorder{}
+	g := ForTest(t)
+	g.Options(SuiteOpts{SkipSelector: "skip=true"})
+	cluster := g.Cluster(&DummyCluster{Name: "main"})
+	b := g.ClusterAction(cluster, "b", r.action("b"))
+	a := g.ClusterAction(cluster, "a", r.labeled("a", map[string]string{"skip": "true"}), b)
+	c := g.ClusterAction(cluster, "c", r.action("c"))
+	spec := g.ForSpec()
+	d := spec.ClusterAction(cluster, "d", r.action("d"), a, c)
+
+	cases := []struct {
+		name string
+		g    Gingk8s
+		// plan is the expected title, dependencies, and skipped status of each node, in order
+		plan []string
+	}{
+		{
+			name: "suite",
+			g:    g,
+			plan: []string{
+				"Create cluster main [] false",
+				// Nodes which are ready at the same time are ordered by title
+				"Execute action b in cluster main [main] false",
+				"Execute action c in cluster main [main] false",
+				"Execute action a in cluster main [main b] true",
+			},
+		},
+		{
+			name: "spec",
+			g:    spec,
+			plan: []string{"Execute action d in cluster main [main a c] false"},
+		},
+	}
+	names := map[string]string{cluster.id: "main", a.id: "a", b.id: "b", c.id: "c", d.id: "d"}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan, err := tc.g.Plan()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(plan))
+			for _, node := range plan {
+				deps := make([]string, 0, len(node.DependsOn))
+				for _, dep := range node.DependsOn {
+					deps = append(deps, names[dep])
+				}
+				got = append(got, fmt.Sprintf("%s [%s] %v", node.Title, strings.Join(deps, " "), node.Skipped))
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.plan, "\n") {
+				t.Errorf("expected plan:\n%s\ngot:\n%s", strings.Join(tc.plan, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+	if events := r.get(); events != "" {
+		t.Errorf("expected Plan() not to execute anything, got %q", events)
+	}
+}
+
+// scriptKubectl runs a shell script in place of kubectl, with the cluster name as $1, followed by the kubectl args
+type scriptKubectl string
+
+func (s scriptKubectl) Kubectl(ctx context.Context, cluster Cluster, args []string) *gosh.Cmd {
+	return gosh.Command(append([]string{"sh", "-c", string(s), "sh", cluster.GetName()}, args...)...).WithContext(ctx)
+}
+
+func TestClusterStatuses(t *testing.T) {
+	g := ForTest(t)
+	g.Options(SuiteOpts{Kubectl: scriptKubectl(`
+case "$1" in
+ready) echo ok ;;
+broken) echo "readyz check failed" >&2; exit 1 ;;
+*) exit 1 ;;
+esac
+`)})
+	g.Cluster(&DummyCluster{Name: "ready", Connection: KubernetesConnection{Kubeconfig: "/tmp/kubeconfig", Context: "ready"}})
+	g.Cluster(&DummyCluster{Name: "broken"})
+	spec := g.ForSpec()
+	spec.Cluster(&DummyCluster{Name: "silent"})
+
+	statuses := spec.ClusterStatuses(context.Background())
+	expected := []ClusterStatus{
+		{Name: "broken", Ready: false, Message: "readyz check failed"},
+		{Name: "ready", Connection: KubernetesConnection{Kubeconfig: "/tmp/kubeconfig", Context: "ready"}, Ready: true, Message: "ok"},
+		{Name: "silent", Ready: false, Message: "exit status 1"},
+	}
+	if len(statuses) != len(expected) {
+		t.Fatalf("expected %d statuses, got %#v", len(expected), statuses)
+	}
+	for ix := range expected {
+		if statuses[ix] != expected[ix] {
+			t.Errorf("expected status %#v, got %#v", expected[ix], statuses[ix])
+		}
+	}
+}
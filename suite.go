@@ -1,6 +1,9 @@
 package gingk8s
 
-import "github.com/onsi/ginkgo/v2"
+import (
+	"io"
+	"time"
+)
 
 // SuiteOpts controls the behavior of the suite
 type SuiteOpts struct {
@@ -19,6 +22,13 @@ type SuiteOpts struct {
 	// NoDeps disables re-installing third party resources
 	NoDeps bool
 
+	// SkipSelector is a label selector (e.g. "component=monitoring") of resources which should be skipped,
+	// as if their Conditions.If returned false. If not set, the GINGK8S_SKIP_SELECTOR environment variable is used.
+	SkipSelector string
+	// FocusSelector is a label selector of resources which should not be skipped, all other resources are skipped.
+	// If not set, the GINGK8S_FOCUS_SELECTOR environment variable is used.
+	FocusSelector string
+
 	// NoCacheImages indicates to delete local images as soon as they have been transfered into their destination cluster.
 	// When false, third-party images will only be fetched once, and custom images will be able to leverage the builder's
 	// layer cache. This is ideal for local development environments. However, each image will be stored in at least triplicate
@@ -29,22 +39,49 @@ type SuiteOpts struct {
 	// When true, Images will be removed both from the puller/builder layer cache after being exported to the tarball cache,
 	// and deleted from the tarball cache after being loaded to the desintation cluster. This means that each image will be
 	// kept at most twice, and only once after loading is complete.
-	// NoCacheImages is not currently supported for images that are loaded to multiple clusters.
+	// NoCacheImages is not currently supported for images that are loaded to multiple clusters, including clusters created
+	// by specs.
 	NoCacheImages bool
 
+	// Incremental, if true, records a fingerprint of the inputs of each image, release, and manifest set in the temporary
+	// directory of its cluster, such as the contents of build contexts and charts, and the resolved values and manifests.
+	// On subsequent runs, such as after using NoSuiteCleanup, these resources, and those that depend on them,
+	// are only re-built, re-loaded, or re-deployed if their fingerprint has changed.
+	Incremental bool
+
+	// SetupRetries is the number of times to retry the setup of each image, cluster, release, manifest set,
+	// and cluster action if it fails, before failing the suite or spec.
+	SetupRetries int
+	// SetupRetryPeriod is how long to wait between retries
+	SetupRetryPeriod time.Duration
+
+	// InterruptGracePeriod is how long to wait for nodes which are in-flight when setup is interrupted to stop before
+	// cleaning up, after which they are abandoned. Defaults to DefaultInterruptGracePeriod.
+	InterruptGracePeriod time.Duration
+	// HandleSignals enables handling SIGINT and SIGTERM during setup and cleanup. Otherwise, setup is only interrupted if
+	// the context passed to it is cancelled, e.g. by Ginkgo's own interrupt handling, and signals are left to the program.
+	HandleSignals bool
+
 	// CustomImageTag is the tag to set for all custom images
 	CustomImageTag string
 	// ExtraCustomImageTags are a set of extra tags to set for all custom images
 	ExtraCustomImageTags []string
 
-	// Images is how to pull, build, and save images
-	Images Images
-	// Manifests is how to deploy and delete kubernetes manifests
-	Manifests Manifests
-	// Helm is how to deploy and delete helm charts
-	Helm Helm
-	// Kubectl is how to execute kubectl
-	Kubectl Kubectl
+	// Images is how to pull, build, and save images.
+	// It is not restored by Deserialize(), so the defaults are used unless Options() is called again.
+	Images Images `json:"-"`
+	// Manifests is how to deploy and delete kubernetes manifests. It is not restored by Deserialize().
+	Manifests Manifests `json:"-"`
+	// Helm is how to deploy and delete helm charts. It is not restored by Deserialize().
+	Helm Helm `json:"-"`
+	// Kubectl is how to execute kubectl. It is not restored by Deserialize().
+	Kubectl Kubectl `json:"-"`
+
+	// IsolateSpecNamespaces, if true, causes ForSpec() to create a RandomNamespace in each cluster that
+	// HelmReleases and KubernetesManifests without a Namespace are registered against, and to install them into it.
+	// This allows for specs to use fixed release names when running with `ginkgo -p` against a shared cluster.
+	// See Gingk8s.SpecNamespace for retrieving the namespace.
+	IsolateSpecNamespaces bool
 
 	// KLogFlags are a set of command line flags to configure the klog library with
 	KLogFlags []string
@@ -55,19 +92,36 @@ type suiteState struct {
 
 	opts SuiteOpts
 
-	ginkgo ginkgo.FullGinkgoTInterface
+	harness Harness
+
+	subscribers eventSubscribers
+
+	portForwards activePortForwards
+
+	// interactiveIn and interactiveOut, if set, are used for interactive mode instead of the terminal
+	interactiveIn  io.Reader
+	interactiveOut io.Writer
+
+	repos helmRepos
 
 	setup []*specNode
 }
 
 var (
-	state = suiteState{
+	// state is the suite shared by all callers of ForSuite()
+	state = newSuiteState(nil)
+)
 
-		setup: make([]*specNode, 0),
+func newSuiteState(harness Harness) *suiteState {
+	suite := &suiteState{
+		harness: harness,
+		setup:   make([]*specNode, 0),
 	}
-)
+	suite.specState = newSpecState(suite, nil)
+	suite.suite = suite
+	return suite
+}
 
-func init() {
-	state.specState = newSpecState(&state, nil)
-	state.suite = &state
+func (s *suiteState) By(text string) {
+	s.harness.By(text)
 }
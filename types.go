@@ -2,6 +2,7 @@ package gingk8s
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"reflect"
@@ -92,21 +93,36 @@ func (o NestedObject) With(k string, v NestedValue) NestedObject {
 func MkdirAll(path string, mode os.FileMode) gosh.Func {
 	return func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
 		go func() {
-			defer GinkgoRecover()
 			var err error
 			defer func() { done <- err; close(done) }()
+			defer recoverError(&err)
 			err = os.MkdirAll(path, mode)
 		}()
 		return nil
 	}
 }
 
+// recoverError recovers from a panic in a goroutine started by a gosh.Func, and stores it in err so that it is reported
+// as the result of the command instead of crashing the process. It must be deferred directly.
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("panic: %v", r)
+	}
+}
+
+// Error returns a gosh.Func which fails immediately with an error, for when a command cannot be constructed
+func Error(err error) gosh.Func {
+	return func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
+		return err
+	}
+}
+
 func Rm(path string) gosh.Func {
 	return func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
 		go func() {
-			defer GinkgoRecover()
 			var err error
 			defer func() { done <- err; close(done) }()
+			defer recoverError(&err)
 			err = os.Remove(path)
 		}()
 		return nil
@@ -0,0 +1,170 @@
+package gingk8s
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/meln5674/gosh"
+)
+
+// HelmUpgradeStep is one step of an upgrade path, see ReleaseUpgradePath
+type HelmUpgradeStep struct {
+	// Release is the chart, version, and values to install or upgrade to.
+	// Its Name and Namespace are ignored in favor of those of the first step.
+	// Ignored if Rollback is true.
+	Release *HelmRelease
+	// Rollback, if true, rolls the release back with `helm rollback` instead of upgrading it
+	Rollback bool
+	// RollbackRevision is the revision to roll back to. If zero, the release is rolled back to its previous revision.
+	RollbackRevision int
+	// Verify, if set, is called once this step has completed, and before the next step starts,
+	// e.g. to make assertions about the release. If it returns an error, this step fails.
+	Verify ClusterAction
+}
+
+// ReleaseUpgradePath registers a release which is installed by the first step, and then upgraded or rolled back
+// by each following step, in order, e.g. to test upgrading from the last published version of a chart to the local one.
+// Each step is a separate node which depends on the one before it, and the release is deleted once all of them
+// have been cleaned up. The returned ReleaseID refers to the last step, so depending on it waits for the whole path.
+// The steps are always executed, even if SuiteOpts.Incremental is set.
+// SuiteOpts.Helm must implement HelmRollbacker if any step is a rollback, which HelmCommand does.
+func (g Gingk8s) ReleaseUpgradePath(cluster ClusterID, steps []HelmUpgradeStep, deps ...ResourceDependency) ReleaseID {
+	if len(steps) == 0 || steps[0].Rollback || steps[0].Release == nil {
+		panic("BUG: The first step of an upgrade path must install a release")
+	}
+
+	first := steps[0].Release
+	deps = append(deps, first.imageDependencies()...)
+	var namespace *RandomNamespace
+	if first.Namespace == "" {
+		if ns := g.isolatedNamespace(cluster); ns != nil {
+			namespace = ns.namespace
+			deps = append(deps, ns.id)
+		}
+	}
+
+	var firstID, prevID string
+	for ix, step := range steps {
+		stepID := newID()
+		if ix == 0 {
+			firstID = stepID
+		}
+		var release *HelmRelease
+		if step.Rollback {
+			// Rollbacks don't have a release of their own, but depending on their ID should still refer to the release
+			release = g.releases[firstID]
+		} else {
+			if step.Release == nil {
+				panic(fmt.Sprintf("BUG: Step %d of an upgrade path must either roll back, or set Release", ix+1))
+			}
+			// Copy the release so that the same release can be used in multiple steps and specs
+			release2 := *step.Release
+			release2.Name = first.Name
+			release2.Namespace = first.Namespace
+			release = &release2
+		}
+		g.releases[stepID] = release
+
+		var dependsOn []string
+		if ix == 0 {
+			dependsOn = append([]string{cluster.id}, forResourceDependencies(deps...).allIDs(g.specState, cluster.id)...)
+		} else {
+			dependsOn = append([]string{cluster.id, prevID}, forResourceDependencies(release.imageDependencies()...).allIDs(g.specState, cluster.id)...)
+		}
+		node := specNode{
+			state:     g.specState,
+			id:        stepID,
+			dependsOn: dependsOn,
+			specAction: &releaseUpgradeStepAction{
+				id:        stepID,
+				releaseID: firstID,
+				clusterID: cluster.id,
+				namespace: namespace,
+				step:      step,
+				stepNum:   ix + 1,
+				numSteps:  len(steps),
+				g:         g,
+			},
+		}
+		if !step.Rollback {
+			node.conditions = &release.Conditions
+		}
+		g.setup = append(g.setup, &node)
+		prevID = stepID
+	}
+
+	return ReleaseID{id: prevID}
+}
+
+type releaseUpgradeStepAction struct {
+	id        string
+	releaseID string
+	clusterID string
+	namespace *RandomNamespace
+	step      HelmUpgradeStep
+	stepNum   int
+	numSteps  int
+	g         Gingk8s
+}
+
+func (r *releaseUpgradeStepAction) Setup(ctx context.Context, state *specState) error {
+	if r.namespace != nil && !r.step.Rollback {
+		state.releases[r.id].Namespace = r.namespace.Get()
+	}
+	if state.suite.opts.NoDeps {
+		return nil
+	}
+	cluster := state.getCluster(r.clusterID)
+	var err error
+	if r.step.Rollback {
+		rollbacker, ok := state.suite.opts.Helm.(HelmRollbacker)
+		if !ok {
+			return fmt.Errorf("%T does not support rolling back releases", state.suite.opts.Helm)
+		}
+		release := state.releases[r.releaseID]
+		err = gosh.And(
+			rollbacker.Rollback(ctx, cluster, release, r.step.RollbackRevision),
+			labelRelease(ctx, state, cluster, release),
+		).Run()
+	} else {
+		install := releaseAction{id: r.id, clusterID: r.clusterID, g: r.g}
+		err = install.Setup(ctx, state)
+	}
+	if err != nil {
+		return err
+	}
+	if r.step.Verify != nil {
+		return r.step.Verify(r.g, ctx, cluster)
+	}
+	return nil
+}
+
+func (r *releaseUpgradeStepAction) Cleanup(ctx context.Context, state *specState) error {
+	// Only the first step installed the release, the others only changed it
+	if r.stepNum != 1 || state.releases[r.id].SkipDelete {
+		return nil
+	}
+	return state.suite.opts.Helm.Delete(ctx, state.getCluster(r.clusterID), state.releases[r.id], true).Run()
+}
+
+func (r *releaseUpgradeStepAction) Title(state *specState) string {
+	release := state.releases[r.id]
+	cluster := state.getCluster(r.clusterID).GetName()
+	switch {
+	case r.step.Rollback:
+		return fmt.Sprintf("Roll back helm release %s in cluster %s (step %d/%d)", release.Name, cluster, r.stepNum, r.numSteps)
+	case r.stepNum == 1:
+		return fmt.Sprintf("Deploy helm release %s to cluster %s (step %d/%d)", release.Name, cluster, r.stepNum, r.numSteps)
+	default:
+		return fmt.Sprintf("Upgrade helm release %s in cluster %s to %s (step %d/%d)", release.Name, cluster, chartDescription(release.Chart), r.stepNum, r.numSteps)
+	}
+}
+
+// chartDescription returns the name and version of a chart, for use in logs
+func chartDescription(chart *HelmChart) string {
+	version := chart.Version()
+	if version == "" {
+		return chart.Fullname()
+	}
+	return chart.Fullname() + "@" + version
+}
@@ -0,0 +1,159 @@
+package gingk8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/meln5674/gosh"
+)
+
+// recordingHelm is a Helm which records what it is asked to do instead of doing it
+type recordingHelm struct {
+	r *recorder
+}
+
+var _ = HelmRollbacker(recordingHelm{})
+
+func (h recordingHelm) AddRepo(ctx context.Context, repo *HelmRepo) gosh.Commander {
+	return recordCommander(ctx, h.r, "add repo "+repo.Name)
+}
+
+func (h recordingHelm) InstallOrUpgrade(g Gingk8s, ctx context.Context, cluster Cluster, release *HelmRelease) gosh.Commander {
+	return recordCommander(ctx, h.r, fmt.Sprintf("install %s/%s %s", release.Namespace, release.Name, chartDescription(release.Chart)))
+}
+
+func (h recordingHelm) Delete(ctx context.Context, cluster Cluster, release *HelmRelease, skipNotExists bool) gosh.Commander {
+	return recordCommander(ctx, h.r, fmt.Sprintf("delete %s/%s", release.Namespace, release.Name))
+}
+
+func (h recordingHelm) Rollback(ctx context.Context, cluster Cluster, release *HelmRelease, revision int) gosh.Commander {
+	return recordCommander(ctx, h.r, fmt.Sprintf("rollback %s/%s %d", release.Namespace, release.Name, revision))
+}
+
+// recordingHelmWithoutRollback hides the HelmRollbacker implementation of a Helm
+type recordingHelmWithoutRollback struct {
+	Helm
+}
+
+// localChart returns a chart in a local directory
+func localChart(path string) *HelmChart {
+	return &HelmChart{LocalChartInfo: LocalChartInfo{Path: path}}
+}
+
+func TestReleaseUpgradePath(t *testing.T) {
+	errVerify := errors.New("verify")
+	cases := []struct {
+		name string
+		// noRollback, if true, uses a Helm which cannot roll back
+		noRollback bool
+		// failVerify is the number of the step whose verification fails, if any
+		failVerify int
+		events     string
+		err        string
+	}{
+		{
+			name: "all steps",
+			events: "install ns/app ./v1,verify 1,install ns/app ./v2,verify 2,rollback ns/app 0,verify 3," +
+				"install ns/app ./v3,verify 4,setup after,cleanup after,delete ns/app",
+		},
+		{
+			name:       "verification failure",
+			failVerify: 2,
+			events:     "install ns/app ./v1,verify 1,install ns/app ./v2,verify 2,delete ns/app",
+			err:        errVerify.Error(),
+		},
+		{
+			name:       "rollback unsupported",
+			noRollback: true,
+			events:     "install ns/app ./v1,verify 1,install ns/app ./v2,verify 2,delete ns/app",
+			err:        "does not support rolling back releases",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &recorder{}
+			h := newManualHarness(t)
+			g := New(h)
+			var helm Helm = recordingHelm{r: r}
+			if tc.noRollback {
+				helm = recordingHelmWithoutRollback{Helm: helm}
+			}
+			g.Options(SuiteOpts{Helm: helm, Kubectl: scriptKubectl("exit 0")})
+			verify := func(step int) ClusterAction {
+				return func(Gingk8s, context.Context, Cluster) error {
+					r.record(fmt.Sprintf("verify %d", step))
+					if step == tc.failVerify {
+						return errVerify
+					}
+					return nil
+				}
+			}
+			cluster := g.Cluster(testCluster(t))
+			v2 := &HelmRelease{Name: "ignored", Namespace: "ignored", Chart: localChart("v2")}
+			path := g.ReleaseUpgradePath(cluster, []HelmUpgradeStep{
+				{Release: &HelmRelease{Name: "app", Namespace: "ns", Chart: localChart("v1")}, Verify: verify(1)},
+				{Release: v2, Verify: verify(2)},
+				{Rollback: true, Verify: verify(3)},
+				{Release: &HelmRelease{Chart: localChart("v3")}, Verify: verify(4)},
+			})
+			g.ClusterAction(cluster, "after", r.action("after"), path)
+
+			checkErr(t, g.TrySetup(context.Background()), tc.err)
+			h.cleanup()
+
+			if events := r.get(); events != tc.events {
+				t.Errorf("expected events %q, got %q", tc.events, events)
+			}
+			if v2.Name != "ignored" || v2.Namespace != "ignored" {
+				t.Error("expected the release of a step not to be modified")
+			}
+		})
+	}
+}
+
+func TestReleaseUpgradePathTitles(t *testing.T) {
+	g := ForTest(t)
+	cluster := g.Cluster(testCluster(t))
+	g.ReleaseUpgradePath(cluster, []HelmUpgradeStep{
+		{Release: &HelmRelease{Name: "app", Chart: localChart("v1")}},
+		{Release: &HelmRelease{Chart: &HelmChart{RemoteChartInfo: RemoteChartInfo{Name: "app", Repo: &HelmRepo{Name: "repo"}, Version: "2.0.0"}}}},
+		{Rollback: true},
+	})
+	titles := []string{}
+	for _, node := range g.setup[1:] {
+		titles = append(titles, node.Title(g.specState))
+	}
+	expected := []string{
+		"Deploy helm release app to cluster test (step 1/3)",
+		"Upgrade helm release app in cluster test to repo/app@2.0.0 (step 2/3)",
+		"Roll back helm release app in cluster test (step 3/3)",
+	}
+	if strings.Join(titles, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected titles:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(titles, "\n"))
+	}
+}
+
+func TestReleaseUpgradePathInvalid(t *testing.T) {
+	release := &HelmRelease{Name: "app", Chart: localChart("chart")}
+	cases := map[string][]HelmUpgradeStep{
+		"no steps":         nil,
+		"first rollback":   {{Rollback: true}, {Release: release}},
+		"first no release": {{}},
+		"later no release": {{Release: release}, {}},
+	}
+	for name, steps := range cases {
+		t.Run(name, func(t *testing.T) {
+			g := ForTest(t)
+			cluster := g.Cluster(testCluster(t))
+			defer func() {
+				if r, _ := recover().(string); !strings.HasPrefix(r, "BUG: ") {
+					t.Errorf("expected a panic, got %v", r)
+				}
+			}()
+			g.ReleaseUpgradePath(cluster, steps)
+		})
+	}
+}
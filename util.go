@@ -6,26 +6,34 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
-
-	. "github.com/onsi/gomega"
 )
 
 var (
 	randPortLock = make(chan struct{}, 1)
 )
 
-// GetRandomPort returns a port that is not currently in use
+// GetRandomPort returns a port that is not currently in use. It panics if one cannot be found.
 func GetRandomPort() int {
 	return WithRandomPort[int](func(port int) int { return port })
 }
 
-// WithRandomPort calls a function with a port that is not currently in use
+// WithRandomPort calls a function with a port that is not currently in use. It panics if one cannot be found.
 func WithRandomPort[T any](f func(int) T) T {
 	return WithRandomPorts[T](1, func(ports []int) T { return f(ports[0]) })
 }
 
-// WithRandomPort calls a function a set of ports that are not currently in use
+// WithRandomPort calls a function a set of ports that are not currently in use.
+// It panics if they cannot be found, see TryWithRandomPorts to handle the error instead.
 func WithRandomPorts[T any](count int, f func([]int) T) T {
+	out, err := TryWithRandomPorts[T](count, f)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// TryWithRandomPorts is WithRandomPorts, but returns an error instead of panicking
+func TryWithRandomPorts[T any](count int, f func([]int) T) (T, error) {
 	randPortLock <- struct{}{}
 	defer func() { <-randPortLock }()
 
@@ -34,7 +42,10 @@ func WithRandomPorts[T any](count int, f func([]int) T) T {
 	for ix := 0; ix < count; ix++ {
 
 		listener, err := net.Listen("tcp", ":0")
-		Expect(err).ToNot(HaveOccurred())
+		if err != nil {
+			var zero T
+			return zero, err
+		}
 		defer listener.Close()
 
 		listeners[ix] = listener
@@ -44,7 +55,7 @@ func WithRandomPorts[T any](count int, f func([]int) T) T {
 		listener.Close()
 	}
 
-	return f(ports)
+	return f(ports), nil
 }
 
 func tryLock(dir string) (bool, error) {
@@ -0,0 +1,22 @@
+package gingk8s
+
+import (
+	"testing"
+)
+
+func TestTryWithRandomPorts(t *testing.T) {
+	ports, err := TryWithRandomPorts[[]int](3, func(ports []int) []int { return ports })
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[int]bool{}
+	for _, port := range ports {
+		if port <= 0 || seen[port] {
+			t.Errorf("expected distinct ports, got %v", ports)
+		}
+		seen[port] = true
+	}
+	if len(ports) != 3 {
+		t.Errorf("expected 3 ports, got %v", ports)
+	}
+}